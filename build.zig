@@ -69,7 +69,7 @@ pub fn build(b: *std.Build) !void {
     const lsp = b.dependency("lsp_kit", .{});
 
     const check = setupCheckStep(b, target, optimize, options, superhtml, folders, lsp);
-    setupTestStep(b, superhtml, check);
+    setupTestStep(b, target, optimize, options, superhtml, folders, lsp, check);
     setupCliTool(b, target, optimize, options, superhtml, folders, lsp);
     setupWasmStep(b, optimize, options, superhtml, lsp);
     setupFetchLanguageSubtagRegistryStep(b, target);
@@ -131,7 +131,12 @@ fn setupCheckStep(
 }
 fn setupTestStep(
     b: *std.Build,
+    target: std.Build.ResolvedTarget,
+    optimize: std.builtin.OptimizeMode,
+    options: *std.Build.Step.Options,
     superhtml: *std.Build.Module,
+    folders: *std.Build.Dependency,
+    lsp: *std.Build.Dependency,
     check: *std.Build.Step,
 ) void {
     const test_step = b.step("test", "Run unit tests");
@@ -144,6 +149,26 @@ fn setupTestStep(
 
     const run_unit_tests = b.addRunArtifact(unit_tests);
     test_step.dependOn(&run_unit_tests.step);
+
+    const cli_tests = b.addTest(.{
+        .root_module = b.createModule(.{
+            .root_source_file = b.path("src/main.zig"),
+            .target = target,
+            .optimize = optimize,
+        }),
+        .filters = b.args orelse &.{},
+    });
+
+    cli_tests.root_module.addImport("superhtml", superhtml);
+    cli_tests.root_module.addImport(
+        "known_folders",
+        folders.module("known-folders"),
+    );
+    cli_tests.root_module.addImport("lsp", lsp.module("lsp"));
+    cli_tests.root_module.addOptions("build_options", options);
+
+    const run_cli_tests = b.addRunArtifact(cli_tests);
+    test_step.dependOn(&run_cli_tests.step);
 }
 
 fn setupCliTool(
@@ -19,7 +19,7 @@ blocks: std.StringHashMapUnmanaged(u32),
 nodes: []const Node,
 errors: []const Error,
 
-const Error = struct {
+pub const Error = struct {
     kind: union(enum) {
         bad_attr,
         else_must_be_first_attr,
@@ -48,6 +48,9 @@ const Error = struct {
         text_and_html_are_mutually_exclusive,
         text_and_html_require_an_empty_element,
         duplicate_block: Span,
+        block_not_in_interface,
+        extend_not_found,
+        extend_cycle,
         scripty: scripty.Parser.Node.Tag,
 
         pub fn message(k: @This()) []const u8 {
@@ -57,6 +60,43 @@ const Error = struct {
             };
         }
 
+        /// Returns a stable identifier for this kind of error, meant to be
+        /// referenced by tools and users. Never change an existing code.
+        pub fn code(k: @This()) []const u8 {
+            return switch (k) {
+                .bad_attr => "superhtml.bad-attr",
+                .else_must_be_first_attr => "superhtml.else-must-be-first-attr",
+                .missing_attribute_value => "superhtml.missing-attribute-value",
+                .loop_no_value => "superhtml.loop-no-value",
+                .block_cannot_be_inlined => "superhtml.block-cannot-be-inlined",
+                .block_missing_id => "superhtml.block-missing-id",
+                .already_branching => "superhtml.already-branching",
+                .id_under_loop => "superhtml.id-under-loop",
+                .extend_without_template_attr => "superhtml.extend-without-template-attr",
+                .top_level_super => "superhtml.top-level-super",
+                .super_wants_no_attributes => "superhtml.super-wants-no-attributes",
+                .block_with_scripted_id => "superhtml.block-with-scripted-id",
+                .super_parent_element_missing_id => "superhtml.super-parent-element-missing-id",
+                .template_interface_id_collision => "superhtml.template-interface-id-collision",
+                .missing_template_value => "superhtml.missing-template-value",
+                .unexpected_extend => "superhtml.unexpected-extend",
+                .unscripted_attr => "superhtml.unscripted-attr",
+                .two_supers_one_id => "superhtml.two-supers-one-id",
+                .super_under_branching => "superhtml.super-under-branching",
+                .one_branching_attribute_per_element => "superhtml.one-branching-attribute-per-element",
+                .ctx_attrs_must_be_scripted => "superhtml.ctx-attrs-must-be-scripted",
+                .else_with_value => "superhtml.else-with-value",
+                .no_ifs_after_loop => "superhtml.no-ifs-after-loop",
+                .text_and_html_are_mutually_exclusive => "superhtml.text-and-html-are-mutually-exclusive",
+                .text_and_html_require_an_empty_element => "superhtml.text-and-html-require-an-empty-element",
+                .duplicate_block => "superhtml.duplicate-block",
+                .block_not_in_interface => "superhtml.block-not-in-interface",
+                .extend_not_found => "superhtml.extend-not-found",
+                .extend_cycle => "superhtml.extend-cycle",
+                .scripty => "superhtml.scripty",
+            };
+        }
+
         pub fn format(k: @This(), w: *Writer) !void {
             try w.print("{s}", .{k.message()});
         }
@@ -407,6 +447,43 @@ pub fn root(ast: Ast) Node {
     return ast.nodes[0];
 }
 
+/// Returns the value of the `template` attribute of `<extend>`, or null if
+/// the template doesn't extend another one.
+pub fn extendTemplate(ast: Ast) ?Span {
+    if (ast.extends_idx == 0) return null;
+    return ast.nodes[ast.extends_idx].templateValue().span;
+}
+
+/// Reports blocks that don't match any `<super>` in the interface of
+/// `layout`, the template extended by `ast`. The caller owns the returned
+/// slice.
+pub fn blockErrors(
+    ast: Ast,
+    gpa: Allocator,
+    layout: Ast,
+) error{OutOfMemory}![]const Error {
+    std.debug.assert(ast.extends_idx != 0);
+
+    var errors: std.ArrayList(Error) = .empty;
+    errdefer errors.deinit(gpa);
+
+    var it = ast.blocks.iterator();
+    while (it.next()) |kv| {
+        if (layout.interface.contains(kv.key_ptr.*)) continue;
+        try errors.append(gpa, .{
+            .kind = .block_not_in_interface,
+            .main_location = ast.nodes[kv.value_ptr.*].blockId().span,
+        });
+    }
+
+    std.mem.sort(Error, errors.items, {}, struct {
+        fn lessThan(_: void, lhs: Error, rhs: Error) bool {
+            return lhs.main_location.start < rhs.main_location.start;
+        }
+    }.lessThan);
+    return errors.toOwnedSlice(gpa);
+}
+
 const Parser = struct {
     src: []const u8,
     html: html.Ast,
@@ -1112,7 +1189,7 @@ test "basics" {
         std.testing.allocator,
         case,
         .superhtml,
-        true,
+        .{ .syntax_only = true },
     );
     defer html_ast.deinit(std.testing.allocator);
     const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1148,7 +1225,7 @@ test "text/html - errors" {
             std.testing.allocator,
             case,
             .superhtml,
-            true,
+            .{ .syntax_only = true },
         );
         defer html_ast.deinit(std.testing.allocator);
         const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1173,7 +1250,7 @@ test "siblings" {
         std.testing.allocator,
         case,
         .superhtml,
-        true,
+        .{ .syntax_only = true },
     );
     defer html_ast.deinit(std.testing.allocator);
     const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1208,7 +1285,7 @@ test "nesting" {
         std.testing.allocator,
         case,
         .superhtml,
-        true,
+        .{ .syntax_only = true },
     );
     defer html_ast.deinit(std.testing.allocator);
     const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1245,7 +1322,7 @@ test "deeper nesting" {
         std.testing.allocator,
         case,
         .superhtml,
-        true,
+        .{ .syntax_only = true },
     );
     defer html_ast.deinit(std.testing.allocator);
     const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1287,7 +1364,7 @@ test "complex example" {
         std.testing.allocator,
         case,
         .superhtml,
-        true,
+        .{ .syntax_only = true },
     );
     defer html_ast.deinit(std.testing.allocator);
     const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1334,7 +1411,7 @@ test "if-else-loop errors" {
             std.testing.allocator,
             case,
             .superhtml,
-            true,
+            .{ .syntax_only = true },
         );
         defer html_ast.deinit(std.testing.allocator);
         const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1364,7 +1441,7 @@ test "super" {
         std.testing.allocator,
         case,
         .superhtml,
-        true,
+        .{ .syntax_only = true },
     );
     defer html_ast.deinit(std.testing.allocator);
     const tree = try Ast.init(std.testing.allocator, html_ast, case);
@@ -1393,6 +1470,55 @@ test "super" {
     const cex: usize = 2;
     try std.testing.expectEqual(cex, tree.childrenCount(tree.child(r).?));
 }
+test "extend blocks" {
+    const layout_case =
+        \\<html>
+        \\  <head><title id="title"><super></title></head>
+        \\  <body id="main"><super></body>
+        \\</html>
+    ;
+    const page_case =
+        \\<extend template="layout.shtml">
+        \\<title id="title">Hello</title>
+        \\<body id="content"></body>
+    ;
+
+    const layout_html = try html.Ast.init(
+        std.testing.allocator,
+        layout_case,
+        .superhtml,
+        .{ .syntax_only = true },
+    );
+    defer layout_html.deinit(std.testing.allocator);
+    const layout = try Ast.init(std.testing.allocator, layout_html, layout_case);
+    defer layout.deinit(std.testing.allocator);
+    try std.testing.expect(layout.extendTemplate() == null);
+
+    const page_html = try html.Ast.init(
+        std.testing.allocator,
+        page_case,
+        .superhtml,
+        .{ .syntax_only = true },
+    );
+    defer page_html.deinit(std.testing.allocator);
+    const page = try Ast.init(std.testing.allocator, page_html, page_case);
+    defer page.deinit(std.testing.allocator);
+    try std.testing.expectEqual(0, page.errors.len);
+    try std.testing.expectEqualStrings(
+        "layout.shtml",
+        page.extendTemplate().?.slice(page_case),
+    );
+
+    const errors = try page.blockErrors(std.testing.allocator, layout);
+    defer std.testing.allocator.free(errors);
+    try std.testing.expectEqual(1, errors.len);
+    try std.testing.expect(errors[0].kind == .block_not_in_interface);
+    try std.testing.expectEqualStrings(
+        "content",
+        errors[0].main_location.slice(page_case),
+    );
+}
+
 // TODO: get rid of this once stack traces on arm64 work again
 // fn assert(loc: std.builtin.SourceLocation, condition: bool) void {
 //     if (!condition) {
@@ -0,0 +1,197 @@
+//! Project configuration loaded from `.superhtml.json`.
+//!
+//! The nearest config file found by walking up from the directory of the
+//! checked file wins. Rules not mentioned in it keep their default level.
+const Config = @This();
+
+const std = @import("std");
+const Io = std.Io;
+const Allocator = std.mem.Allocator;
+const super = @import("superhtml");
+const Rule = super.html.Ast.Rule;
+const Rules = super.html.Ast.Rules;
+const AttributeOrder = super.html.Ast.AttributeOrder;
+const BooleanAttributeStyle = super.html.Ast.BooleanAttributeStyle;
+const IndentStyle = super.html.Ast.IndentStyle;
+const BlankLines = super.html.Ast.BlankLines;
+const VoidElementStyle = super.html.Ast.VoidElementStyle;
+
+pub const file_name = ".superhtml.json";
+
+/// Path of the config file, null if none was found.
+path: ?[]const u8 = null,
+rules: Rules = .default,
+/// Set to false to only check the syntax of SuperHTML templates.
+superhtml_validation: bool = true,
+attribute_order: AttributeOrder = .preserve,
+boolean_attribute_style: BooleanAttributeStyle = .collapse,
+print_width: ?u32 = null,
+indent_style: IndentStyle = .tab,
+/// Spaces per indentation level when indenting with spaces.
+indent_width: u32 = 4,
+/// How runs of blank lines between nodes are formatted.
+blank_lines: BlankLines = .collapse,
+/// Limits checked by the `max-attributes` and `max-depth` rules.
+max_attributes: ?u32 = null,
+max_depth: ?u32 = null,
+/// Used both by the formatter and by the `self-closing` rule.
+void_element_style: VoidElementStyle = .html,
+/// Validate all documents as fragments, like `--fragment`.
+fragment: bool = false,
+
+pub const Error = error{ InvalidConfig, OutOfMemory };
+
+/// Looks for a config file starting from `dir_path` and walking up to the
+/// filesystem root. When no config file is found, the default config is
+/// returned. On error, a description of the problem is written to `diag`.
+pub fn load(
+    io: Io,
+    arena: Allocator,
+    dir_path: []const u8,
+    diag: *[]const u8,
+) Error!Config {
+    const abs_dir = Io.Dir.cwd().realPathFileAlloc(io, dir_path, arena) catch {
+        return .{};
+    };
+
+    var current: ?[]const u8 = abs_dir;
+    while (current) |dir| : (current = std.fs.path.dirname(dir)) {
+        const path = try std.fs.path.join(arena, &.{ dir, file_name });
+        const bytes = Io.Dir.cwd().readFileAlloc(
+            io,
+            path,
+            arena,
+            .limited(super.max_size),
+        ) catch |err| switch (err) {
+            error.FileNotFound, error.NotDir => continue,
+            error.OutOfMemory => return error.OutOfMemory,
+            else => {
+                diag.* = try std.fmt.allocPrint(arena, "{s}: unable to read file: {t}", .{
+                    path, err,
+                });
+                return error.InvalidConfig;
+            },
+        };
+
+        var config = parse(arena, bytes, diag) catch |err| switch (err) {
+            error.OutOfMemory => return error.OutOfMemory,
+            error.InvalidConfig => {
+                diag.* = try std.fmt.allocPrint(arena, "{s}: {s}", .{ path, diag.* });
+                return error.InvalidConfig;
+            },
+        };
+        config.path = path;
+        return config;
+    }
+
+    return .{};
+}
+
+/// Parses the contents of a config file, applying its rule levels on top
+/// of the defaults.
+pub fn parse(arena: Allocator, bytes: []const u8, diag: *[]const u8) Error!Config {
+    const File = struct {
+        rules: std.json.ArrayHashMap(Rule.Level) = .{},
+        @"superhtml-validation": bool = true,
+        @"attribute-order": AttributeOrder = .preserve,
+        @"boolean-attribute-style": BooleanAttributeStyle = .collapse,
+        @"print-width": ?u32 = null,
+        @"indent-style": IndentStyle = .tab,
+        @"indent-width": u32 = 4,
+        @"blank-lines": BlankLines = .collapse,
+        @"max-attributes": ?u32 = null,
+        @"max-depth": ?u32 = null,
+        @"void-element-style": VoidElementStyle = .html,
+        fragment: bool = false,
+    };
+
+    const file = std.json.parseFromSliceLeaky(File, arena, bytes, .{
+        .ignore_unknown_fields = true,
+    }) catch |err| switch (err) {
+        error.OutOfMemory => return error.OutOfMemory,
+        else => {
+            diag.* = try std.fmt.allocPrint(arena, "invalid config: {t}", .{err});
+            return error.InvalidConfig;
+        },
+    };
+
+    var config: Config = .{
+        .superhtml_validation = file.@"superhtml-validation",
+        .attribute_order = file.@"attribute-order",
+        .boolean_attribute_style = file.@"boolean-attribute-style",
+        .print_width = file.@"print-width",
+        .indent_style = file.@"indent-style",
+        .indent_width = file.@"indent-width",
+        .blank_lines = file.@"blank-lines",
+        .max_attributes = file.@"max-attributes",
+        .max_depth = file.@"max-depth",
+        .void_element_style = file.@"void-element-style",
+        .fragment = file.fragment,
+    };
+    if (config.indent_width == 0) {
+        diag.* = "'indent-width' must be greater than zero";
+        return error.InvalidConfig;
+    }
+    var it = file.rules.map.iterator();
+    while (it.next()) |entry| {
+        const rule = std.meta.stringToEnum(Rule, entry.key_ptr.*) orelse {
+            diag.* = try std.fmt.allocPrint(arena, "unknown rule '{s}'", .{
+                entry.key_ptr.*,
+            });
+            return error.InvalidConfig;
+        };
+        config.rules.set(rule, entry.value_ptr.*);
+    }
+
+    return config;
+}
+
+/// Formatter settings.
+pub fn renderOptions(config: Config) super.html.Ast.RenderOptions {
+    return .{
+        .attribute_order = config.attribute_order,
+        .boolean_attribute_style = config.boolean_attribute_style,
+        .print_width = config.print_width,
+        .indent_style = config.indent_style,
+        .indent_width = config.indent_width,
+        .blank_lines = config.blank_lines,
+        .void_element_style = config.void_element_style,
+    };
+}
+
+/// Writes the effective config as a JSON object.
+pub fn write(config: Config, js: *std.json.Stringify) !void {
+    try js.beginObject();
+    try js.objectField("path");
+    try js.write(config.path);
+    try js.objectField("superhtml-validation");
+    try js.write(config.superhtml_validation);
+    try js.objectField("attribute-order");
+    try js.write(config.attribute_order);
+    try js.objectField("boolean-attribute-style");
+    try js.write(config.boolean_attribute_style);
+    try js.objectField("print-width");
+    try js.write(config.print_width);
+    try js.objectField("indent-style");
+    try js.write(config.indent_style);
+    try js.objectField("indent-width");
+    try js.write(config.indent_width);
+    try js.objectField("blank-lines");
+    try js.write(config.blank_lines);
+    try js.objectField("max-attributes");
+    try js.write(config.max_attributes);
+    try js.objectField("max-depth");
+    try js.write(config.max_depth);
+    try js.objectField("void-element-style");
+    try js.write(config.void_element_style);
+    try js.objectField("fragment");
+    try js.write(config.fragment);
+    try js.objectField("rules");
+    try js.beginObject();
+    for (std.enums.values(Rule)) |rule| {
+        try js.objectField(@tagName(rule));
+        try js.write(config.rules.get(rule));
+    }
+    try js.endObject();
+    try js.endObject();
+}
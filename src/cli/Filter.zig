@@ -0,0 +1,247 @@
+//! Decides which files are processed by `check` and `fmt`.
+const Filter = @This();
+
+const std = @import("std");
+const Io = std.Io;
+const builtin = @import("builtin");
+const super = @import("superhtml");
+
+/// Comma separated list of the extensions of the files to process.
+extensions: []const u8 = default_extensions,
+/// Glob patterns of the paths to skip when walking directories.
+exclude: []const []const u8 = &.{},
+
+pub const default_extensions = ".html,.htm,.shtml";
+
+/// Returns the language of the file at `path`, or null if its extension is
+/// not one of the selected ones. `.shtml` files are SuperHTML templates,
+/// all other files are HTML.
+pub fn language(filter: Filter, path: []const u8) ?super.Language {
+    const ext = std.fs.path.extension(path);
+    if (ext.len == 0) return null;
+
+    var it = std.mem.tokenizeScalar(u8, filter.extensions, ',');
+    while (it.next()) |entry| {
+        const wanted = std.mem.trim(u8, entry, " ");
+        const name = if (std.mem.startsWith(u8, wanted, ".")) wanted[1..] else wanted;
+        if (std.mem.eql(u8, ext[1..], name)) break;
+    } else return null;
+
+    return if (std.mem.eql(u8, ext, ".shtml")) .superhtml else .html;
+}
+
+/// Returns true if `path`, relative to the directory being walked, matches
+/// one of the exclude patterns. Patterns without a slash are matched against
+/// each component of the path (e.g. `node_modules` or `*.min.html`), the
+/// others against the path and each of its parent directories (e.g.
+/// `build/out`). `Walker` doesn't descend into excluded directories.
+pub fn excludes(filter: Filter, path: []const u8) bool {
+    for (filter.exclude) |raw_pattern| {
+        var pattern = raw_pattern;
+        if (std.mem.startsWith(u8, pattern, "./")) pattern = pattern[2..];
+        pattern = std.mem.trim(u8, pattern, "/");
+        if (pattern.len == 0) continue;
+
+        if (std.mem.indexOfScalar(u8, pattern, '/') == null) {
+            var it = std.mem.tokenizeScalar(u8, path, std.fs.path.sep);
+            while (it.next()) |component| {
+                if (globMatch(pattern, component)) return true;
+            }
+            continue;
+        }
+
+        for (path, 0..) |c, idx| {
+            if (c == std.fs.path.sep and globMatch(pattern, path[0..idx])) return true;
+        }
+        if (globMatch(pattern, path)) return true;
+    }
+    return false;
+}
+
+/// Walks the directory tree at `path`, see `Walker`.
+pub fn walk(
+    filter: Filter,
+    io: Io,
+    gpa: std.mem.Allocator,
+    path: []const u8,
+) !Walker {
+    var dir = try Io.Dir.cwd().openDir(io, path, .{ .iterate = true });
+    errdefer dir.close(io);
+    return .{ .filter = filter, .dir = dir, .inner = try dir.walk(gpa) };
+}
+
+/// Iterates over the files of a directory tree that the filter selects,
+/// without descending into excluded directories. The walker doesn't follow
+/// symlinks, so links that point back up the tree can't cause infinite
+/// recursion.
+pub const Walker = struct {
+    filter: Filter,
+    dir: Io.Dir,
+    inner: Io.Dir.Walker,
+
+    pub fn deinit(w: *Walker, io: Io) void {
+        w.inner.deinit();
+        w.dir.close(io);
+    }
+
+    /// Entry paths are relative to the walked directory.
+    pub fn next(w: *Walker, io: Io) !?Io.Dir.Walker.Entry {
+        while (try w.inner.next(io)) |item| switch (item.kind) {
+            .file => {
+                if (w.filter.excludes(item.path)) continue;
+                if (w.filter.language(item.basename) == null) continue;
+                return item;
+            },
+            .directory => if (w.filter.excludes(item.path)) w.inner.leave(io),
+            else => {},
+        };
+        return null;
+    }
+};
+
+/// The command line flags shared by `check` and `fmt` that select which
+/// files are processed and how the document read from stdin is treated.
+pub const Flags = struct {
+    extensions: []const u8 = default_extensions,
+    exclude: std.ArrayList([]const u8) = .empty,
+    /// Path of the document read from stdin, if provided.
+    stdin_filename: ?[]const u8 = null,
+
+    /// Parses `args[idx.*]` and its value, leaving `idx` on the value.
+    /// Returns false if `args[idx.*]` is not one of these flags. Exits on a
+    /// missing value.
+    pub fn parse(
+        flags: *Flags,
+        gpa: std.mem.Allocator,
+        args: []const []const u8,
+        idx: *usize,
+    ) error{OutOfMemory}!bool {
+        const Flag = enum { @"--ext", @"--exclude", @"--stdin-filename" };
+        const arg = args[idx.*];
+        const flag = std.meta.stringToEnum(Flag, arg) orelse return false;
+
+        idx.* += 1;
+        if (idx.* == args.len) {
+            std.debug.print("missing value for '{s}'\n", .{arg});
+            std.process.exit(1);
+        }
+
+        const value = args[idx.*];
+        switch (flag) {
+            .@"--ext" => flags.extensions = value,
+            .@"--exclude" => try flags.exclude.append(gpa, value),
+            .@"--stdin-filename" => flags.stdin_filename = value,
+        }
+        return true;
+    }
+
+    pub fn filter(flags: Flags) Filter {
+        return .{
+            .extensions = flags.extensions,
+            .exclude = flags.exclude.items,
+        };
+    }
+
+    /// Returns the language selected by `--stdin-filename`, if given. Exits
+    /// if the command doesn't read from stdin or if the extension is not
+    /// one of the selected ones.
+    pub fn stdinLanguage(flags: Flags, reads_stdin: bool) ?super.Language {
+        const path = flags.stdin_filename orelse return null;
+        if (!reads_stdin) {
+            std.debug.print("'--stdin-filename' requires reading from stdin\n", .{});
+            std.process.exit(1);
+        }
+        return flags.filter().language(path) orelse {
+            std.debug.print("unknown file extension: '{s}'\n", .{path});
+            std.process.exit(1);
+        };
+    }
+};
+
+/// `*` matches any sequence of characters except for separators, `**`
+/// matches separators too, `?` matches any single character except for a
+/// separator.
+fn globMatch(pattern: []const u8, str: []const u8) bool {
+    if (pattern.len == 0) return str.len == 0;
+    switch (pattern[0]) {
+        '*' => {
+            const double = pattern.len > 1 and pattern[1] == '*';
+            const rest = pattern[if (double) 2 else 1..];
+            var idx: usize = 0;
+            while (true) : (idx += 1) {
+                if (globMatch(rest, str[idx..])) return true;
+                if (idx == str.len) return false;
+                if (!double and isSep(str[idx])) return false;
+            }
+        },
+        '?' => return str.len > 0 and !isSep(str[0]) and
+            globMatch(pattern[1..], str[1..]),
+        '/' => return str.len > 0 and isSep(str[0]) and
+            globMatch(pattern[1..], str[1..]),
+        else => return str.len > 0 and str[0] == pattern[0] and
+            globMatch(pattern[1..], str[1..]),
+    }
+}
+
+fn isSep(c: u8) bool {
+    return c == '/' or c == std.fs.path.sep;
+}
+
+test "globMatch" {
+    try std.testing.expect(globMatch("node_modules", "node_modules"));
+    try std.testing.expect(!globMatch("node_modules", "node_modules2"));
+    try std.testing.expect(globMatch("*.html", "index.html"));
+    try std.testing.expect(!globMatch("*.html", "index.htm"));
+    try std.testing.expect(!globMatch("*.html", "docs/index.html"));
+    try std.testing.expect(globMatch("**/*.html", "docs/api/index.html"));
+    try std.testing.expect(globMatch("docs/**", "docs/api/index.html"));
+    try std.testing.expect(globMatch("docs/?.html", "docs/a.html"));
+    try std.testing.expect(!globMatch("docs/?.html", "docs/ab.html"));
+    try std.testing.expect(!globMatch("docs/?", "docs//"));
+}
+
+test "excludes" {
+    // Walkers report paths with the native separator.
+    if (builtin.os.tag == .windows) return error.SkipZigTest;
+
+    const filter: Filter = .{
+        .exclude = &.{ "node_modules", "./build/out/", "*.min.html" },
+    };
+    try std.testing.expect(filter.excludes("node_modules"));
+    try std.testing.expect(filter.excludes("site/node_modules/index.html"));
+    try std.testing.expect(filter.excludes("build/out"));
+    try std.testing.expect(filter.excludes("build/out/index.html"));
+    try std.testing.expect(!filter.excludes("build/index.html"));
+    try std.testing.expect(!filter.excludes("site/build/out/index.html"));
+    try std.testing.expect(filter.excludes("js/app.min.html"));
+    try std.testing.expect(!filter.excludes("index.html"));
+}
+
+test "Flags" {
+    const gpa = std.testing.allocator;
+    const args: []const []const u8 = &.{
+        "--ext",     ".html,.shtml",
+        "--exclude", "node_modules",
+        "--check",   "--stdin-filename",
+        "index.shtml",
+    };
+
+    var flags: Flags = .{};
+    defer flags.exclude.deinit(gpa);
+
+    var idx: usize = 0;
+    try std.testing.expect(try flags.parse(gpa, args, &idx));
+    try std.testing.expectEqual(1, idx);
+    idx += 1;
+    try std.testing.expect(try flags.parse(gpa, args, &idx));
+    idx += 1;
+    try std.testing.expect(!try flags.parse(gpa, args, &idx));
+    idx += 1;
+    try std.testing.expect(try flags.parse(gpa, args, &idx));
+    try std.testing.expectEqual(args.len - 1, idx);
+
+    try std.testing.expectEqualStrings(".html,.shtml", flags.extensions);
+    try std.testing.expectEqual(1, flags.exclude.items.len);
+    try std.testing.expectEqual(super.Language.superhtml, flags.stdinLanguage(true).?);
+    try std.testing.expect(flags.filter().language("index.htm") == null);
+}
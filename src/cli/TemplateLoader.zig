@@ -0,0 +1,48 @@
+//! Loads the templates referenced by `<extend>` from the file system,
+//! relative to the template that extends them.
+const TemplateLoader = @This();
+
+const std = @import("std");
+const Io = std.Io;
+const Allocator = std.mem.Allocator;
+const super = @import("superhtml");
+const encoding = @import("encoding.zig");
+
+io: Io,
+/// Path of the document being validated, null for stdin.
+path: ?[]const u8,
+
+pub fn loader(tl: *TemplateLoader) super.Validation.Loader {
+    return .{ .context = tl, .loadFn = load };
+}
+
+fn load(
+    context: *anyopaque,
+    arena: Allocator,
+    base: ?[]const u8,
+    template: []const u8,
+) error{OutOfMemory}!?super.Validation.Loader.Template {
+    const tl: *TemplateLoader = @ptrCast(@alignCast(context));
+    const dir_path = if (base orelse tl.path) |p|
+        std.fs.path.dirname(p) orelse "."
+    else
+        ".";
+    const path = try std.fs.path.resolve(arena, &.{ dir_path, template });
+
+    const bytes = Io.Dir.cwd().readFileAllocOptions(
+        tl.io,
+        path,
+        arena,
+        .limited(super.max_size),
+        .of(u8),
+        0,
+    ) catch |err| switch (err) {
+        error.OutOfMemory => return error.OutOfMemory,
+        else => return null,
+    };
+    const src = encoding.toUtf8(arena, bytes) catch |err| switch (err) {
+        error.OutOfMemory => return error.OutOfMemory,
+        error.InvalidUtf16 => return null,
+    };
+    return .{ .path = path, .src = src };
+}
@@ -3,12 +3,25 @@ const std = @import("std");
 const Io = std.Io;
 const Allocator = std.mem.Allocator;
 const super = @import("superhtml");
-
-const FileType = enum { html, super };
+const Config = @import("Config.zig");
+const Filter = @import("Filter.zig");
+const encoding = @import("encoding.zig");
+const TemplateLoader = @import("TemplateLoader.zig");
 
 pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
-    const cmd = Command.parse(args);
-    var any_error = false;
+    const cmd = Command.parse(gpa, args);
+
+    if (cmd.print_config) printConfig(io, gpa, cmd.mode, cmd.stdin_filename);
+    if (cmd.watch) try watch(io, gpa, cmd);
+
+    // Diagnostics must outlive the per-file arena when they are collected
+    // for structured output.
+    var report_arena = std.heap.ArenaAllocator.init(gpa);
+    var report: Report = .{
+        .format = cmd.format,
+        .arena = report_arena.allocator(),
+    };
+
     switch (cmd.mode) {
         .stdin => {
             var fr = std.Io.File.stdin().reader(io, &.{});
@@ -16,7 +29,7 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
             _ = try fr.interface.streamRemaining(&aw.writer);
             const in_bytes = try aw.toOwnedSliceSentinel(0);
 
-            try checkHtml(io, gpa, null, in_bytes, cmd.syntax_only);
+            try checkCode(io, gpa, &report, cmd.stdin_filename, in_bytes, .html, cmd.parse_options);
         },
         .stdin_super => {
             var fr = std.Io.File.stdin().reader(io, &.{});
@@ -24,7 +37,7 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
             _ = try fr.interface.streamRemaining(&aw.writer);
             const in_bytes = try aw.toOwnedSliceSentinel(0);
 
-            try checkSuper(io, gpa, null, in_bytes, cmd.syntax_only);
+            try checkCode(io, gpa, &report, cmd.stdin_filename, in_bytes, .superhtml, cmd.parse_options);
         },
         .paths => |paths| {
             // checkFile will reset the arena at the end of each call
@@ -33,20 +46,22 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
                 checkFile(
                     io,
                     &arena_impl,
+                    &report,
                     Io.Dir.cwd(),
                     path,
                     path,
-                    &any_error,
-                    cmd.syntax_only,
+                    cmd.filter,
+                    cmd.parse_options,
                 ) catch |err| switch (err) {
                     error.IsDir, error.AccessDenied => {
                         checkDir(
                             io,
                             gpa,
                             &arena_impl,
+                            &report,
                             path,
-                            &any_error,
-                            cmd.syntax_only,
+                            cmd.filter,
+                            cmd.parse_options,
                         ) catch |dir_err| {
                             std.debug.print("Error walking dir '{s}': {t}\n", .{
                                 path,
@@ -66,55 +81,213 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
         },
     }
 
-    if (any_error) {
+    if (report.format == .json) {
+        var buf: [4096]u8 = undefined;
+        var stdout_writer = Io.File.stdout().writerStreaming(io, &buf);
+        const stdout = &stdout_writer.interface;
+        try std.json.Stringify.value(
+            report.diagnostics.items,
+            .{ .whitespace = .indent_2 },
+            stdout,
+        );
+        try stdout.writeByte('\n');
+        try stdout.flush();
+    }
+
+    if (report.any_error) {
         std.process.exit(1);
     }
     std.process.exit(0);
 }
 
+const Format = enum { text, json };
+
+const Report = struct {
+    format: Format,
+    /// Used for allocations that must survive across files.
+    arena: Allocator,
+    diagnostics: std.ArrayList(Diagnostic) = .empty,
+    any_error: bool = false,
+    /// Configs by directory, most files in a tree share the same one.
+    configs: std.StringHashMapUnmanaged(Config) = .empty,
+    /// Where text diagnostics are printed, stderr when null.
+    out: ?*Io.Writer = null,
+
+    /// Returns the config that applies to the file at `path`, stdin uses
+    /// the config of the current working directory.
+    fn config(report: *Report, io: Io, path: ?[]const u8) !Config {
+        const dir_path = if (path) |p| std.fs.path.dirname(p) orelse "." else ".";
+        const gop = try report.configs.getOrPut(report.arena, dir_path);
+        if (gop.found_existing) return gop.value_ptr.*;
+
+        gop.key_ptr.* = try report.arena.dupe(u8, dir_path);
+        var diag: []const u8 = "";
+        gop.value_ptr.* = Config.load(io, report.arena, dir_path, &diag) catch |err| switch (err) {
+            error.OutOfMemory => return error.OutOfMemory,
+            error.InvalidConfig => {
+                std.debug.print("{s}\n", .{diag});
+                std.process.exit(1);
+            },
+        };
+        return gop.value_ptr.*;
+    }
+
+    fn addDiagnostics(
+        report: *Report,
+        io: Io,
+        result: super.Validation.Result,
+        code: []const u8,
+        bom: encoding.Bom,
+        path: ?[]const u8,
+    ) !void {
+        if (result.diagnostics.len == 0) return;
+
+        // Only rules at the 'error' level fail the check, with or without a
+        // config file.
+        for (result.diagnostics) |d| switch (d.severity) {
+            .@"error" => report.any_error = true,
+            .warning, .info => {},
+        };
+
+        switch (report.format) {
+            .text => if (report.out) |w| {
+                try result.print(code, path, w);
+            } else {
+                var stderr = Io.File.stderr().writer(io, &.{});
+                try result.print(code, path, &stderr.interface);
+            },
+            .json => for (result.diagnostics) |d| {
+                try report.diagnostics.append(report.arena, .{
+                    .file = path orelse "<stdin>",
+                    .severity = d.severity,
+                    .code = d.code,
+                    .rule = d.rule,
+                    .message = try report.arena.dupe(u8, d.message),
+                    .span = .init(d.span, code, bom),
+                    .note = if (d.note) |n| .{
+                        .message = n.message,
+                        .span = .init(n.span, code, bom),
+                    } else null,
+                });
+            },
+        }
+    }
+
+    fn addEncodingError(report: *Report, io: Io, path: ?[]const u8) !void {
+        report.any_error = true;
+        const fmt = "{s}: invalid UTF-16 document\n";
+        const args = .{path orelse "<stdin>"};
+        if (report.out) |w| {
+            try w.print(fmt, args);
+        } else {
+            var stderr = Io.File.stderr().writer(io, &.{});
+            try stderr.interface.print(fmt, args);
+        }
+    }
+};
+
+/// A diagnostic as emitted by `--format json`.
+/// Lines and columns are 1-based, offsets are 0-based byte offsets into the
+/// file, byte order mark included. Lines and columns of UTF-16 documents
+/// refer to the document decoded as UTF-8. `column` counts bytes, `utf16_column` counts UTF-16 code units
+/// (the default position encoding of LSP), the two differ on lines that
+/// contain non-ASCII characters.
+const Diagnostic = struct {
+    file: []const u8,
+    severity: super.html.Ast.Error.Severity,
+    /// Stable identifier of the diagnostic, e.g. `html.attr.unknown`.
+    code: []const u8,
+    /// Internal name of the error, emitted before `code` existed.
+    rule: []const u8,
+    message: []const u8,
+    span: Span,
+    /// Another relevant location, e.g. where a missing end tag was expected.
+    note: ?Note,
+
+    const Note = struct {
+        message: []const u8,
+        span: Span,
+    };
+
+    const Span = struct {
+        start: Position,
+        end: Position,
+
+        fn init(span: super.Span, code: []const u8, bom: encoding.Bom) Span {
+            const range = span.range(code);
+            const utf16_range = span.utf16Range(code);
+            return .{
+                .start = .{
+                    .offset = bom.fileOffset(code, span.start),
+                    .line = range.start.row + 1,
+                    .column = range.start.col + 1,
+                    .utf16_column = utf16_range.start.col + 1,
+                },
+                .end = .{
+                    .offset = bom.fileOffset(code, span.end),
+                    .line = range.end.row + 1,
+                    .column = range.end.col + 1,
+                    .utf16_column = utf16_range.end.col + 1,
+                },
+            };
+        }
+    };
+
+    const Position = struct {
+        offset: u32,
+        line: u32,
+        column: u32,
+        utf16_column: u32,
+    };
+};
+
 fn checkDir(
     io: Io,
     gpa: std.mem.Allocator,
     arena_impl: *std.heap.ArenaAllocator,
+    report: *Report,
     path: []const u8,
-    any_error: *bool,
-    syntax_only: bool,
+    filter: Filter,
+    parse_options: ParseOptions,
 ) !void {
-    var dir = try Io.Dir.cwd().openDir(io, path, .{ .iterate = true });
-    defer dir.close(io);
-    var walker = dir.walk(gpa) catch oom();
-    defer walker.deinit();
+    var walker = try filter.walk(io, gpa, path);
+    defer walker.deinit(io);
     while (try walker.next(io)) |item| {
-        switch (item.kind) {
-            .file => {
-                try checkFile(
-                    io,
-                    arena_impl,
-                    item.dir,
-                    item.basename,
-                    item.path,
-                    any_error,
-                    syntax_only,
-                );
-            },
-            else => {},
-        }
+        // Report paths relative to the directory argument so that they can
+        // be correlated with the command line.
+        const full_path = try std.fs.path.join(
+            report.arena,
+            &.{ path, item.path },
+        );
+        try checkFile(
+            io,
+            arena_impl,
+            report,
+            item.dir,
+            item.basename,
+            full_path,
+            filter,
+            parse_options,
+        );
     }
 }
 
 fn checkFile(
     io: Io,
     arena_impl: *std.heap.ArenaAllocator,
+    report: *Report,
     base_dir: Io.Dir,
     sub_path: []const u8,
     full_path: []const u8,
-    any_error: *bool,
-    syntax_only: bool,
+    filter: Filter,
+    parse_options: ParseOptions,
 ) !void {
-    _ = any_error;
     defer _ = arena_impl.reset(.retain_capacity);
     const arena = arena_impl.allocator();
 
+    // Unknown file, skip it
+    const language = filter.language(sub_path) orelse return;
+
     const in_bytes = try base_dir.readFileAllocOptions(
         io,
         sub_path,
@@ -124,73 +297,272 @@ fn checkFile(
         0,
     );
 
-    const file_type: FileType = blk: {
-        const ext = std.fs.path.extension(sub_path);
-        if (std.mem.eql(u8, ext, ".html") or
-            std.mem.eql(u8, ext, ".htm"))
-        {
-            break :blk .html;
+    try checkCode(
+        io,
+        arena,
+        report,
+        full_path,
+        in_bytes,
+        language,
+        parse_options,
+    );
+}
+
+pub fn checkCode(
+    io: Io,
+    arena: std.mem.Allocator,
+    report: *Report,
+    path: ?[]const u8,
+    bytes: [:0]const u8,
+    language: super.Language,
+    parse_options: ParseOptions,
+) !void {
+    const code = encoding.toUtf8(arena, bytes) catch |err| switch (err) {
+        error.OutOfMemory => return error.OutOfMemory,
+        error.InvalidUtf16 => return report.addEncodingError(io, path),
+    };
+    const cfg = try report.config(io, path);
+    var templates: TemplateLoader = .{ .io = io, .path = path };
+    const result = try super.validate(arena, code, .{
+        .language = language,
+        .syntax_only = parse_options.syntax_only,
+        .fragment = parse_options.fragment or cfg.fragment,
+        .superhtml_validation = cfg.superhtml_validation,
+        .rules = cfg.rules,
+        .max_attributes = cfg.max_attributes,
+        .max_depth = cfg.max_depth,
+        .void_element_style = cfg.void_element_style,
+        .loader = templates.loader(),
+    });
+    defer result.deinit();
+    try report.addDiagnostics(io, result, code, .detect(bytes), path);
+}
+
+/// Modification time of a file, as reported by stat.
+const Mtime = @FieldType(Io.File.Stat, "mtime");
+
+const Watched = struct {
+    mtime: Mtime,
+    /// Diagnostics printed by the last check of the file.
+    output: []const u8,
+    any_error: bool,
+};
+
+/// Checks all paths, then polls them for changes and re-checks the files
+/// that were modified or created, reprinting all diagnostics each time.
+fn watch(io: Io, gpa: Allocator, cmd: Command) !noreturn {
+    const paths = cmd.mode.paths;
+
+    // Files and their diagnostics, allocated in state_arena which gets
+    // replaced every time that something changes.
+    var state_arena = std.heap.ArenaAllocator.init(gpa);
+    var files: std.StringArrayHashMapUnmanaged(Watched) = .empty;
+
+    var scan_arena = std.heap.ArenaAllocator.init(gpa);
+    // checkFile will reset the arena at the end of each call
+    var check_arena = std.heap.ArenaAllocator.init(gpa);
+    var aw: Io.Writer.Allocating = .init(gpa);
+
+    var first = true;
+    while (true) : (first = false) {
+        _ = scan_arena.reset(.retain_capacity);
+        var snapshot = try scanPaths(io, gpa, scan_arena.allocator(), paths, cmd.filter);
+
+        if (!first) {
+            if (!changed(files, snapshot)) {
+                io.sleep(.fromMilliseconds(cmd.watch_interval), .awake) catch {};
+                continue;
+            }
+
+            // Editors often write a file in multiple steps when saving,
+            // wait for things to settle down before checking again.
+            io.sleep(.fromMilliseconds(debounce_ms), .awake) catch {};
+            _ = scan_arena.reset(.retain_capacity);
+            snapshot = try scanPaths(io, gpa, scan_arena.allocator(), paths, cmd.filter);
         }
 
-        if (std.mem.eql(u8, ext, ".shtml")) {
-            break :blk .super;
+        var new_arena = std.heap.ArenaAllocator.init(gpa);
+        const arena = new_arena.allocator();
+        var new_files: std.StringArrayHashMapUnmanaged(Watched) = .empty;
+        try new_files.ensureTotalCapacity(arena, snapshot.count());
+
+        // Configs are loaded again on every change so that edits to
+        // them are picked up by files checked from now on.
+        var report: Report = .{
+            .format = .text,
+            .arena = arena,
+            .out = &aw.writer,
+        };
+
+        for (snapshot.keys(), snapshot.values()) |path, mtime| {
+            if (files.get(path)) |old| {
+                if (std.meta.eql(old.mtime, mtime)) {
+                    new_files.putAssumeCapacity(try arena.dupe(u8, path), .{
+                        .mtime = mtime,
+                        .output = try arena.dupe(u8, old.output),
+                        .any_error = old.any_error,
+                    });
+                    continue;
+                }
+            }
+
+            aw.clearRetainingCapacity();
+            report.any_error = false;
+            checkFile(
+                io,
+                &check_arena,
+                &report,
+                Io.Dir.cwd(),
+                path,
+                path,
+                cmd.filter,
+                cmd.parse_options,
+            ) catch |err| {
+                try aw.writer.print("Error while accessing '{s}': {t}\n", .{
+                    path, err,
+                });
+                report.any_error = true;
+            };
+
+            new_files.putAssumeCapacity(try arena.dupe(u8, path), .{
+                .mtime = mtime,
+                .output = try arena.dupe(u8, aw.written()),
+                .any_error = report.any_error,
+            });
         }
-        return;
-    };
 
-    switch (file_type) {
-        .html => try checkHtml(
-            io,
-            arena,
-            full_path,
-            in_bytes,
-            syntax_only,
-        ),
-        .super => try checkSuper(
-            io,
-            arena,
-            full_path,
-            in_bytes,
-            syntax_only,
-        ),
+        state_arena.deinit();
+        state_arena = new_arena;
+        files = new_files;
+
+        try printWatched(io, files);
     }
 }
 
-pub fn checkHtml(
+const debounce_ms = 100;
+
+/// Returns the modification time of all the files that would be checked
+/// in `paths`.
+fn scanPaths(
     io: Io,
-    arena: std.mem.Allocator,
-    path: ?[]const u8,
-    code: [:0]const u8,
-    syntax_only: bool,
-) !void {
-    const ast = try super.html.Ast.init(arena, code, .html, syntax_only);
-    if (ast.errors.len > 0) {
-        var stderr = Io.File.stderr().writer(io, &.{});
-        try ast.printErrors(code, path, &stderr.interface);
-        std.process.exit(1);
+    gpa: Allocator,
+    arena: Allocator,
+    paths: []const []const u8,
+    filter: Filter,
+) !std.StringArrayHashMapUnmanaged(Mtime) {
+    var snapshot: std.StringArrayHashMapUnmanaged(Mtime) = .empty;
+    for (paths) |path| {
+        const stat = Io.Dir.cwd().statFile(io, path, .{}) catch |err| switch (err) {
+            // Deleted since the last scan.
+            error.FileNotFound => continue,
+            else => return err,
+        };
+
+        if (stat.kind != .directory) {
+            if (filter.language(path) != null) {
+                try snapshot.put(arena, path, stat.mtime);
+            }
+            continue;
+        }
+
+        var walker = try filter.walk(io, gpa, path);
+        defer walker.deinit(io);
+        while (try walker.next(io)) |item| {
+            const file_stat = item.dir.statFile(io, item.basename, .{}) catch |err| switch (err) {
+                error.FileNotFound => continue,
+                else => return err,
+            };
+            const full_path = try std.fs.path.join(arena, &.{ path, item.path });
+            try snapshot.put(arena, full_path, file_stat.mtime);
+        }
     }
+    return snapshot;
 }
 
-fn checkSuper(
-    io: Io,
-    arena: std.mem.Allocator,
-    path: ?[]const u8,
-    code: [:0]const u8,
-    syntax_only: bool,
-) !void {
-    const html = try super.html.Ast.init(arena, code, .superhtml, syntax_only);
-    if (html.errors.len > 0) {
-        var stderr = Io.File.stderr().writer(io, &.{});
-        try html.printErrors(code, path, &stderr.interface);
-        std.process.exit(1);
+/// Returns true if files were created, deleted or modified.
+fn changed(
+    files: std.StringArrayHashMapUnmanaged(Watched),
+    snapshot: std.StringArrayHashMapUnmanaged(Mtime),
+) bool {
+    if (files.count() != snapshot.count()) return true;
+    for (snapshot.keys(), snapshot.values()) |path, mtime| {
+        const old = files.get(path) orelse return true;
+        if (!std.meta.eql(old.mtime, mtime)) return true;
     }
+    return false;
+}
 
-    const s = try super.Ast.init(arena, html, code);
-    if (s.errors.len > 0) {
-        var stderr = Io.File.stderr().writer(io, &.{});
-        try s.printErrors(code, path, &stderr.interface);
-        std.process.exit(1);
+fn printWatched(io: Io, files: std.StringArrayHashMapUnmanaged(Watched)) !void {
+    var buf: [4096]u8 = undefined;
+    var stderr_writer = Io.File.stderr().writerStreaming(io, &buf);
+    const stderr = &stderr_writer.interface;
+
+    // Clear the screen and move the cursor to the top left corner.
+    try stderr.writeAll("\x1b[2J\x1b[H");
+
+    var failed: usize = 0;
+    for (files.values()) |f| {
+        try stderr.writeAll(f.output);
+        if (f.any_error) failed += 1;
     }
+
+    try stderr.print("\nChecked {d} file(s), {d} with errors. Watching for changes...\n", .{
+        files.count(),
+        failed,
+    });
+    try stderr.flush();
+}
+
+fn printConfig(
+    io: Io,
+    gpa: Allocator,
+    mode: Command.Mode,
+    stdin_filename: ?[]const u8,
+) noreturn {
+    var arena_impl = std.heap.ArenaAllocator.init(gpa);
+    const arena = arena_impl.allocator();
+
+    var buf: [4096]u8 = undefined;
+    var stdout_writer = Io.File.stdout().writerStreaming(io, &buf);
+    const stdout = &stdout_writer.interface;
+
+    const stdin_path: [1][]const u8 = .{stdin_filename orelse "<stdin>"};
+    const paths: []const []const u8 = switch (mode) {
+        .stdin, .stdin_super => &stdin_path,
+        .paths => |paths| paths,
+    };
+
+    // One object keyed by path, so that the output stays valid JSON when
+    // more than one path is given.
+    var js: std.json.Stringify = .{
+        .writer = stdout,
+        .options = .{ .whitespace = .indent_2 },
+    };
+    js.beginObject() catch {};
+    for (paths) |path| {
+        const dir_path = switch (mode) {
+            .stdin, .stdin_super => if (stdin_filename) |p|
+                std.fs.path.dirname(p) orelse "."
+            else
+                ".",
+            .paths => path,
+        };
+        var diag: []const u8 = "";
+        const cfg = Config.load(io, arena, dir_path, &diag) catch |err| switch (err) {
+            error.OutOfMemory => oom(),
+            error.InvalidConfig => {
+                std.debug.print("{s}\n", .{diag});
+                std.process.exit(1);
+            },
+        };
+        js.objectField(path) catch {};
+        cfg.write(&js) catch {};
+    }
+    js.endObject() catch {};
+    stdout.writeByte('\n') catch {};
+
+    stdout.flush() catch {};
+    std.process.exit(0);
 }
 
 fn oom() noreturn {
@@ -198,9 +570,24 @@ fn oom() noreturn {
     std.process.exit(1);
 }
 
+/// How documents are parsed and validated, also used by `fmt`.
+pub const ParseOptions = struct {
+    syntax_only: bool,
+    /// Validate all documents as fragments.
+    fragment: bool,
+};
+
 const Command = struct {
     mode: Mode,
-    syntax_only: bool,
+    parse_options: ParseOptions,
+    format: Format,
+    print_config: bool,
+    /// Path of the document read from stdin, if provided.
+    stdin_filename: ?[]const u8,
+    filter: Filter,
+    watch: bool,
+    /// Milliseconds between polls for changes in watch mode.
+    watch_interval: u32,
 
     const Mode = union(enum) {
         stdin,
@@ -208,9 +595,15 @@ const Command = struct {
         paths: []const []const u8,
     };
 
-    fn parse(args: []const []const u8) Command {
+    fn parse(gpa: Allocator, args: []const []const u8) Command {
         var mode: ?Mode = null;
         var syntax_only: ?bool = null;
+        var fragment = false;
+        var format: ?Format = null;
+        var print_config = false;
+        var flags: Filter.Flags = .{};
+        var watch_mode = false;
+        var watch_interval: u32 = 500;
 
         var idx: usize = 0;
         while (idx < args.len) : (idx += 1) {
@@ -226,6 +619,49 @@ const Command = struct {
                 continue;
             }
 
+            if (std.mem.eql(u8, arg, "--fragment")) {
+                fragment = true;
+                continue;
+            }
+
+            if (std.mem.eql(u8, arg, "--print-config")) {
+                print_config = true;
+                continue;
+            }
+
+            if (std.mem.eql(u8, arg, "--watch")) {
+                watch_mode = true;
+                continue;
+            }
+
+            if (std.mem.eql(u8, arg, "--watch-interval")) {
+                idx += 1;
+                if (idx == args.len) {
+                    std.debug.print("missing value for '--watch-interval'\n", .{});
+                    std.process.exit(1);
+                }
+                watch_interval = std.fmt.parseInt(u32, args[idx], 10) catch {
+                    std.debug.print("invalid interval: '{s}'\n", .{args[idx]});
+                    std.process.exit(1);
+                };
+                continue;
+            }
+
+            if (flags.parse(gpa, args, &idx) catch oom()) continue;
+
+            if (std.mem.eql(u8, arg, "--format")) {
+                idx += 1;
+                if (idx == args.len) {
+                    std.debug.print("missing value for '--format'\n", .{});
+                    std.process.exit(1);
+                }
+                format = std.meta.stringToEnum(Format, args[idx]) orelse {
+                    std.debug.print("unknown format: '{s}'\n", .{args[idx]});
+                    std.process.exit(1);
+                };
+                continue;
+            }
+
             if (std.mem.startsWith(u8, arg, "-")) {
                 if (std.mem.eql(u8, arg, "--stdin") or
                     std.mem.eql(u8, arg, "-"))
@@ -269,14 +705,43 @@ const Command = struct {
             }
         }
 
-        const m = mode orelse {
+        var m = mode orelse if (flags.stdin_filename != null)
+            Mode{ .stdin = {} }
+        else if (print_config)
+            Mode{ .paths = &.{"."} }
+        else {
             std.debug.print("missing argument(s)\n\n", .{});
             fatalHelp();
         };
 
+        if (flags.stdinLanguage(m != .paths)) |language| m = switch (language) {
+            .html, .xml => .stdin,
+            .superhtml => .stdin_super,
+        };
+
+        if (watch_mode) {
+            if (m != .paths) {
+                std.debug.print("'--watch' requires path argument(s)\n", .{});
+                std.process.exit(1);
+            }
+            if ((format orelse .text) == .json) {
+                std.debug.print("'--watch' only supports the text format\n", .{});
+                std.process.exit(1);
+            }
+        }
+
         return .{
+            .stdin_filename = flags.stdin_filename,
             .mode = m,
-            .syntax_only = syntax_only orelse false,
+            .parse_options = .{
+                .syntax_only = syntax_only orelse false,
+                .fragment = fragment,
+            },
+            .format = format orelse .text,
+            .print_config = print_config,
+            .filter = flags.filter(),
+            .watch = watch_mode,
+            .watch_interval = watch_interval,
         };
     }
 
@@ -286,19 +751,85 @@ const Command = struct {
             \\
             \\   Checks documents for errors. If PATH is a directory, it will
             \\   be searched recursively for HTML and SuperHTML files.
+            \\   Symlinks found while searching are not followed.
             \\   If any syntax or validation error is found, the program will
             \\   exit with a non-zero exit code.
             \\     
-            \\   Detected extensions:     
+            \\   Detected extensions (see --ext):     
             \\        HTML          .html, .htm 
             \\        SuperHTML     .shtml 
             \\
+            \\   Validation rules can be configured by a `.superhtml.json` file,
+            \\   searched for starting from the directory of each checked file:
+            \\
+            \\        {{ "rules": {{ "nesting": "off", "duplicate-id": "warn" }} }}
+            \\
+            \\   Each rule can be set to "error", "warn", "info" or "off". Only
+            \\   diagnostics from rules set to "error" cause a non-zero exit
+            \\   code.
+            \\
+            \\   Rules: doctype, unknown-element, unknown-attribute, attribute,
+            \\          required-attribute, duplicate-attribute, duplicate-class,
+            \\          duplicate-id, nesting, self-closing, obsolete-element,
+            \\          img-alt, label-for, heading-order (off by default),
+            \\          unused-suppression (info by default), input-type,
+            \\          charset, link-name,
+            \\          tag-case (off by default), name-case (off by default),
+            \\          dimensions (off by default), id-reference,
+            \\          max-attributes, max-depth.
+            \\
+            \\   max-attributes and max-depth only report elements past the
+            \\   limits set by "max-attributes" and "max-depth" (no limit by
+            \\   default), e.g. {{ "max-depth": 32 }}.
+            \\
+            \\   A `<!-- superhtml-disable-next-line [CODE...] -->` comment
+            \\   silences diagnostics in the start tag of the next element,
+            \\   `<!-- superhtml-disable-line [CODE...] -->` silences them on
+            \\   its own line. Without codes, all diagnostics are silenced.
+            \\   Errors in SuperHTML template logic (superhtml.* codes) can't
+            \\   be silenced.
+            \\
+            \\   SuperHTML templates are validated like HTML files, set
+            \\   "superhtml-validation" to false to only check their syntax.
+            \\
             \\Options:
             \\
             \\   --stdin          Validate a HTML document coming from stdin.
             \\                    Mutually exclusive with other input arguments.
             \\   --stdin-super    Same as --stdin but for SuperHTML files.
+            \\   --stdin-filename PATH
+            \\                    Path of the document read from stdin, implies
+            \\                    --stdin. Its extension selects the language
+            \\                    and its directory the config file.
+            \\   --ext EXT[,EXT...]
+            \\                    Extensions of the files to check, .shtml
+            \\                    files are SuperHTML and all others HTML.
+            \\                    Defaults to .html,.htm,.shtml.
+            \\   --exclude GLOB   Skip files matching GLOB when searching a
+            \\                    directory, can be repeated. Globs without a
+            \\                    slash match any path component (e.g.
+            \\                    node_modules), others match the path
+            \\                    relative to the searched directory (e.g.
+            \\                    build/out). `*` and `?` don't match slashes,
+            \\                    `**` does.
             \\   --syntax-only    Disable HTML element and attribute validation.
+            \\   --fragment       Validate documents as partials, even if they
+            \\                    have a top-level <html> or <!DOCTYPE>.
+            \\                    Documents without either are always
+            \\                    validated as partials. Can also be set with
+            \\                    "fragment" in the config.
+            \\   --format FORMAT  Output format for diagnostics, one of:
+            \\                      text  Human readable (default), to stderr.
+            \\                      json  A JSON array of diagnostics, to stdout.
+            \\                            Lines and columns are 1-based.
+            \\   --print-config   Print the configuration that applies to each
+            \\                    PATH (or to stdin) as a JSON object keyed by
+            \\                    path and exit.
+            \\   --watch          After checking all PATHs, keep polling them for
+            \\                    changes. Modified and new files are checked
+            \\                    again and all diagnostics are reprinted.
+            \\   --watch-interval MS
+            \\                    Milliseconds between polls, defaults to 500.
             \\   --help, -h       Print this help and exit.
             \\
         , .{});
@@ -306,3 +837,43 @@ const Command = struct {
         std.process.exit(1);
     }
 };
+
+test "warnings don't fail the check" {
+    var arena_impl = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    const head = "<!DOCTYPE html>\n<html>\n  <head><meta charset=\"utf-8\"><title>Test</title></head>\n  <body>\n    ";
+    const tail = "\n  </body>\n</html>\n";
+    const parse_options: ParseOptions = .{ .syntax_only = false, .fragment = false };
+
+    // Source, code and severity of its only diagnostic. Rules that were
+    // errors before they could be configured still are.
+    const Severity = super.html.Ast.Error.Severity;
+    const cases = [_]struct { [:0]const u8, []const u8, Severity }{
+        .{
+            "<!DOCTYPE html>\n<html>\n  <head><title>Test</title></head>\n  <body></body>\n</html>\n",
+            "html.meta.missing-charset",
+            .warning,
+        },
+        .{ head ++ "<img src=\"a.png\">" ++ tail, "html.attr.missing-alt", .warning },
+        .{ head ++ "<a href=\"/\"></a>" ++ tail, "html.link.missing-name", .warning },
+        .{ head ++ "<input aria-describedby=\"hint\">" ++ tail, "html.attr.id-not-found", .warning },
+        .{ head ++ "<label for=\"missing\">Missing</label>" ++ tail, "html.label.for-not-found", .warning },
+        .{ head ++ "<input min=\"1\">" ++ tail, "html.attr.input-type-mismatch", .warning },
+        .{ head ++ "<span class=\"a a\"></span>" ++ tail, "html.attr.duplicate-class", .@"error" },
+    };
+
+    for (cases) |case| {
+        var report: Report = .{ .format = .json, .arena = arena };
+        // No config file applies to stdin.
+        try report.configs.put(arena, ".", .{});
+
+        try checkCode(undefined, arena, &report, null, case[0], .html, parse_options);
+        try std.testing.expectEqual(1, report.diagnostics.items.len);
+        const d = report.diagnostics.items[0];
+        try std.testing.expectEqualStrings(case[1], d.code);
+        try std.testing.expectEqual(case[2], d.severity);
+        try std.testing.expectEqual(case[2] == .@"error", report.any_error);
+    }
+}
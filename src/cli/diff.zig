@@ -0,0 +1,241 @@
+const std = @import("std");
+const Allocator = std.mem.Allocator;
+const Writer = std.Io.Writer;
+
+/// Lines of unchanged context printed around each change.
+const context = 3;
+
+const Op = struct {
+    kind: enum { eql, del, ins },
+    // Index of the line in `a` (for eql and del) or of the line in `a` that
+    // follows the insertion point (for ins).
+    a_idx: u32,
+    // Same as above, but for `b`.
+    b_idx: u32,
+};
+
+/// Writes a unified diff that turns `a` into `b`. Writes nothing if the two
+/// inputs are identical.
+pub fn unified(
+    arena: Allocator,
+    w: *Writer,
+    path: []const u8,
+    a: []const u8,
+    b: []const u8,
+) !void {
+    if (std.mem.eql(u8, a, b)) return;
+
+    const a_lines = try splitLines(arena, a);
+    const b_lines = try splitLines(arena, b);
+    const ops = try myers(arena, a_lines, b_lines);
+
+    try w.print("--- a/{s}\n+++ b/{s}\n", .{ path, path });
+
+    var idx: usize = 0;
+    while (nextChange(ops, idx)) |first_change| {
+        const start = first_change -| context;
+
+        // Extend the hunk as long as the next change is close enough that
+        // the context of the two would overlap.
+        var last_change = first_change;
+        var end = @min(ops.len, last_change + 1 + context);
+        while (nextChange(ops, last_change + 1)) |change| {
+            if (change > end + context) break;
+            last_change = change;
+            end = @min(ops.len, last_change + 1 + context);
+        }
+
+        var a_len: u32 = 0;
+        var b_len: u32 = 0;
+        for (ops[start..end]) |op| switch (op.kind) {
+            .eql => {
+                a_len += 1;
+                b_len += 1;
+            },
+            .del => a_len += 1,
+            .ins => b_len += 1,
+        };
+
+        const a_start = ops[start].a_idx + @intFromBool(a_len > 0);
+        const b_start = ops[start].b_idx + @intFromBool(b_len > 0);
+        try w.print("@@ -{},{} +{},{} @@\n", .{ a_start, a_len, b_start, b_len });
+
+        for (ops[start..end]) |op| switch (op.kind) {
+            .eql => try printLine(w, ' ', a_lines[op.a_idx]),
+            .del => try printLine(w, '-', a_lines[op.a_idx]),
+            .ins => try printLine(w, '+', b_lines[op.b_idx]),
+        };
+
+        idx = end;
+    }
+}
+
+fn printLine(w: *Writer, prefix: u8, line: []const u8) !void {
+    try w.print("{c}{s}", .{ prefix, line });
+    if (!std.mem.endsWith(u8, line, "\n")) {
+        try w.writeAll("\n\\ No newline at end of file\n");
+    }
+}
+
+fn nextChange(ops: []const Op, start: usize) ?usize {
+    for (ops[@min(start, ops.len)..], start..) |op, idx| {
+        if (op.kind != .eql) return idx;
+    }
+    return null;
+}
+
+/// Lines keep their terminating newline, so that a last line without one
+/// differs from the same line with one.
+fn splitLines(arena: Allocator, src: []const u8) ![]const []const u8 {
+    var lines: std.ArrayList([]const u8) = .empty;
+    var start: usize = 0;
+    while (start < src.len) {
+        const end = if (std.mem.indexOfScalarPos(u8, src, start, '\n')) |nl|
+            nl + 1
+        else
+            src.len;
+        try lines.append(arena, src[start..end]);
+        start = end;
+    }
+    return lines.items;
+}
+
+/// Computes the shortest edit script between `a` and `b` using the
+/// algorithm described in "An O(ND) Difference Algorithm and Its
+/// Variations" by Eugene W. Myers.
+fn myers(
+    arena: Allocator,
+    a: []const []const u8,
+    b: []const []const u8,
+) ![]const Op {
+    const n: isize = @intCast(a.len);
+    const m: isize = @intCast(b.len);
+    const max: usize = a.len + b.len;
+    const offset: isize = @intCast(max + 1);
+
+    // Furthest reaching x for each diagonal k, indexed by k + offset.
+    const v = try arena.alloc(isize, 2 * max + 3);
+    @memset(v, 0);
+
+    // A copy of v for each value of d, used to backtrack.
+    var trace: std.ArrayList([]const isize) = .empty;
+
+    outer: for (0..max + 1) |d_usize| {
+        const d: isize = @intCast(d_usize);
+        try trace.append(arena, try arena.dupe(isize, v));
+
+        var k: isize = -d;
+        while (k <= d) : (k += 2) {
+            const kidx: usize = @intCast(k + offset);
+            var x: isize = if (k == -d or (k != d and v[kidx - 1] < v[kidx + 1]))
+                v[kidx + 1]
+            else
+                v[kidx - 1] + 1;
+            var y = x - k;
+
+            while (x < n and y < m and
+                std.mem.eql(u8, a[@intCast(x)], b[@intCast(y)])) : ({
+                x += 1;
+                y += 1;
+            }) {}
+
+            v[kidx] = x;
+            if (x >= n and y >= m) break :outer;
+        }
+    }
+
+    // Backtrack from the end to the start, collecting ops in reverse.
+    var ops: std.ArrayList(Op) = .empty;
+    var x = n;
+    var y = m;
+    var d: isize = @intCast(trace.items.len - 1);
+    while (d >= 0) : (d -= 1) {
+        const tv = trace.items[@intCast(d)];
+        const k = x - y;
+        const kidx: usize = @intCast(k + offset);
+
+        const prev_k = if (k == -d or (k != d and tv[kidx - 1] < tv[kidx + 1]))
+            k + 1
+        else
+            k - 1;
+        const prev_x = if (d == 0) 0 else tv[@intCast(prev_k + offset)];
+        const prev_y = if (d == 0) 0 else prev_x - prev_k;
+
+        while (x > prev_x and y > prev_y) {
+            x -= 1;
+            y -= 1;
+            try ops.append(arena, .{
+                .kind = .eql,
+                .a_idx = @intCast(x),
+                .b_idx = @intCast(y),
+            });
+        }
+
+        if (d == 0) break;
+
+        if (x == prev_x) {
+            y -= 1;
+            try ops.append(arena, .{
+                .kind = .ins,
+                .a_idx = @intCast(x),
+                .b_idx = @intCast(y),
+            });
+        } else {
+            x -= 1;
+            try ops.append(arena, .{
+                .kind = .del,
+                .a_idx = @intCast(x),
+                .b_idx = @intCast(y),
+            });
+        }
+    }
+
+    std.mem.reverse(Op, ops.items);
+    return ops.items;
+}
+
+fn expectDiff(a: []const u8, b: []const u8, expected: []const u8) !void {
+    var arena_impl = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    var aw: Writer.Allocating = .init(arena);
+    try unified(arena, &aw.writer, "foo.html", a, b);
+    try std.testing.expectEqualStrings(expected, aw.written());
+}
+
+test "unified" {
+    try expectDiff("<p></p>\n", "<p></p>\n", "");
+    try expectDiff(
+        \\<div>
+        \\<p></p>
+        \\</div>
+        \\
+    ,
+        \\<div>
+        \\  <p></p>
+        \\</div>
+        \\
+    ,
+        \\--- a/foo.html
+        \\+++ b/foo.html
+        \\@@ -1,3 +1,3 @@
+        \\ <div>
+        \\-<p></p>
+        \\+  <p></p>
+        \\ </div>
+        \\
+    );
+}
+
+test "unified: missing newline at end of file" {
+    try expectDiff("<p></p>", "<p></p>\n",
+        \\--- a/foo.html
+        \\+++ b/foo.html
+        \\@@ -1,1 +1,1 @@
+        \\-<p></p>
+        \\\ No newline at end of file
+        \\+<p></p>
+        \\
+    );
+}
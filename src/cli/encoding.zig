@@ -0,0 +1,72 @@
+//! Byte order mark detection for documents read by the CLI.
+//!
+//! The tokenizer only understands UTF-8: a UTF-8 BOM must be stripped before
+//! parsing (otherwise it ends up in the first text node and shifts columns)
+//! and UTF-16 documents must be decoded or rejected.
+
+const std = @import("std");
+
+pub const Bom = enum {
+    none,
+    utf8,
+    utf16le,
+    utf16be,
+
+    pub fn detect(bytes: []const u8) Bom {
+        if (std.mem.startsWith(u8, bytes, "\xEF\xBB\xBF")) return .utf8;
+        if (std.mem.startsWith(u8, bytes, "\xFF\xFE")) return .utf16le;
+        if (std.mem.startsWith(u8, bytes, "\xFE\xFF")) return .utf16be;
+        return .none;
+    }
+
+    /// Length in bytes of the byte order mark.
+    pub fn len(bom: Bom) usize {
+        return switch (bom) {
+            .none => 0,
+            .utf8 => 3,
+            .utf16le, .utf16be => 2,
+        };
+    }
+
+    pub fn isUtf16(bom: Bom) bool {
+        return bom == .utf16le or bom == .utf16be;
+    }
+
+    /// Converts an offset into `utf8`, the result of `toUtf8`, to a byte
+    /// offset into the original document.
+    pub fn fileOffset(bom: Bom, utf8: []const u8, offset: u32) u32 {
+        const len: u32 = @intCast(bom.len());
+        if (!bom.isUtf16()) return len + offset;
+        // Decoded documents are always valid UTF-8.
+        const units = std.unicode.calcUtf16LeLen(utf8[0..offset]) catch unreachable;
+        return len + @as(u32, @intCast(units)) * 2;
+    }
+};
+
+/// Returns the content of `bytes` as UTF-8 without byte order mark, decoding
+/// UTF-16 documents. Offsets of the result only match the ones in `bytes`
+/// for UTF-8 documents, once the length of the BOM is accounted for.
+pub fn toUtf8(
+    arena: std.mem.Allocator,
+    bytes: [:0]const u8,
+) error{ OutOfMemory, InvalidUtf16 }![:0]const u8 {
+    const bom: Bom = .detect(bytes);
+    const rest = bytes[bom.len()..];
+    const endian: std.builtin.Endian = switch (bom) {
+        .none, .utf8 => return rest,
+        .utf16le => .little,
+        .utf16be => .big,
+    };
+
+    if (rest.len % 2 != 0) return error.InvalidUtf16;
+    const units = try arena.alloc(u16, rest.len / 2);
+    for (units, 0..) |*unit, idx| {
+        const value = std.mem.readInt(u16, rest[idx * 2 ..][0..2], endian);
+        unit.* = std.mem.nativeToLittle(u16, value);
+    }
+
+    return std.unicode.utf16LeToUtf8AllocZ(arena, units) catch |err| switch (err) {
+        error.OutOfMemory => error.OutOfMemory,
+        else => error.InvalidUtf16,
+    };
+}
@@ -4,6 +4,11 @@ const Io = std.Io;
 const Allocator = std.mem.Allocator;
 const Writer = std.Io.Writer;
 const super = @import("superhtml");
+const diff = @import("diff.zig");
+const Config = @import("Config.zig");
+const Filter = @import("Filter.zig");
+const ParseOptions = @import("check.zig").ParseOptions;
+const encoding = @import("encoding.zig");
 
 var bufout: [4096]u8 = undefined;
 var buferr: [4096]u8 = undefined;
@@ -18,17 +23,47 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
     var stdout_writer = Io.File.stdout().writerStreaming(io, &bufout);
     const stdout = &stdout_writer.interface;
 
-    const cmd = Command.parse(args);
+    const cmd = Command.parse(gpa, args);
     switch (cmd.mode) {
         .stdin => |lang| {
+            var arena_impl = std.heap.ArenaAllocator.init(gpa);
+            defer arena_impl.deinit();
+            const arena = arena_impl.allocator();
+
             var fr = Io.File.stdin().reader(io, &.{});
-            var aw: Writer.Allocating = .init(gpa);
+            var aw: Writer.Allocating = .init(arena);
             _ = try fr.interface.streamRemaining(&aw.writer);
             const in_bytes = try aw.toOwnedSliceSentinel(0);
 
-            if (try fmt(gpa, stderr, null, in_bytes, lang, cmd.syntax_only)) |fmt_src| {
-                var writer = Io.File.stdout().writer(io, &.{});
-                try writer.interface.writeAll(fmt_src);
+            // The filename hint determines which config applies and is
+            // used in diagnostics.
+            const cfg = loadConfig(io, arena, cmd.stdin_filename);
+            if (try fmt(
+                arena,
+                stderr,
+                cmd.stdin_filename,
+                in_bytes,
+                lang,
+                cmd.parse_options,
+                cfg,
+            )) |fmt_src| {
+                if (cmd.check) {
+                    // Only report through the exit code, unless a diff was
+                    // requested.
+                    if (!std.mem.eql(u8, fmt_src, in_bytes)) syntax_errors = true;
+                    if (cmd.diff) try diff.unified(
+                        arena,
+                        stdout,
+                        cmd.stdin_filename orelse "<stdin>",
+                        in_bytes,
+                        fmt_src,
+                    );
+                } else {
+                    var writer = Io.File.stdout().writer(io, &.{});
+                    try writer.interface.writeAll(fmt_src);
+                }
+            } else if (cmd.check) {
+                syntax_errors = true;
             }
         },
         .paths => |paths| {
@@ -41,10 +76,12 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
                     stdout,
                     stderr,
                     cmd.check,
+                    cmd.diff,
                     Io.Dir.cwd(),
                     path,
                     path,
-                    cmd.syntax_only,
+                    cmd.filter,
+                    cmd.parse_options,
                 ) catch |err| switch (err) {
                     error.IsDir, error.AccessDenied => formatDir(
                         io,
@@ -53,8 +90,10 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
                         stdout,
                         stderr,
                         cmd.check,
+                        cmd.diff,
                         path,
-                        cmd.syntax_only,
+                        cmd.filter,
+                        cmd.parse_options,
                     ) catch |dir_err| {
                         std.debug.print("error walking dir '{s}': {s}\n", .{
                             path,
@@ -85,30 +124,35 @@ fn formatDir(
     stdout: *Writer,
     stderr: *Writer,
     check: bool,
+    show_diff: bool,
     path: []const u8,
-    syntax_only: bool,
+    filter: Filter,
+    parse_options: ParseOptions,
 ) !void {
-    var dir = try Io.Dir.cwd().openDir(io, path, .{ .iterate = true });
-    defer dir.close(io);
-
-    var walker = dir.walk(gpa) catch oom();
-    defer walker.deinit();
+    var walker = try filter.walk(io, gpa, path);
+    defer walker.deinit(io);
 
     while (try walker.next(io)) |item| {
-        switch (item.kind) {
-            .file => try formatFile(
-                io,
-                arena_impl,
-                stdout,
-                stderr,
-                check,
-                item.dir,
-                item.basename,
-                item.path,
-                syntax_only,
-            ),
-            else => {},
-        }
+        // Report paths relative to the directory argument so that they can
+        // be correlated with the command line.
+        // The arena is reset by formatFile once it's done with it.
+        const full_path = try std.fs.path.join(
+            arena_impl.allocator(),
+            &.{ path, item.path },
+        );
+        try formatFile(
+            io,
+            arena_impl,
+            stdout,
+            stderr,
+            check,
+            show_diff,
+            item.dir,
+            item.basename,
+            full_path,
+            filter,
+            parse_options,
+        );
     }
 }
 
@@ -118,14 +162,19 @@ fn formatFile(
     stdout: *Writer,
     stderr: *Writer,
     check: bool,
+    show_diff: bool,
     base_dir: Io.Dir,
     sub_path: []const u8,
     full_path: []const u8,
-    syntax_only: bool,
+    filter: Filter,
+    parse_options: ParseOptions,
 ) !void {
     defer _ = arena_impl.reset(.retain_capacity);
     const arena = arena_impl.allocator();
 
+    // Unkown file, skip it
+    const language = filter.language(sub_path) orelse return;
+
     const in_bytes = try base_dir.readFileAllocOptions(
         io,
         sub_path,
@@ -135,27 +184,24 @@ fn formatFile(
         0,
     );
 
-    const language: super.Language = blk: {
-        const ext = std.fs.path.extension(sub_path);
-        if (std.mem.eql(u8, ext, ".html") or
-            std.mem.eql(u8, ext, ".htm"))
-        {
-            break :blk .html;
-        }
-
-        if (std.mem.eql(u8, ext, ".shtml")) {
-            break :blk .superhtml;
-        }
-
-        // Unkown file, skip it
-        return;
-    };
-
-    if (try fmt(arena, stderr, full_path, in_bytes, language, syntax_only)) |fmt_src| {
+    const cfg = loadConfig(io, arena, full_path);
+    if (try fmt(
+        arena,
+        stderr,
+        full_path,
+        in_bytes,
+        language,
+        parse_options,
+        cfg,
+    )) |fmt_src| {
         if (std.mem.eql(u8, fmt_src, in_bytes)) return;
         if (check) {
             syntax_errors = true;
-            try stdout.print("{s}\n", .{full_path});
+            if (show_diff) {
+                try diff.unified(arena, stdout, full_path, in_bytes, fmt_src);
+            } else {
+                try stdout.print("{s}\n", .{full_path});
+            }
             return;
         }
 
@@ -179,27 +225,61 @@ pub fn fmt(
     path: ?[]const u8,
     src: [:0]const u8,
     language: super.Language,
-    syntax_only: bool,
+    parse_options: ParseOptions,
+    cfg: Config,
 ) !?[]const u8 {
-    const html_ast = try super.html.Ast.init(arena, src, language, syntax_only);
-    if (html_ast.errors.len > 0) {
-        try html_ast.printErrors(src, path, stderr);
-        if (html_ast.has_syntax_errors) {
-            syntax_errors = true;
-            return null;
-        }
-    } else if (language == .superhtml) {
-        const super_ast = try super.Ast.init(arena, html_ast, src);
-        if (super_ast.errors.len > 0) {
-            try html_ast.printErrors(src, path, stderr);
-        }
+    // A UTF-8 byte order mark is kept in the output but must not reach the
+    // tokenizer. UTF-16 documents are not rewritten as UTF-8 behind the
+    // user's back.
+    const bom: encoding.Bom = .detect(src);
+    if (bom.isUtf16()) {
+        try stderr.print(
+            "{s}: UTF-16 documents are not supported, convert the file to UTF-8\n",
+            .{path orelse "<stdin>"},
+        );
+        syntax_errors = true;
+        return null;
+    }
+    const code = src[bom.len()..];
+
+    const result = try super.validate(arena, code, .{
+        .language = language,
+        .syntax_only = parse_options.syntax_only,
+        .fragment = parse_options.fragment or cfg.fragment,
+        .superhtml_validation = cfg.superhtml_validation,
+        .rules = cfg.rules,
+        .max_attributes = cfg.max_attributes,
+        .max_depth = cfg.max_depth,
+        .void_element_style = cfg.void_element_style,
+    });
+    defer result.deinit();
+
+    try result.print(code, path, stderr);
+    if (result.has_syntax_errors) {
+        syntax_errors = true;
+        return null;
     }
 
-    return try std.fmt.allocPrint(arena, "{f}", .{
-        html_ast.formatter(src),
+    return try std.fmt.allocPrint(arena, "{s}{f}", .{
+        src[0..bom.len()],
+        result.ast.formatterOptions(code, cfg.renderOptions()),
     });
 }
 
+/// Returns the config that applies to the file at `path`, stdin uses the
+/// config of the current working directory.
+fn loadConfig(io: Io, arena: Allocator, path: ?[]const u8) Config {
+    const dir_path = if (path) |p| std.fs.path.dirname(p) orelse "." else ".";
+    var diag: []const u8 = "";
+    return Config.load(io, arena, dir_path, &diag) catch |err| switch (err) {
+        error.OutOfMemory => oom(),
+        error.InvalidConfig => {
+            std.debug.print("{s}\n", .{diag});
+            std.process.exit(1);
+        },
+    };
+}
+
 fn oom() noreturn {
     std.debug.print("Out of memory\n", .{});
     std.process.exit(1);
@@ -207,18 +287,25 @@ fn oom() noreturn {
 
 const Command = struct {
     check: bool,
+    diff: bool,
     mode: Mode,
-    syntax_only: bool,
+    parse_options: ParseOptions,
+    /// Path of the document read from stdin, if provided.
+    stdin_filename: ?[]const u8,
+    filter: Filter,
 
     const Mode = union(enum) {
         stdin: super.Language,
         paths: []const []const u8,
     };
 
-    fn parse(args: []const []const u8) Command {
+    fn parse(gpa: Allocator, args: []const []const u8) Command {
         var check: bool = false;
+        var show_diff: bool = false;
         var mode: ?Mode = null;
         var syntax_only: ?bool = null;
+        var fragment = false;
+        var flags: Filter.Flags = .{};
 
         var idx: usize = 0;
         while (idx < args.len) : (idx += 1) {
@@ -234,11 +321,24 @@ const Command = struct {
                 continue;
             }
 
+            if (std.mem.eql(u8, arg, "--diff")) {
+                check = true;
+                show_diff = true;
+                continue;
+            }
+
             if (std.mem.eql(u8, arg, "--syntax-only")) {
                 syntax_only = true;
                 continue;
             }
 
+            if (std.mem.eql(u8, arg, "--fragment")) {
+                fragment = true;
+                continue;
+            }
+
+            if (flags.parse(gpa, args, &idx) catch oom()) continue;
+
             if (std.mem.startsWith(u8, arg, "-")) {
                 if (std.mem.eql(u8, arg, "--stdin") or
                     std.mem.eql(u8, arg, "-"))
@@ -282,15 +382,23 @@ const Command = struct {
             }
         }
 
-        const m = mode orelse {
+        var m = mode orelse if (flags.stdin_filename != null) Mode{ .stdin = .html } else {
             std.debug.print("missing argument(s)\n\n", .{});
             fatalHelp();
         };
 
+        if (flags.stdinLanguage(m == .stdin)) |language| m = .{ .stdin = language };
+
         return .{
             .check = check,
+            .diff = show_diff,
             .mode = m,
-            .syntax_only = syntax_only orelse false,
+            .parse_options = .{
+                .syntax_only = syntax_only orelse false,
+                .fragment = fragment,
+            },
+            .stdin_filename = flags.stdin_filename,
+            .filter = flags.filter(),
         };
     }
 
@@ -300,25 +408,74 @@ const Command = struct {
             \\
             \\   Formats input paths inplace. If PATH is a directory, it will
             \\   be searched recursively for HTML and SuperHTML files.
+            \\   Symlinks found while searching are not followed.
             \\   HTML errors will be printed to stderr but will only cause a
             \\   non-zero exit code if they prevent formatting (i.e. syntax
             \\   errors).
             \\     
-            \\   Detected extensions:     
+            \\   Detected extensions (see --ext):     
             \\        HTML          .html, .htm 
             \\        SuperHTML     .shtml 
             \\
+            \\   Formatting can be configured by a `.superhtml.json` file,
+            \\   searched for starting from the directory of each file:
+            \\
+            \\        {{ "attribute-order": "canonical" }}
+            \\
+            \\   "attribute-order" is either "preserve" (the default) or
+            \\   "canonical": id, class, other attributes alphabetically and
+            \\   event handlers last.
+            \\   "print-width" puts each attribute of start tags longer than
+            \\   the given number of columns on its own line.
+            \\   "boolean-attribute-style" is either "collapse" (the default),
+            \\   which renders boolean attributes as `disabled`, or "value",
+            \\   which renders them as `disabled="disabled"`.
+            \\   "indent-style" is either "tab" (the default) or "space",
+            \\   "indent-width" is the number of spaces per level (4 by
+            \\   default). Content that preserves whitespace, like <pre>, is
+            \\   never reindented.
+            \\   "blank-lines" is either "collapse" (the default), which
+            \\   collapses runs of blank lines into one, or "preserve-one",
+            \\   which also removes blank lines right after start tags.
+            \\
             \\Options:
             \\
             \\   --stdin          Format bytes from stdin and output to stdout.
             \\                    Mutually exclusive with other input arguments.
             \\   --stdin-super    Same as --stdin but for SuperHTML files.
+            \\   --stdin-filename PATH
+            \\                    Path of the document read from stdin, implies
+            \\                    --stdin. Its extension selects the language
+            \\                    and its directory the config file.
             \\   --check          List non-conforming files to stdout and exit 
             \\                    with an error if the list is not empty.
-            \\                    Does not modify files on disk.
+            \\                    Does not modify files on disk. When reading
+            \\                    from stdin, only the exit code is affected.
+            \\   --diff           Like --check, but print a unified diff of the
+            \\                    changes that formatting would apply.
+            \\   --ext EXT[,EXT...]
+            \\                    Extensions of the files to format, .shtml
+            \\                    files are SuperHTML and all others HTML.
+            \\                    Defaults to .html,.htm,.shtml.
+            \\   --exclude GLOB   Skip files matching GLOB when searching a
+            \\                    directory, can be repeated. Globs without a
+            \\                    slash match any path component (e.g.
+            \\                    node_modules), others match the path
+            \\                    relative to the searched directory (e.g.
+            \\                    build/out). `*` and `?` don't match slashes,
+            \\                    `**` does.
             \\   --syntax-only    Disable HTML element and attribute validation.
+            \\   --fragment       Validate documents as partials, even if they
+            \\                    have a top-level <html> or <!DOCTYPE>. Can
+            \\                    also be set with "fragment" in the config.
             \\   --help, -h       Prints this help and exits.
             \\
+            \\Exit code:
+            \\
+            \\   0 on success. 1 if a document has syntax errors (when reading
+            \\   from stdin nothing is written to stdout), if --check finds
+            \\   unformatted documents, or on invalid usage.
+            \\
         , .{});
 
         std.process.exit(1);
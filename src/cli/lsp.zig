@@ -10,6 +10,7 @@ const offsets = lsp.offsets;
 const super = @import("superhtml");
 const Document = @import("lsp/Document.zig");
 const logic = @import("lsp/logic.zig");
+const emmet = @import("lsp/emmet.zig");
 
 const log = std.log.scoped(.superhtml_lsp);
 
@@ -31,13 +32,20 @@ pub fn run(io: Io, gpa: Allocator, args: []const []const u8) !noreturn {
         .gpa = gpa,
         .transport = &stdio.transport,
         .syntax_only = cmd.syntax_only,
+        .fragment = cmd.fragment,
     };
     defer handler.deinit();
 
+    var idle: IdleTransport = .{
+        .inner = &stdio.transport,
+        .handler = &handler,
+        .stdin = Io.File.stdin(),
+    };
+
     try lsp.basic_server.run(
         io,
         gpa,
-        &stdio.transport,
+        &idle.transport,
         &handler,
         log.err,
     );
@@ -51,13 +59,131 @@ io: Io,
 gpa: std.mem.Allocator,
 transport: *lsp.Transport,
 files: std.StringHashMapUnmanaged(Document) = .{},
+/// Configs loaded by `logic.loadConfig`, keyed by directory.
+configs: std.StringHashMapUnmanaged(logic.CachedConfig) = .{},
+/// Templates loaded from disk by `logic.loadLayout`, keyed by path.
+layouts: std.StringHashMapUnmanaged(logic.CachedLayout) = .{},
 offset_encoding: offsets.Encoding = .@"utf-16",
 syntax_only: bool,
+/// Validate all documents as fragments.
+fragment: bool,
+
+/// Documents changed again within this many milliseconds of their last
+/// validation are validated once they are needed (see `document`) or once
+/// the client goes quiet (see `IdleTransport`).
+const debounce_ms = 150;
+
+/// Forwards to the transport of the client. Before waiting for the next
+/// message, it validates the documents postponed by `textDocument/didChange`
+/// as soon as their debounce window is over, unless a message arrives first,
+/// so that the last change of a burst always gets its diagnostics.
+const IdleTransport = struct {
+    transport: lsp.Transport = .{ .vtable = &vtable },
+    inner: *lsp.Transport,
+    handler: *Handler,
+    stdin: Io.File,
+
+    const vtable: lsp.Transport.VTable = .{
+        .readJsonMessage = readJsonMessage,
+        .writeJsonMessage = writeJsonMessage,
+    };
+
+    fn readJsonMessage(
+        transport: *lsp.Transport,
+        io: Io,
+        allocator: Allocator,
+    ) lsp.Transport.ReadError![]u8 {
+        const idle: *IdleTransport = @fieldParentPtr("transport", transport);
+        while (idle.handler.staleTimeout()) |timeout_ms| {
+            if (inputReady(idle.stdin, timeout_ms)) break;
+            idle.handler.validateStale();
+        }
+        return idle.inner.readJsonMessage(io, allocator);
+    }
+
+    fn writeJsonMessage(
+        transport: *lsp.Transport,
+        io: Io,
+        json_message: []const u8,
+    ) lsp.Transport.WriteError!void {
+        const idle: *IdleTransport = @fieldParentPtr("transport", transport);
+        return idle.inner.writeJsonMessage(io, json_message);
+    }
+
+    /// Waits up to `timeout_ms` for input. Windows doesn't support polling
+    /// pipes, so documents are validated right away there.
+    fn inputReady(stdin: Io.File, timeout_ms: u32) bool {
+        if (builtin.os.tag == .windows) return false;
+        var fds = [_]std.posix.pollfd{.{
+            .fd = stdin.handle,
+            .events = std.posix.POLL.IN,
+            .revents = 0,
+        }};
+        const ready = std.posix.poll(&fds, @intCast(timeout_ms)) catch return false;
+        return ready > 0;
+    }
+};
+
+/// Returns how many milliseconds are left before the first document
+/// postponed by `textDocument/didChange` is due, null if there is none.
+fn staleTimeout(self: *Handler) ?u32 {
+    var timeout: ?u32 = null;
+    var it = self.files.valueIterator();
+    while (it.next()) |doc| {
+        if (!doc.stale) continue;
+        const last = doc.validated_at orelse return 0;
+        const now = Io.Clock.awake.now(self.io) catch return 0;
+        const elapsed_ms = @divFloor(now.nanoseconds - last.nanoseconds, std.time.ns_per_ms);
+        const left: u32 = if (elapsed_ms >= debounce_ms) 0 else @intCast(debounce_ms - elapsed_ms);
+        timeout = @min(timeout orelse left, left);
+    }
+    return timeout;
+}
+
+/// Validates all documents postponed by `textDocument/didChange` and
+/// publishes their diagnostics.
+fn validateStale(self: *Handler) void {
+    var arena_impl: std.heap.ArenaAllocator = .init(self.gpa);
+    defer arena_impl.deinit();
+
+    var it = self.files.iterator();
+    while (it.next()) |entry| {
+        if (!entry.value_ptr.stale) continue;
+        _ = arena_impl.reset(.retain_capacity);
+        // Reloading a document doesn't add entries, so `it` stays valid.
+        _ = self.document(arena_impl.allocator(), entry.key_ptr.*) catch return;
+    }
+}
+
+/// Returns the open document at `uri`, validating it first when
+/// `textDocument/didChange` postponed it.
+fn document(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    uri: []const u8,
+) error{OutOfMemory}!?*Document {
+    const doc = self.files.getPtr(uri) orelse return null;
+    if (!doc.stale) return doc;
+
+    logic.loadFile(self, arena, doc.src, uri, doc.language) catch |err| switch (err) {
+        error.OutOfMemory => return error.OutOfMemory,
+        else => return null,
+    };
+    return self.files.getPtr(uri);
+}
 
 fn deinit(self: *Handler) void {
     var file_it = self.files.valueIterator();
     while (file_it.next()) |file| file.deinit(self.gpa);
     self.files.deinit(self.gpa);
+    logic.clearConfigs(self);
+    self.configs.deinit(self.gpa);
+    var layout_it = self.layouts.iterator();
+    while (layout_it.next()) |entry| {
+        self.gpa.free(entry.key_ptr.*);
+        entry.value_ptr.arena.deinit();
+    }
+    self.layouts.deinit(self.gpa);
     self.* = undefined;
 }
 
@@ -112,7 +238,7 @@ pub fn initialize(
         .textDocumentSync = .{
             .text_document_sync_options = .{
                 .openClose = true,
-                .change = .Full,
+                .change = .Incremental,
             },
         },
 
@@ -130,17 +256,35 @@ pub fn initialize(
 
         .referencesProvider = .{ .bool = true },
 
+        .definitionProvider = .{ .bool = true },
+
         .completionProvider = .{
             .triggerCharacters = &.{
                 "<",  "/", " ",
                 "\n", "'", "\"",
                 "=",  ",", "-",
+                ">",
             },
         },
 
         .hoverProvider = .{ .bool = true },
 
         .documentFormattingProvider = .{ .bool = true },
+        .documentRangeFormattingProvider = .{ .bool = true },
+
+        .foldingRangeProvider = .{ .bool = true },
+
+        .documentSymbolProvider = .{ .bool = true },
+
+        .semanticTokensProvider = .{
+            .semantic_tokens_options = .{
+                .legend = .{
+                    .tokenTypes = &SemanticToken.Kind.legend,
+                    .tokenModifiers = &.{},
+                },
+                .full = .{ .bool = true },
+            },
+        },
     };
 
     if (@import("builtin").mode == .Debug) {
@@ -178,6 +322,9 @@ pub fn @"textDocument/didOpen"(
         @panic("unrecognized language id, exiting");
     };
 
+    // A config file might have been created since the last time we looked.
+    logic.clearConfigs(self);
+
     try logic.loadFile(
         self,
         arena,
@@ -196,7 +343,7 @@ pub fn @"textDocument/didChange"(
         return;
     }
 
-    const file = self.files.get(notification.textDocument.uri) orelse {
+    const file = self.files.getPtr(notification.textDocument.uri) orelse {
         log.err("changeDocument failed: unknown file: {any}", .{notification.textDocument.uri});
 
         try self.windowNotification(
@@ -210,6 +357,8 @@ pub fn @"textDocument/didChange"(
     var buffer: std.ArrayListUnmanaged(u8) = .fromOwnedSlice(@constCast(file.src));
     errdefer buffer.deinit(self.gpa);
 
+    // Only a lone partial change can be applied to the existing tree.
+    var edit: ?struct { start: u32, end: u32, len: u32, newlines: bool } = null;
     for (notification.contentChanges) |content_change| {
         switch (content_change) {
             .text_document_content_change_whole_document => |change| {
@@ -218,15 +367,54 @@ pub fn @"textDocument/didChange"(
             },
             .text_document_content_change_partial => |change| {
                 const loc = offsets.rangeToLoc(buffer.items, change.range, self.offset_encoding);
+                if (notification.contentChanges.len == 1) edit = .{
+                    .start = @intCast(loc.start),
+                    .end = @intCast(loc.end),
+                    .len = @intCast(change.text.len),
+                    .newlines = std.mem.indexOfScalar(
+                        u8,
+                        buffer.items[loc.start..loc.end],
+                        '\n',
+                    ) != null or std.mem.indexOfScalar(u8, change.text, '\n') != null,
+                };
                 try buffer.replaceRange(self.gpa, loc.start, loc.end - loc.start, change.text);
             },
         }
     }
 
     const new_text = try buffer.toOwnedSlice(self.gpa);
+
+    // Edits to the content of text nodes (i.e. typing prose) don't change
+    // the structure of the document, so there's no need to parse and
+    // validate it again. Line suppressions (`superhtml-disable-line`)
+    // match diagnostics by line, so edits that add or remove lines must
+    // go through validation again.
+    if (edit) |e| if (!e.newlines and !file.stale) {
+        if (file.applyTextEdit(new_text, e.start, e.end, e.len)) {
+            return logic.publishDiagnostics(
+                self,
+                arena,
+                notification.textDocument.uri,
+                file.*,
+            );
+        }
+    }
+
+    // While the user is typing, don't validate the document on every
+    // keystroke: the next request that needs it (e.g. semantic tokens,
+    // which editors send after changes) or `IdleTransport`, once the
+    // debounce window is over, takes care of it.
+    if (file.validated_at) |last| {
+        const now = Io.Clock.awake.now(self.io) catch last;
+        if (now.nanoseconds - last.nanoseconds < debounce_ms * std.time.ns_per_ms) {
+            file.src = new_text;
+            file.stale = true;
+            return;
+        }
+    }
+
     errdefer self.gpa.free(new_text);
 
-    // TODO: this is a hack while we wait for actual incremental reloads
     try logic.loadFile(
         self,
         arena,
@@ -247,13 +435,13 @@ pub fn @"textDocument/didClose"(
 }
 
 pub fn @"textDocument/formatting"(
-    self: *const Handler,
+    self: *Handler,
     arena: std.mem.Allocator,
     request: types.document_formatting.Params,
 ) !?[]const types.TextEdit {
     log.debug("format request!!", .{});
 
-    const doc = self.files.getPtr(request.textDocument.uri) orelse return null;
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
     if (doc.html.has_syntax_errors) {
         return null;
     }
@@ -265,8 +453,9 @@ pub fn @"textDocument/formatting"(
 
     log.debug("format!!", .{});
 
+    const config = try logic.loadConfig(self, arena, request.textDocument.uri);
     var aw = std.Io.Writer.Allocating.init(arena);
-    try doc.html.render(doc.src, &aw.writer);
+    try doc.html.render(doc.src, &aw.writer, config.renderOptions());
 
     return try arena.dupe(types.TextEdit, &.{.{
         .range = range,
@@ -274,12 +463,55 @@ pub fn @"textDocument/formatting"(
     }});
 }
 
+pub fn @"textDocument/rangeFormatting"(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    request: types.document_range_formatting.Params,
+) !?[]const types.TextEdit {
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
+    if (doc.html.has_syntax_errors) {
+        return null;
+    }
+
+    const range: super.Span = .{
+        .start = @intCast(offsets.positionToIndex(
+            doc.src,
+            request.range.start,
+            self.offset_encoding,
+        )),
+        .end = @intCast(offsets.positionToIndex(
+            doc.src,
+            request.range.end,
+            self.offset_encoding,
+        )),
+    };
+
+    const config = try logic.loadConfig(self, arena, request.textDocument.uri);
+    const fragments = try doc.html.fragments(arena, doc.src, range);
+    const edits = try arena.alloc(types.TextEdit, fragments.len);
+    for (fragments, edits) |fragment, *edit| {
+        var aw = std.Io.Writer.Allocating.init(arena);
+        try doc.html.renderFragment(
+            doc.src,
+            &aw.writer,
+            config.renderOptions(),
+            fragment,
+        );
+        edit.* = .{
+            .range = getRange(fragment.span, doc.src),
+            .newText = aw.written(),
+        };
+    }
+
+    return edits;
+}
+
 pub fn @"textDocument/codeAction"(
     self: *Handler,
     arena: std.mem.Allocator,
     request: types.CodeAction.Params,
 ) error{OutOfMemory}!lsp.ResultType("textDocument/codeAction") {
-    const doc = self.files.getPtr(request.textDocument.uri) orelse return null;
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
     const offset = lsp.offsets.positionToIndex(
         doc.src,
         request.range.start,
@@ -288,19 +520,64 @@ pub fn @"textDocument/codeAction"(
 
     if (self.syntax_only) return null;
 
-    for (doc.html.errors) |err| {
-        if (err.tag != .invalid_html_tag_name) continue;
+    const Action = @typeInfo(
+        @typeInfo(lsp.ResultType("textDocument/codeAction")).optional.child,
+    ).pointer.child;
 
+    var actions: std.ArrayList(Action) = .empty;
+    for (doc.html.errors) |err| {
         const span = err.main_location;
-        if (span.start <= offset and span.end > offset) {
+        if (span.start > offset or span.end <= offset) continue;
+
+        const fix = try quickFix(arena, doc, err) orelse continue;
+        try actions.append(arena, .{
+            .code_action = .{
+                .title = fix.title,
+                .kind = .quickfix,
+                .isPreferred = true,
+                .edit = .{
+                    .changes = .{
+                        .map = try .init(
+                            arena,
+                            &.{request.textDocument.uri},
+                            &.{fix.edits},
+                        ),
+                    },
+                },
+            },
+        });
+    }
+
+    if (actions.items.len == 0) return null;
+    return actions.items;
+}
+
+const QuickFix = struct {
+    title: []const u8,
+    edits: []const lsp.types.TextEdit,
+};
+
+/// Returns the edits that fix `err`, for errors that can be fixed
+/// mechanically.
+fn quickFix(
+    arena: std.mem.Allocator,
+    doc: *const Document,
+    err: super.html.Ast.Error,
+) error{OutOfMemory}!?QuickFix {
+    const src = doc.src;
+    const nodes = doc.html.nodes;
+    const span = err.main_location;
+    switch (err.tag) {
+        else => return null,
+        .invalid_html_tag_name => {
             const edits = try arena.alloc(lsp.types.TextEdit, 2);
             edits[0] = .{
-                .range = getRange(span, doc.src),
+                .range = getRange(span, src),
                 .newText = "div",
             };
 
             const edits_len: usize = if (err.node_idx != 0) blk: {
-                const node = doc.html.nodes[err.node_idx];
+                const node = nodes[err.node_idx];
                 if (node.kind.isVoid() or node.self_closing) break :blk 1;
 
                 const close = node.close;
@@ -310,37 +587,177 @@ pub fn @"textDocument/codeAction"(
                     .range = getRange(.{
                         .start = close.start + 1,
                         .end = close.end - 1,
-                    }, doc.src),
+                    }, src),
                     .newText = "/div",
                 };
 
                 break :blk 2;
             } else 1;
 
-            const result: lsp.ResultType("textDocument/codeAction") = &.{
-                .{
-                    .code_action = .{
-                        .title = "Replace with 'div'",
-                        .kind = .quickfix,
-                        .isPreferred = true,
-                        .edit = .{
-                            .changes = .{
-                                .map = try .init(
-                                    arena,
-                                    &.{request.textDocument.uri},
-                                    &.{edits[0..edits_len]},
-                                ),
-                            },
-                        },
-                    },
-                },
+            return .{
+                .title = "Replace with 'div'",
+                .edits = edits[0..edits_len],
             };
+        },
+        .html_elements_cant_self_close => {
+            // The element is unclosed, so look for it among all nodes.
+            const node = for (nodes) |n| {
+                if (n.open.start <= span.start and n.open.end > span.start) break n;
+            } else return null;
+            const open = node.open;
+            if (open.end < 2 or src[open.end - 2] != '/') return null;
+
+            if (node.kind.isVoid()) {
+                // Also remove the whitespace before the slash.
+                var start = open.end - 2;
+                while (start > span.end and std.ascii.isWhitespace(src[start - 1])) {
+                    start -= 1;
+                }
 
-            return try arena.dupe(@typeInfo(@TypeOf(result.?)).pointer.child, result.?);
-        }
+                return .{
+                    .title = "Remove self-closing slash",
+                    .edits = try arena.dupe(lsp.types.TextEdit, &.{.{
+                        .range = getRange(.{
+                            .start = start,
+                            .end = open.end - 1,
+                        }, src),
+                        .newText = "",
+                    }}),
+                };
+            }
+
+            return .{
+                .title = "Add end tag",
+                .edits = try arena.dupe(lsp.types.TextEdit, &.{.{
+                    .range = getRange(.{
+                        .start = open.end - 2,
+                        .end = open.end,
+                    }, src),
+                    .newText = try std.fmt.allocPrint(arena, "></{s}>", .{
+                        span.slice(src),
+                    }),
+                }}),
+            };
+        },
+        .invalid_attr_value => |iav| {
+            const suggestion = iav.suggestion orelse return null;
+            return .{
+                .title = try std.fmt.allocPrint(arena, "Replace with '{s}'", .{suggestion}),
+                .edits = try arena.dupe(lsp.types.TextEdit, &.{.{
+                    .range = getRange(span, src),
+                    .newText = suggestion,
+                }}),
+            };
+        },
+        .mismatched_tag_case => |start_name| {
+            if (err.node_idx == 0) return null;
+            const node = nodes[err.node_idx];
+
+            // Names of foreign elements are case-sensitive, the start tag
+            // is assumed to be right.
+            if (node.kind == .___) return .{
+                .title = "Match the case of the start tag",
+                .edits = try arena.dupe(lsp.types.TextEdit, &.{.{
+                    .range = getRange(span, src),
+                    .newText = start_name.slice(src),
+                }}),
+            };
+
+            const name = try std.ascii.allocLowerString(arena, start_name.slice(src));
+            return .{
+                .title = "Lowercase tag names",
+                .edits = try arena.dupe(lsp.types.TextEdit, &.{
+                    .{ .range = getRange(start_name, src), .newText = name },
+                    .{ .range = getRange(span, src), .newText = name },
+                }),
+            };
+        },
+        .missing_self_closing_slash => {
+            if (err.node_idx == 0) return null;
+            const open = nodes[err.node_idx].open;
+            const space = !std.ascii.isWhitespace(src[open.end - 2]);
+            return .{
+                .title = "Add self-closing slash",
+                .edits = try arena.dupe(lsp.types.TextEdit, &.{.{
+                    .range = getRange(.{
+                        .start = open.end - 1,
+                        .end = open.end - 1,
+                    }, src),
+                    .newText = if (space) " /" else "/",
+                }}),
+            };
+        },
+        .uppercase_name => {
+            const name = try std.ascii.allocLowerString(arena, span.slice(src));
+            var edits: std.ArrayList(lsp.types.TextEdit) = .empty;
+            try edits.append(arena, .{ .range = getRange(span, src), .newText = name });
+
+            // When the element name is reported, its end tag goes with it.
+            if (err.node_idx != 0) {
+                const node = nodes[err.node_idx];
+                if (span.start == node.open.start + 1 and node.close.start != 0) {
+                    const end_name = node.endTagName(src);
+                    if (std.ascii.eqlIgnoreCase(end_name.slice(src), name)) {
+                        try edits.append(arena, .{
+                            .range = getRange(end_name, src),
+                            .newText = name,
+                        });
+                    }
+                }
+            }
+
+            return .{
+                .title = "Lowercase name",
+                .edits = edits.items,
+            };
+        },
+        .missing_alt => {},
+        .missing_required_attr => |name| {
+            if (!std.mem.eql(u8, name, "alt")) return null;
+        },
+        .invalid_nesting => {
+            if (err.node_idx == 0) return null;
+            const node = nodes[err.node_idx];
+            if (node.kind != .li or node.close.start == 0) return null;
+
+            // Wrap all consecutive stray list items at once.
+            var last = node;
+            while (last.next_idx != 0) {
+                const next = nodes[last.next_idx];
+                if (next.kind != .li or next.close.start == 0) break;
+                last = next;
+            }
+
+            return .{
+                .title = "Wrap in <ul>",
+                .edits = try arena.dupe(lsp.types.TextEdit, &.{
+                    .{
+                        .range = getRange(.{
+                            .start = node.open.start,
+                            .end = node.open.start,
+                        }, src),
+                        .newText = "<ul>",
+                    },
+                    .{
+                        .range = getRange(.{
+                            .start = last.close.end,
+                            .end = last.close.end,
+                        }, src),
+                        .newText = "</ul>",
+                    },
+                }),
+            };
+        },
     }
 
-    return null;
+    // Missing alt, the location is the tag name.
+    return .{
+        .title = "Add alt=\"\"",
+        .edits = try arena.dupe(lsp.types.TextEdit, &.{.{
+            .range = getRange(.{ .start = span.end, .end = span.end }, src),
+            .newText = " alt=\"\"",
+        }}),
+    };
 }
 
 pub fn @"textDocument/prepareRename"(
@@ -348,9 +765,7 @@ pub fn @"textDocument/prepareRename"(
     arena: std.mem.Allocator,
     request: types.prepare_rename.Params,
 ) error{OutOfMemory}!lsp.ResultType("textDocument/prepareRename") {
-    _ = arena;
-
-    const doc = self.files.getPtr(request.textDocument.uri) orelse return null;
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
     const offset = lsp.offsets.positionToIndex(
         doc.src,
         request.position,
@@ -363,11 +778,14 @@ pub fn @"textDocument/prepareRename"(
     const node = doc.html.nodes[node_idx];
     if (!node.kind.isElement()) return null;
 
-    const it = node.startTagIterator(doc.src, doc.language);
+    // Class names are renamed in all elements, tag names in the start and
+    // end tags of the element.
+    const span = classAtOffset(doc, node, offset) orelse
+        node.startTagIterator(doc.src, doc.language).name_span;
 
     const range = lsp.offsets.locToRange(doc.src, .{
-        .start = it.name_span.start,
-        .end = it.name_span.end,
+        .start = span.start,
+        .end = span.end,
     }, self.offset_encoding);
 
     return .{ .range = range };
@@ -378,7 +796,23 @@ pub fn @"textDocument/rename"(
     arena: std.mem.Allocator,
     request: types.rename.Params,
 ) error{OutOfMemory}!lsp.ResultType("textDocument/rename") {
-    const ranges = try tagRanges(self, arena, request) orelse return null;
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
+    const offset = lsp.offsets.positionToIndex(
+        doc.src,
+        request.position,
+        self.offset_encoding,
+    );
+
+    const class: ?super.Span = blk: {
+        const node_idx = doc.html.findNodeTagsIdx(@intCast(offset));
+        if (node_idx == 0) break :blk null;
+        break :blk classAtOffset(doc, doc.html.nodes[node_idx], offset);
+    };
+
+    const ranges = if (class) |span|
+        try classRanges(self, arena, doc, span.slice(doc.src))
+    else
+        try tagRanges(self, arena, request) orelse return null;
     const edits = try arena.alloc(types.TextEdit, ranges.len);
 
     for (edits, ranges) |*edit, range| {
@@ -436,12 +870,274 @@ pub fn @"textDocument/linkedEditingRange"(
     return .{ .ranges = highlights };
 }
 
+pub fn @"textDocument/foldingRange"(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    request: lsp.ParamsType("textDocument/foldingRange"),
+) error{OutOfMemory}!lsp.ResultType("textDocument/foldingRange") {
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
+
+    var ranges: std.ArrayList(types.FoldingRange) = .empty;
+    for (doc.html.nodes) |n| {
+        switch (n.kind) {
+            .root, .doctype, .text => {},
+            .comment => {
+                const range = getRange(n.open, doc.src);
+                if (range.end.line == range.start.line) continue;
+                try ranges.append(arena, .{
+                    .startLine = range.start.line,
+                    .endLine = range.end.line,
+                    .kind = .comment,
+                });
+            },
+            else => {
+                if (n.kind.isVoid() or n.self_closing) continue;
+                // Unclosed elements don't have a well defined end.
+                if (n.close.start == 0) continue;
+
+                // Keep the line of the end tag visible when folded.
+                const start = getRange(n.open, doc.src).start.line;
+                const end = getRange(n.close, doc.src).start.line -| 1;
+                if (end <= start) continue;
+                try ranges.append(arena, .{
+                    .startLine = start,
+                    .endLine = end,
+                });
+            },
+        }
+    }
+
+    return ranges.items;
+}
+
+pub fn @"textDocument/documentSymbol"(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    request: lsp.ParamsType("textDocument/documentSymbol"),
+) error{OutOfMemory}!lsp.ResultType("textDocument/documentSymbol") {
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
+    if (doc.html.nodes.len < 2) return null;
+    return .{ .document_symbols = try documentSymbols(arena, doc, 0) };
+}
+
+fn documentSymbols(
+    arena: std.mem.Allocator,
+    doc: *const Document,
+    parent_idx: u32,
+) error{OutOfMemory}![]const types.DocumentSymbol {
+    const nodes = doc.html.nodes;
+    var symbols: std.ArrayList(types.DocumentSymbol) = .empty;
+    var child_idx = nodes[parent_idx].first_child_idx;
+    while (child_idx != 0) : (child_idx = nodes[child_idx].next_idx) {
+        const n = nodes[child_idx];
+        if (!n.kind.isElement()) continue;
+
+        const sti = n.startTagIterator(doc.src, doc.language);
+        const tag_name = sti.name_span.slice(doc.src);
+
+        // div#header, nav.main
+        const name = if (n.attrValue(doc.src, doc.language, "id")) |id|
+            try std.fmt.allocPrint(arena, "{s}#{s}", .{ tag_name, id.slice(doc.src) })
+        else if (n.attrValue(doc.src, doc.language, "class")) |class| blk: {
+            var it = std.mem.tokenizeAny(u8, class.slice(doc.src), &std.ascii.whitespace);
+            const first = it.next() orelse break :blk tag_name;
+            break :blk try std.fmt.allocPrint(arena, "{s}.{s}", .{ tag_name, first });
+        } else tag_name;
+
+        const end = if (n.close.start > 0) n.close.end else n.open.end;
+        const children = try documentSymbols(arena, doc, child_idx);
+        try symbols.append(arena, .{
+            .name = name,
+            .kind = switch (n.kind) {
+                .main => .Module,
+                .header, .footer => .Namespace,
+                .nav => .Interface,
+                .article, .aside, .section => .Class,
+                else => .Field,
+            },
+            .range = getRange(.{ .start = n.open.start, .end = end }, doc.src),
+            .selectionRange = getRange(sti.name_span, doc.src),
+            .children = if (children.len > 0) children else null,
+        });
+    }
+
+    return symbols.items;
+}
+
+pub fn @"textDocument/semanticTokens/full"(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    request: lsp.ParamsType("textDocument/semanticTokens/full"),
+) error{OutOfMemory}!lsp.ResultType("textDocument/semanticTokens/full") {
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
+    const superhtml = doc.language == .superhtml;
+
+    var tokens: std.ArrayList(SemanticToken) = .empty;
+    for (doc.html.nodes) |n| switch (n.kind) {
+        .root, .doctype, .text => {},
+        .comment => try tokens.append(arena, .{ .span = n.open, .kind = .comment }),
+        else => {
+            const tag_kind: SemanticToken.Kind = switch (n.kind) {
+                .extend, .super, .ctx => if (superhtml) .directive else .tag,
+                else => .tag,
+            };
+
+            var sti = n.startTagIterator(doc.src, doc.language);
+            try tokens.append(arena, .{ .span = sti.name_span, .kind = tag_kind });
+            while (sti.next(doc.src)) |attr| {
+                const name = attr.name.slice(doc.src);
+                try tokens.append(arena, .{
+                    .span = attr.name,
+                    .kind = if (superhtml and std.mem.startsWith(u8, name, ":"))
+                        .directive
+                    else
+                        .attribute,
+                });
+
+                const value = attr.value orelse continue;
+                if (superhtml and std.mem.startsWith(u8, value.span.slice(doc.src), "$")) {
+                    try tokens.append(arena, .{ .span = value.span, .kind = .interpolation });
+                } else {
+                    const quote: u32 = @intFromBool(value.quote != .none);
+                    try tokens.append(arena, .{
+                        .span = .{
+                            .start = value.span.start - quote,
+                            .end = value.span.end + quote,
+                        },
+                        .kind = .value,
+                    });
+                }
+            }
+
+            // Unclosed elements don't have an end tag.
+            if (n.close.start > 0) try tokens.append(arena, .{
+                .span = endTagName(n.close, doc.src),
+                .kind = tag_kind,
+            });
+        },
+    };
+
+    // End tags are collected after the content of their element.
+    std.mem.sort(SemanticToken, tokens.items, {}, SemanticToken.lessThan);
+
+    return .{ .data = try encodeSemanticTokens(
+        arena,
+        tokens.items,
+        doc.src,
+        self.offset_encoding,
+    ) };
+}
+
+const SemanticToken = struct {
+    span: super.Span,
+    kind: Kind,
+
+    /// The order must match `legend`.
+    const Kind = enum(u32) {
+        tag,
+        attribute,
+        value,
+        comment,
+        directive,
+        interpolation,
+
+        /// Standard LSP token types, so that any color theme can highlight
+        /// them.
+        const legend = [_][]const u8{
+            "type",
+            "property",
+            "string",
+            "comment",
+            "keyword",
+            "variable",
+        };
+    };
+
+    fn lessThan(_: void, lhs: SemanticToken, rhs: SemanticToken) bool {
+        return lhs.span.start < rhs.span.start;
+    }
+};
+
+/// Encodes sorted tokens as relative positions, as required by the LSP
+/// spec. Tokens that span multiple lines are split in one token per line.
+fn encodeSemanticTokens(
+    arena: std.mem.Allocator,
+    tokens: []const SemanticToken,
+    src: []const u8,
+    encoding: offsets.Encoding,
+) error{OutOfMemory}![]const u32 {
+    var data: std.ArrayList(u32) = .empty;
+
+    // Position of `idx` in the document.
+    var idx: usize = 0;
+    var line: u32 = 0;
+    var line_start: usize = 0;
+
+    var prev_line: u32 = 0;
+    var prev_col: u32 = 0;
+    for (tokens) |tok| {
+        // Overlapping tokens are not allowed.
+        if (tok.span.start < idx) continue;
+
+        const end = @min(tok.span.end, src.len);
+        var start: usize = tok.span.start;
+        while (start < end) {
+            while (idx < start) : (idx += 1) {
+                if (src[idx] == '\n') {
+                    line += 1;
+                    line_start = idx + 1;
+                }
+            }
+
+            const line_end = std.mem.indexOfScalarPos(u8, src[0..end], start, '\n') orelse end;
+            if (line_end > start) {
+                // Columns and lengths are in the negotiated encoding, only
+                // the current line needs to be scanned to compute them.
+                const col = offsets.indexToPosition(
+                    src[line_start..line_end],
+                    start - line_start,
+                    encoding,
+                ).character;
+                const len = offsets.indexToPosition(
+                    src[start..line_end],
+                    line_end - start,
+                    encoding,
+                ).character;
+                try data.appendSlice(arena, &.{
+                    line - prev_line,
+                    if (line == prev_line) col - prev_col else col,
+                    len,
+                    @intFromEnum(tok.kind),
+                    0, // modifiers
+                });
+                prev_line = line;
+                prev_col = col;
+            }
+
+            start = line_end + 1;
+        }
+    }
+
+    return data.items;
+}
+
+/// Returns the span of the tag name inside of an end tag.
+fn endTagName(close: super.Span, src: []const u8) super.Span {
+    const start = close.start + 2; // '</'
+    var end = start;
+    while (end < close.end) : (end += 1) switch (src[end]) {
+        '>', ' ', '\t', '\n', '\r', '\x0C' => break,
+        else => {},
+    };
+    return .{ .start = start, .end = end };
+}
+
 pub fn @"textDocument/references"(
     self: *Handler,
     arena: std.mem.Allocator,
     request: types.reference.Params,
 ) error{OutOfMemory}!lsp.ResultType("textDocument/references") {
-    const doc = self.files.getPtr(request.textDocument.uri) orelse return null;
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
     const offset = lsp.offsets.positionToIndex(
         doc.src,
         request.position,
@@ -452,62 +1148,224 @@ pub fn @"textDocument/references"(
     log.debug("------ References request! (node: {}) ------", .{node_idx});
     if (node_idx == 0) return null;
 
-    const class = blk: {
-        const node = doc.html.nodes[node_idx];
-        var it = node.startTagIterator(doc.src, doc.language);
-        while (it.next(doc.src)) |attr| {
-            if (std.ascii.eqlIgnoreCase(attr.name.slice(doc.src), "class")) {
-                const value = attr.value orelse return null;
-                const slice = value.span.slice(doc.src);
-                if (slice.len == 0 or slice[0] == '$') return null;
-                if (offset < value.span.start or offset >= value.span.end) return null;
+    const node = doc.html.nodes[node_idx];
+    if (try idAtOffset(arena, doc, node_idx, offset)) |id| {
+        return try idReferences(
+            self,
+            arena,
+            doc,
+            request.textDocument.uri,
+            id,
+            request.context.includeDeclaration,
+        );
+    }
 
-                const rel_offset = offset - value.span.start;
+    const class = classAtOffset(doc, node, offset) orelse return null;
+    log.debug("------ CLASS: '{s}' ------", .{class.slice(doc.src)});
 
-                var vit = std.mem.tokenizeScalar(u8, slice, ' ');
+    const ranges = try classRanges(self, arena, doc, class.slice(doc.src));
+    const locations = try arena.alloc(types.Location, ranges.len);
+    for (locations, ranges) |*location, range| {
+        location.* = .{
+            .uri = request.textDocument.uri,
+            .range = range,
+        };
+    }
 
-                while (vit.next()) |cls| {
-                    if (rel_offset < vit.index - cls.len) return null;
-                    if (vit.index > rel_offset) {
-                        break :blk cls;
-                    }
-                } else return null;
-            }
-        } else return null;
-    };
+    return locations;
+}
 
-    log.debug("------ CLASS: '{s}' ------", .{class});
+/// Returns the span of the class name at `offset` in the class attribute of
+/// `node`, if any.
+fn classAtOffset(doc: *const Document, node: super.html.Ast.Node, offset: usize) ?super.Span {
+    if (!node.kind.isElement()) return null;
+    const value = node.attrValue(doc.src, doc.language, "class") orelse return null;
+    const slice = value.slice(doc.src);
+    if (slice.len == 0 or slice[0] == '$') return null;
+    if (offset < value.start or offset > value.end) return null;
+
+    const rel_offset = offset - value.start;
+    var it = std.mem.tokenizeAny(u8, slice, &std.ascii.whitespace);
+    while (it.next()) |cls| {
+        const start = it.index - cls.len;
+        if (rel_offset < start) return null;
+        if (rel_offset <= it.index) return .{
+            .start = @intCast(value.start + start),
+            .end = @intCast(value.start + it.index),
+        };
+    }
+    return null;
+}
 
-    var locations: std.ArrayListUnmanaged(lsp.types.Location) = .empty;
+/// Finds all occurrences of `class` in class attributes, including
+/// duplicates in the same attribute.
+fn classRanges(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    doc: *const Document,
+    class: []const u8,
+) error{OutOfMemory}![]const types.Range {
+    var ranges: std.ArrayList(types.Range) = .empty;
     for (doc.html.nodes) |n| {
         if (!n.kind.isElement()) continue;
+        const value = n.attrValue(doc.src, doc.language, "class") orelse continue;
+        const slice = value.slice(doc.src);
+        if (slice.len == 0 or slice[0] == '$') continue;
+
+        var it = std.mem.tokenizeAny(u8, slice, &std.ascii.whitespace);
+        while (it.next()) |cls| {
+            if (!std.mem.eql(u8, class, cls)) continue;
+            try ranges.append(arena, lsp.offsets.locToRange(doc.src, .{
+                .start = value.start + it.index - cls.len,
+                .end = value.start + it.index,
+            }, self.offset_encoding));
+        }
+    }
+    return ranges.items;
+}
 
-        var it = n.startTagIterator(doc.src, doc.language);
-        outer: while (it.next(doc.src)) |attr| {
-            if (std.ascii.eqlIgnoreCase(attr.name.slice(doc.src), "class")) {
-                const value = attr.value orelse break :outer;
-                const slice = value.span.slice(doc.src);
-                if (slice.len == 0 or slice[0] == '$') break :outer;
-                var vit = std.mem.tokenizeScalar(u8, slice, ' ');
-                while (vit.next()) |cls| {
-                    if (std.mem.eql(u8, class, cls)) {
-                        const range = lsp.offsets.locToRange(doc.src, .{
-                            .start = value.span.start + vit.index - cls.len,
-                            .end = value.span.start + vit.index,
-                        }, self.offset_encoding);
-
-                        try locations.append(arena, .{
-                            .uri = request.textDocument.uri,
-                            .range = range,
-                        });
-                        break :outer;
-                    }
-                }
-            }
+pub fn @"textDocument/definition"(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    request: lsp.ParamsType("textDocument/definition"),
+) error{OutOfMemory}!lsp.ResultType("textDocument/definition") {
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
+    const offset = lsp.offsets.positionToIndex(
+        doc.src,
+        request.position,
+        self.offset_encoding,
+    );
+
+    const node_idx = doc.html.findNodeTagsIdx(@intCast(offset));
+    if (node_idx == 0) return null;
+
+    if (blockIdAtOffset(doc, node_idx, offset)) |block_id| {
+        const layout = try logic.loadLayout(
+            self,
+            arena,
+            request.textDocument.uri,
+            doc,
+        ) orelse return null;
+        const super_idx = layout.ast.interface.get(block_id.slice(doc.src)) orelse {
+            return null;
+        };
+        const id_value = layout.ast.nodes[super_idx].superBlock(
+            layout.src,
+            layout.html,
+        ).id_value;
+        return .{
+            .definition = .{
+                .location = .{
+                    .uri = try logic.fileUri(arena, layout.path),
+                    .range = lsp.offsets.locToRange(layout.src, .{
+                        .start = id_value.span.start,
+                        .end = id_value.span.end,
+                    }, self.offset_encoding),
+                },
+            },
+        };
+    }
+
+    const node = doc.html.nodes[node_idx];
+    if (node.kind != .label) return null;
+    const value = node.attrValue(doc.src, doc.language, "for") orelse return null;
+    if (offset < value.start or offset > value.end) return null;
+
+    const ids = try doc.html.idIndex(arena, doc.src);
+    const entry = ids.get(value.slice(doc.src)) orelse return null;
+
+    return .{
+        .definition = .{
+            .location = .{
+                .uri = request.textDocument.uri,
+                .range = lsp.offsets.locToRange(doc.src, .{
+                    .start = entry.span.start,
+                    .end = entry.span.end,
+                }, self.offset_encoding),
+            },
+        },
+    };
+}
+
+/// Returns the span of the `id` value under the cursor if it belongs to a
+/// block, i.e. a top-level element of a template that extends another one.
+fn blockIdAtOffset(doc: *const Document, node_idx: u32, offset: usize) ?super.Span {
+    const super_ast = doc.super_ast orelse return null;
+    if (super_ast.extendTemplate() == null) return null;
+
+    const node = doc.html.nodes[node_idx];
+    if (node.parent_idx != 0 or node.kind == .extend) return null;
+    const value = node.attrValue(doc.src, doc.language, "id") orelse return null;
+    if (offset < value.start or offset > value.end) return null;
+    return value;
+}
+
+/// Returns the id under the cursor, either from an `id` attribute or from an
+/// attribute that references ids (see `Ast.idReferences`).
+fn idAtOffset(
+    arena: std.mem.Allocator,
+    doc: *const Document,
+    node_idx: u32,
+    offset: usize,
+) error{OutOfMemory}!?[]const u8 {
+    const node = doc.html.nodes[node_idx];
+    if (node.attrValue(doc.src, doc.language, "id")) |value| {
+        if (offset >= value.start and offset <= value.end) {
+            const id = value.slice(doc.src);
+            if (id.len == 0 or id[0] == '$') return null;
+            return id;
         }
     }
 
-    return locations.items;
+    const refs = try doc.html.idReferences(arena, doc.src);
+    for (refs) |ref| {
+        if (ref.node_idx != node_idx) continue;
+        if (offset >= ref.span.start and offset <= ref.span.end) return ref.id;
+    }
+    return null;
+}
+
+/// Finds all references to `id` in document order, plus the elements that
+/// define it when `include_declaration` is set.
+fn idReferences(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    doc: *const Document,
+    uri: []const u8,
+    id: []const u8,
+    include_declaration: bool,
+) error{OutOfMemory}![]const types.Location {
+    var spans: std.ArrayList(super.Span) = .empty;
+    if (include_declaration) {
+        for (doc.html.nodes) |n| {
+            const value = n.attrValue(doc.src, doc.language, "id") orelse continue;
+            if (!std.mem.eql(u8, value.slice(doc.src), id)) continue;
+            try spans.append(arena, value);
+        }
+    }
+    const refs = try doc.html.idReferences(arena, doc.src);
+    for (refs) |ref| {
+        if (!std.mem.eql(u8, ref.id, id)) continue;
+        try spans.append(arena, ref.span);
+    }
+
+    std.mem.sort(super.Span, spans.items, {}, struct {
+        fn lessThan(_: void, lhs: super.Span, rhs: super.Span) bool {
+            return lhs.start < rhs.start;
+        }
+    }.lessThan);
+
+    const locations = try arena.alloc(types.Location, spans.items.len);
+    for (locations, spans.items) |*location, span| {
+        location.* = .{
+            .uri = uri,
+            .range = lsp.offsets.locToRange(doc.src, .{
+                .start = span.start,
+                .end = span.end,
+            }, self.offset_encoding),
+        };
+    }
+    return locations;
 }
 
 pub fn @"textDocument/completion"(
@@ -515,7 +1373,7 @@ pub fn @"textDocument/completion"(
     arena: std.mem.Allocator,
     request: types.completion.Params,
 ) error{OutOfMemory}!?types.completion.Result {
-    const doc = self.files.getPtr(request.textDocument.uri) orelse return null;
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
     const offset = lsp.offsets.positionToIndex(
         doc.src,
         request.position,
@@ -525,8 +1383,33 @@ pub fn @"textDocument/completion"(
     log.debug("===== lsp autocomplete! offset={}", .{offset});
 
     const completions = try doc.html.completions(arena, doc.src, @intCast(offset));
-    const items = try arena.alloc(types.completion.Item, completions.len);
-    for (items, completions) |*it, cpl| {
+    var extra: std.ArrayList(types.completion.Item) = .empty;
+    if (try endTagCompletion(arena, doc, @intCast(offset))) |item| {
+        try extra.append(arena, item);
+    }
+    const config = try logic.loadConfig(self, arena, request.textDocument.uri);
+    if (try emmetCompletion(
+        arena,
+        doc,
+        @intCast(offset),
+        config.renderOptions(),
+    )) |item| {
+        try extra.append(arena, item);
+    }
+    try extra.appendSlice(arena, try blockCompletions(
+        self,
+        arena,
+        request.textDocument.uri,
+        doc,
+        @intCast(offset),
+    ));
+
+    const items = try arena.alloc(
+        types.completion.Item,
+        completions.len + extra.items.len,
+    );
+    @memcpy(items[completions.len..], extra.items);
+    for (items[0..completions.len], completions) |*it, cpl| {
         log.debug("label = '{s}' desc = '{s}'", .{ cpl.label, cpl.desc });
         const insert_text = if (cpl.value) |v| blk: {
             if (cpl.kind != .element_open) break :blk v;
@@ -552,6 +1435,12 @@ pub fn @"textDocument/completion"(
             },
             .commitCharacters = &.{" >"},
             .preselect = cpl.label[0] == '/',
+            .tags = if (cpl.obsolete) &.{.Deprecated} else null,
+            // Labels are lowercase, so obsolete elements sort last.
+            .sortText = if (cpl.obsolete)
+                try std.fmt.allocPrint(arena, "~{s}", .{cpl.label})
+            else
+                null,
             .insertTextFormat = if (cpl.kind == .element_open) .Snippet else null,
         };
     }
@@ -559,14 +1448,158 @@ pub fn @"textDocument/completion"(
     return .{ .completion_items = items };
 }
 
+/// Offers to insert the end tag of the element whose start tag was just
+/// completed by typing `>`, unless the end tag is already there.
+fn endTagCompletion(
+    arena: std.mem.Allocator,
+    doc: *const Document,
+    offset: u32,
+) error{OutOfMemory}!?types.completion.Item {
+    const src = doc.src;
+    if (offset == 0 or src[offset - 1] != '>') return null;
+    const name = doc.html.missingEndTag(src, offset) orelse return null;
+    const end_tag = try std.fmt.allocPrint(arena, "</{s}>", .{name.slice(src)});
+
+    return .{
+        .label = end_tag,
+        .kind = .Snippet,
+        .detail = "Insert end tag",
+        .preselect = true,
+        .textEdit = .{
+            .text_edit = .{
+                .range = getRange(.{ .start = offset, .end = offset }, src),
+                .newText = try std.fmt.allocPrint(arena, "$0{s}", .{end_tag}),
+            },
+        },
+        .insertTextFormat = .Snippet,
+    };
+}
+
+/// Offers the blocks declared by the extended template when the cursor is in
+/// the id of a block, except for the ones that are already defined. Blocks
+/// nested in other blocks are part of the interface too.
+fn blockCompletions(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    uri: []const u8,
+    doc: *const Document,
+    offset: u32,
+) error{OutOfMemory}![]const types.completion.Item {
+    const node_idx = doc.html.findNodeTagsIdx(offset);
+    if (node_idx == 0) return &.{};
+    const value = blockIdAtOffset(doc, node_idx, offset) orelse return &.{};
+
+    // A missing template is reported as a diagnostic.
+    const layout = try logic.loadLayout(self, arena, uri, doc) orelse return &.{};
+    const defined = doc.super_ast.?.blocks;
+
+    var items: std.ArrayList(types.completion.Item) = .empty;
+    for (layout.ast.interface.keys(), layout.ast.interface.values()) |id, super_idx| {
+        if (defined.contains(id) and !std.mem.eql(u8, id, value.slice(doc.src))) continue;
+        const block = layout.ast.nodes[super_idx].superBlock(layout.src, layout.html);
+        try items.append(arena, .{
+            .label = id,
+            .kind = .Reference,
+            .detail = try std.fmt.allocPrint(arena, "<{s}> in {s}", .{
+                block.parent_tag_name.slice(layout.src),
+                std.fs.path.basename(layout.path),
+            }),
+            .textEdit = .{
+                .text_edit = .{
+                    .range = getRange(value, doc.src),
+                    .newText = id,
+                },
+            },
+        });
+    }
+    return items.items;
+}
+
+/// Offers the expansion of the Emmet abbreviation (e.g. `ul>li*3`) that ends
+/// at `offset`, if any. Abbreviations must be the only content of their line,
+/// so that prose like `a.b` or `i.e` in a sentence doesn't trigger them.
+fn emmetCompletion(
+    arena: std.mem.Allocator,
+    doc: *const Document,
+    offset: u32,
+    options: super.html.Ast.RenderOptions,
+) error{OutOfMemory}!?types.completion.Item {
+    const src = doc.src;
+    const nodes = doc.html.nodes;
+
+    // Abbreviations are only expanded in text.
+    const text = for (nodes) |n| {
+        if (n.kind == .text and n.open.start < offset and offset <= n.open.end) break n;
+    } else return null;
+    switch (nodes[text.parent_idx].kind) {
+        .script, .style, .textarea, .title, .pre => return null,
+        else => {},
+    }
+
+    // Whitespace is only allowed inside of text blocks (e.g. `p{Hello world}`).
+    var start = offset;
+    var in_braces = false;
+    while (start > text.open.start) : (start -= 1) {
+        switch (src[start - 1]) {
+            '}' => in_braces = true,
+            '{' => in_braces = false,
+            else => |c| if (!in_braces and std.ascii.isWhitespace(c)) break,
+        }
+    }
+    const abbreviation = src[start..offset];
+
+    const line_start = if (std.mem.lastIndexOfScalar(u8, src[0..start], '\n')) |nl|
+        nl + 1
+    else
+        0;
+    var indent_end = line_start;
+    while (indent_end < start and (src[indent_end] == ' ' or src[indent_end] == '\t')) {
+        indent_end += 1;
+    }
+
+    // Text before the abbreviation that is on the same line must belong to
+    // another node (e.g. `<li>ul>li`), text after it must not exist.
+    const before = src[@max(line_start, text.open.start)..start];
+    if (std.mem.trim(u8, before, " \t").len > 0) return null;
+    const line_end = std.mem.indexOfScalarPos(u8, src, offset, '\n') orelse src.len;
+    const after = src[offset..@min(line_end, text.open.end)];
+    if (std.mem.trim(u8, after, " \t\r").len > 0) return null;
+
+    const snippet = try emmet.expand(
+        arena,
+        abbreviation,
+        src[line_start..indent_end],
+        options,
+    ) orelse return null;
+
+    return .{
+        .label = abbreviation,
+        .kind = .Snippet,
+        .detail = "Emmet abbreviation",
+        .filterText = abbreviation,
+        .documentation = .{
+            .markup_content = .{
+                .kind = .markdown,
+                .value = try std.fmt.allocPrint(arena, "```html\n{s}\n```", .{snippet}),
+            },
+        },
+        .textEdit = .{
+            .text_edit = .{
+                .range = getRange(.{ .start = start, .end = offset }, src),
+                .newText = snippet,
+            },
+        },
+        .insertTextFormat = .Snippet,
+        .insertTextMode = .asIs,
+    };
+}
+
 pub fn @"textDocument/hover"(
     self: *Handler,
     arena: std.mem.Allocator,
     request: types.Hover.Params,
 ) error{OutOfMemory}!?types.Hover {
-    _ = arena;
-
-    const doc = self.files.getPtr(request.textDocument.uri) orelse return null;
+    const doc = (try self.document(arena, request.textDocument.uri)) orelse return null;
     const offset = lsp.offsets.positionToIndex(
         doc.src,
         request.position,
@@ -630,7 +1663,7 @@ pub fn tagRanges(
     /// A LSP type that has textDocument and position
     position: anytype,
 ) error{OutOfMemory}!?[]const types.Range {
-    const doc = self.files.getPtr(position.textDocument.uri) orelse return null;
+    const doc = (try self.document(arena, position.textDocument.uri)) orelse return null;
     const offset = lsp.offsets.positionToIndex(
         doc.src,
         position.position,
@@ -683,24 +1716,169 @@ pub fn tagRanges(
 
 const Command = struct {
     syntax_only: bool = false,
+    fragment: bool = false,
 
     fn parse(args: []const []const u8) Command {
-        if (args.len == 0) return .{};
-        if (args.len > 1) fatalHelp();
-        if (std.mem.eql(u8, args[0], "--syntax-only")) {
-            return .{ .syntax_only = true };
-        } else fatalHelp();
+        var cmd: Command = .{};
+        for (args) |arg| {
+            if (std.mem.eql(u8, arg, "--syntax-only")) {
+                cmd.syntax_only = true;
+            } else if (std.mem.eql(u8, arg, "--fragment")) {
+                cmd.fragment = true;
+            } else fatalHelp();
+        }
+        return cmd;
     }
 };
 
 fn fatalHelp() noreturn {
     const msg =
-        \\Usage: superhtml lsp [--syntax-only]
+        \\Usage: superhtml lsp [--syntax-only] [--fragment]
         \\
         \\The --syntax-only flag disables HTML element and attribute validation. 
+        \\The --fragment flag validates all documents as partials, like
+        \\"fragment" in the config.
     ;
 
     std.debug.print(msg, .{});
     log.err(msg, .{});
     std.process.exit(1);
 }
+
+test "emmet abbreviations on their own line" {
+    const gpa = std.testing.allocator;
+    var arena_impl = std.heap.ArenaAllocator.init(gpa);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    const src =
+        \\<div>
+        \\  ul>li
+        \\  <p>See a.b</p>
+        \\</div>
+        \\
+    ;
+    var doc = try Document.init(gpa, src, .{});
+    defer doc.deinit(gpa);
+
+    const abbreviation_end: u32 = @intCast(std.mem.indexOf(u8, src, "ul>li").? + 5);
+    const item = (try emmetCompletion(arena, &doc, abbreviation_end, .{})).?;
+    try std.testing.expectEqualStrings(
+        "<ul>\n  \t<li>${1}</li>\n  </ul>",
+        item.textEdit.?.text_edit.newText,
+    );
+
+    const prose_end: u32 = @intCast(std.mem.indexOf(u8, src, "a.b").? + 3);
+    try std.testing.expectEqual(null, try emmetCompletion(arena, &doc, prose_end, .{}));
+}
+
+test "block completions use the open layout" {
+    const gpa = std.testing.allocator;
+    var arena_impl = std.heap.ArenaAllocator.init(gpa);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    // The layout only exists as an unsaved buffer.
+    const layout_src =
+        \\<div id="main"><super></div>
+        \\<nav id="nav"><super></nav>
+    ;
+    var layout = try Document.init(gpa, layout_src, .{ .language = .superhtml });
+    defer layout.deinit(gpa);
+
+    const src =
+        \\<extend template="layout.shtml">
+        \\<div id="main"></div>
+        \\<nav id="n"></nav>
+    ;
+    var doc = try Document.init(gpa, src, .{ .language = .superhtml });
+    defer doc.deinit(gpa);
+
+    var handler: Handler = .{
+        .io = undefined,
+        .gpa = gpa,
+        .transport = undefined,
+        .syntax_only = false,
+        .fragment = false,
+    };
+    defer handler.files.deinit(gpa);
+    try handler.files.put(gpa, "file:///site/layout.shtml", layout);
+
+    const offset: u32 = @intCast(std.mem.indexOf(u8, src, "\"n\"").? + 2);
+    const items = try blockCompletions(
+        &handler,
+        arena,
+        "file:///site/page.shtml",
+        &doc,
+        offset,
+    );
+    try std.testing.expectEqual(1, items.len);
+    try std.testing.expectEqualStrings("nav", items[0].label);
+    try std.testing.expectEqualStrings("<nav> in layout.shtml", items[0].detail.?);
+}
+
+test "diagnostics of the last change of a burst are published" {
+    var arena_impl = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena_impl.deinit();
+    // Documents own their source, which is only freed when they're
+    // replaced, so let the arena collect everything.
+    const gpa = arena_impl.allocator();
+
+    const Capture = struct {
+        transport: lsp.Transport = .{ .vtable = &.{
+            .readJsonMessage = readJsonMessage,
+            .writeJsonMessage = writeJsonMessage,
+        } },
+        gpa: Allocator,
+        last: []const u8 = "",
+
+        fn readJsonMessage(_: *lsp.Transport, _: Io, _: Allocator) lsp.Transport.ReadError![]u8 {
+            unreachable;
+        }
+
+        fn writeJsonMessage(
+            transport: *lsp.Transport,
+            _: Io,
+            json_message: []const u8,
+        ) lsp.Transport.WriteError!void {
+            const capture: *@This() = @fieldParentPtr("transport", transport);
+            capture.last = capture.gpa.dupe(u8, json_message) catch unreachable;
+        }
+    };
+    var capture: Capture = .{ .gpa = gpa };
+
+    var handler: Handler = .{
+        .io = std.testing.io,
+        .gpa = gpa,
+        .transport = &capture.transport,
+        .syntax_only = false,
+        .fragment = false,
+    };
+
+    const uri = "untitled:Untitled-1";
+    try handler.@"textDocument/didOpen"(gpa, .{ .textDocument = .{
+        .uri = uri,
+        .languageId = .html,
+        .version = 0,
+        .text = "<p>Hello</p>\n",
+    } });
+
+    inline for (.{
+        "<p class=\"a\">Hello</p>\n",
+        "<p class=\"a a\">Hello</p>\n",
+    }, 1..) |text, version| {
+        try handler.@"textDocument/didChange"(gpa, .{
+            .textDocument = .{ .uri = uri, .version = version },
+            .contentChanges = &.{.{
+                .text_document_content_change_whole_document = .{ .text = text },
+            }},
+        });
+    }
+
+    // The client goes quiet.
+    while (handler.staleTimeout()) |_| handler.validateStale();
+    try std.testing.expect(!handler.files.get(uri).?.stale);
+    try std.testing.expect(
+        std.mem.indexOf(u8, capture.last, "html.attr.duplicate-class") != null,
+    );
+}
@@ -8,32 +8,53 @@ const log = std.log.scoped(.lsp_document);
 
 language: super.Language,
 src: []const u8,
+/// Owns `html` and `super_ast`.
+result: super.Validation.Result,
 html: super.html.Ast,
 super_ast: ?super.Ast = null,
+/// When `src` was last validated, if known.
+validated_at: ?std.Io.Timestamp = null,
+/// Set when `src` changed after the last validation, in which case the
+/// rest of the document still refers to the previous source.
+stale: bool = false,
 
 pub fn deinit(doc: *Document, gpa: std.mem.Allocator) void {
-    doc.html.deinit(gpa);
-    if (doc.super_ast) |s| s.deinit(gpa);
+    _ = gpa;
+    doc.result.deinit();
 }
 
 pub fn init(
     gpa: std.mem.Allocator,
     src: []const u8,
-    language: super.Language,
-    validate: bool,
+    options: super.Validation.Options,
 ) error{OutOfMemory}!Document {
-    var doc: Document = .{
+    const result = try super.validate(gpa, src, options);
+    return .{
         .src = src,
-        .language = language,
-        .html = try super.html.Ast.init(gpa, src, language, validate),
+        .language = options.language,
+        .result = result,
+        .html = result.ast,
+        .super_ast = result.template,
     };
-    errdefer doc.html.deinit(gpa);
+}
 
-    if (language == .superhtml and doc.html.errors.len == 0) {
-        const super_ast = try super.Ast.init(gpa, doc.html, src);
-        errdefer super_ast.deinit(gpa);
-        doc.super_ast = super_ast;
-    }
+/// Updates the document in place after `src[start..end]` was replaced with
+/// `new_len` bytes, see `super.html.Ast.applyTextEdit`. Returns false when
+/// the document must be reloaded instead.
+pub fn applyTextEdit(
+    doc: *Document,
+    src: []const u8,
+    start: u32,
+    end: u32,
+    new_len: u32,
+) bool {
+    if (doc.super_ast != null) return false;
+    if (!doc.html.applyTextEdit(src, start, end, new_len)) return false;
 
-    return doc;
+    const delta = @as(i64, new_len) - (end - start);
+    for (@constCast(doc.result.diagnostics)) |*d| {
+        super.html.Ast.shiftSpans(d, end, delta);
+    }
+    doc.src = src;
+    return true;
 }
@@ -0,0 +1,281 @@
+//! Expansion of Emmet abbreviations (e.g. `ul>li*3`) into HTML snippets.
+//!
+//! Supported syntax: child (`>`), sibling (`+`), multiplication (`*N`), id
+//! (`#`), class (`.`), text (`{}`) and numbering (`$`) in ids, classes and
+//! text. Elements without a name are `<div>`s.
+
+const std = @import("std");
+const Writer = std.Io.Writer;
+const super = @import("superhtml");
+const Kind = super.html.Ast.Kind;
+const RenderOptions = super.html.Ast.RenderOptions;
+
+/// Upper limit for multiplication, to keep the expansion reasonable.
+const max_count = 100;
+
+const Element = struct {
+    name: []const u8,
+    is_void: bool,
+    id: ?[]const u8 = null,
+    classes: std.ArrayList([]const u8) = .empty,
+    text: ?[]const u8 = null,
+    count: u32 = 1,
+    children: std.ArrayList(*Element) = .empty,
+};
+
+/// Returns the snippet that `abbreviation` expands to, or null if it's not a
+/// valid abbreviation. Plain tag names are not considered abbreviations as
+/// they're already covered by regular completions. Lines after the first are
+/// prefixed with `indentation`, nested elements are indented according to
+/// `options`.
+pub fn expand(
+    arena: std.mem.Allocator,
+    abbreviation: []const u8,
+    indentation: []const u8,
+    options: RenderOptions,
+) error{OutOfMemory}!?[]const u8 {
+    if (std.mem.indexOfAny(u8, abbreviation, ">+*#.{") == null) return null;
+
+    var top: std.ArrayList(*Element) = .empty;
+    var parent: ?*Element = null;
+    var idx: usize = 0;
+    while (true) {
+        const element = try parseElement(arena, abbreviation, &idx) orelse {
+            return null;
+        };
+        if (parent) |p| {
+            if (p.is_void) return null;
+            try p.children.append(arena, element);
+        } else {
+            try top.append(arena, element);
+        }
+
+        if (idx == abbreviation.len) break;
+        switch (abbreviation[idx]) {
+            '>' => parent = element,
+            '+' => {},
+            else => return null,
+        }
+        idx += 1;
+    }
+
+    var aw: Writer.Allocating = .init(arena);
+    var r: Renderer = .{
+        .w = &aw.writer,
+        .indentation = indentation,
+        .options = options,
+    };
+    r.renderList(top.items, 0, 1) catch return error.OutOfMemory;
+    return aw.written();
+}
+
+fn parseElement(
+    arena: std.mem.Allocator,
+    abbreviation: []const u8,
+    idx: *usize,
+) error{OutOfMemory}!?*Element {
+    const name_start = idx.*;
+    while (idx.* < abbreviation.len) : (idx.* += 1) {
+        const c = abbreviation[idx.*];
+        if (!std.ascii.isAlphanumeric(c) and c != '-') break;
+    }
+
+    const name = abbreviation[name_start..idx.*];
+    const kind: Kind = if (name.len == 0) blk: {
+        if (idx.* == abbreviation.len) return null;
+        switch (abbreviation[idx.*]) {
+            '#', '.' => break :blk .div,
+            else => return null,
+        }
+    } else std.meta.stringToEnum(Kind, name) orelse return null;
+
+    // Only HTML elements are supported.
+    if (@intFromEnum(kind) <= @intFromEnum(Kind.___)) return null;
+
+    const element = try arena.create(Element);
+    element.* = .{
+        .name = @tagName(kind),
+        .is_void = kind.isVoid(),
+    };
+
+    while (idx.* < abbreviation.len) {
+        switch (abbreviation[idx.*]) {
+            '#' => {
+                idx.* += 1;
+                element.id = readName(abbreviation, idx) orelse return null;
+            },
+            '.' => {
+                idx.* += 1;
+                const class = readName(abbreviation, idx) orelse return null;
+                try element.classes.append(arena, class);
+            },
+            '{' => {
+                const end = std.mem.indexOfScalarPos(
+                    u8,
+                    abbreviation,
+                    idx.*,
+                    '}',
+                ) orelse return null;
+                element.text = abbreviation[idx.* + 1 .. end];
+                idx.* = end + 1;
+            },
+            '*' => {
+                idx.* += 1;
+                const start = idx.*;
+                while (idx.* < abbreviation.len and
+                    std.ascii.isDigit(abbreviation[idx.*])) idx.* += 1;
+                const count = std.fmt.parseInt(
+                    u32,
+                    abbreviation[start..idx.*],
+                    10,
+                ) catch return null;
+                if (count == 0 or count > max_count) return null;
+                element.count = count;
+            },
+            else => break,
+        }
+    }
+
+    return element;
+}
+
+fn readName(abbreviation: []const u8, idx: *usize) ?[]const u8 {
+    const start = idx.*;
+    while (idx.* < abbreviation.len) : (idx.* += 1) {
+        switch (abbreviation[idx.*]) {
+            '>', '+', '*', '#', '.', '{', '}', '"', '\'', '<' => break,
+            else => if (std.ascii.isWhitespace(abbreviation[idx.*])) break,
+        }
+    }
+    if (idx.* == start) return null;
+    return abbreviation[start..idx.*];
+}
+
+const Renderer = struct {
+    w: *Writer,
+    indentation: []const u8,
+    options: RenderOptions,
+    first: bool = true,
+    /// Next snippet tabstop.
+    tabstop: u32 = 1,
+
+    fn renderList(
+        r: *Renderer,
+        elements: []const *Element,
+        depth: usize,
+        number: u32,
+    ) Writer.Error!void {
+        for (elements) |element| {
+            for (1..element.count + 1) |n| {
+                const num: u32 = if (element.count > 1) @intCast(n) else number;
+                try r.render(element, depth, num);
+            }
+        }
+    }
+
+    fn render(
+        r: *Renderer,
+        element: *const Element,
+        depth: usize,
+        number: u32,
+    ) Writer.Error!void {
+        try r.newline(depth);
+
+        try r.w.print("<{s}", .{element.name});
+        if (element.id) |id| {
+            try r.w.writeAll(" id=\"");
+            try r.writeNumbered(id, number);
+            try r.w.writeAll("\"");
+        }
+        if (element.classes.items.len > 0) {
+            try r.w.writeAll(" class=\"");
+            for (element.classes.items, 0..) |class, idx| {
+                if (idx > 0) try r.w.writeAll(" ");
+                try r.writeNumbered(class, number);
+            }
+            try r.w.writeAll("\"");
+        }
+        try r.w.writeAll(">");
+
+        if (element.is_void) return;
+
+        if (element.children.items.len > 0) {
+            if (element.text) |text| {
+                try r.newline(depth + 1);
+                try r.writeNumbered(text, number);
+            }
+            try r.renderList(element.children.items, depth + 1, number);
+            try r.newline(depth);
+        } else if (element.text) |text| {
+            try r.writeNumbered(text, number);
+        } else {
+            try r.w.print("${{{}}}", .{r.tabstop});
+            r.tabstop += 1;
+        }
+
+        try r.w.print("</{s}>", .{element.name});
+    }
+
+    fn newline(r: *Renderer, depth: usize) Writer.Error!void {
+        if (r.first) {
+            r.first = false;
+            return;
+        }
+
+        try r.w.writeAll("\n");
+        try r.w.writeAll(r.indentation);
+        try r.options.writeIndentation(r.w, depth);
+    }
+
+    /// Writes `str` escaped for use in a snippet, replacing each run of `$`
+    /// with `number`, zero-padded to the length of the run.
+    fn writeNumbered(r: *Renderer, str: []const u8, number: u32) Writer.Error!void {
+        var idx: usize = 0;
+        while (idx < str.len) {
+            switch (str[idx]) {
+                '$' => {
+                    const start = idx;
+                    while (idx < str.len and str[idx] == '$') idx += 1;
+                    var buf: [10]u8 = undefined;
+                    const digits = std.fmt.bufPrint(&buf, "{}", .{number}) catch unreachable;
+                    const width = idx - start;
+                    if (width > digits.len) {
+                        for (0..width - digits.len) |_| try r.w.writeAll("0");
+                    }
+                    try r.w.writeAll(digits);
+                    continue;
+                },
+                '\\', '}' => try r.w.print("\\{c}", .{str[idx]}),
+                else => try r.w.writeByte(str[idx]),
+            }
+            idx += 1;
+        }
+    }
+};
+
+test "expand" {
+    var arena_impl = std.heap.ArenaAllocator.init(std.testing.allocator);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    try std.testing.expectEqual(null, try expand(arena, "div", "", .{}));
+    try std.testing.expectEqual(null, try expand(arena, "e.g", "", .{}));
+    try std.testing.expectEqual(null, try expand(arena, "br>p", "", .{}));
+
+    try std.testing.expectEqualStrings(
+        \\<ul>
+        \\	<li class="item1">${1}</li>
+        \\	<li class="item2">${2}</li>
+        \\</ul>
+    , (try expand(arena, "ul>li.item$*2", "", .{})).?);
+
+    try std.testing.expectEqualStrings(
+        \\<div id="main">
+        \\    <p>Hello</p>
+        \\    <hr>
+        \\  </div>
+    , (try expand(arena, "#main>p{Hello}+hr", "  ", .{
+        .indent_style = .space,
+        .indent_width = 2,
+    })).?);
+}
@@ -5,6 +5,8 @@ const lsp_namespace = @import("../lsp.zig");
 const Handler = lsp_namespace.Handler;
 const getRange = Handler.getRange;
 const Document = @import("Document.zig");
+const Config = @import("../Config.zig");
+const TemplateLoader = @import("../TemplateLoader.zig");
 
 const log = std.log.scoped(.logic);
 
@@ -17,17 +19,21 @@ pub fn loadFile(
 ) !void {
     errdefer @panic("error while loading document!");
 
-    var res: lsp.types.publish_diagnostics.Params = .{
-        .uri = uri,
-        .diagnostics = &.{},
-    };
-
-    const doc = try Document.init(
-        self.gpa,
-        new_text,
-        language,
-        self.syntax_only,
-    );
+    const config = try loadConfig(self, arena, uri);
+    const path = try uriPath(arena, uri);
+    var templates: TemplateLoader = .{ .io = self.io, .path = path };
+    const doc = try Document.init(self.gpa, new_text, .{
+        .language = language,
+        .syntax_only = self.syntax_only,
+        .fragment = self.fragment or config.fragment,
+        .superhtml_validation = config.superhtml_validation,
+        .rules = config.rules,
+        .max_attributes = config.max_attributes,
+        .max_depth = config.max_depth,
+        .void_element_style = config.void_element_style,
+        // Only documents on disk can extend other templates.
+        .loader = if (path != null) templates.loader() else null,
+    });
 
     log.debug("document init", .{});
 
@@ -41,104 +47,54 @@ pub fn loadFile(
     }
 
     gop.value_ptr.* = doc;
+    gop.value_ptr.validated_at = std.Io.Clock.awake.now(self.io) catch null;
 
-    if (doc.html.errors.len != 0) {
-        const diags = try arena.alloc(lsp.types.Diagnostic, doc.html.errors.len);
-        for (doc.html.errors, diags) |err, *d| {
-            const range = getRange(err.main_location, doc.src);
-            d.* = .{
-                .range = range,
-                .severity = switch (err.tag) {
-                    .unsupported_doctype, .duplicate_class => .Warning,
-                    else => .Error,
-                },
-                .message = try std.fmt.allocPrint(arena, "{f}", .{err.tag.fmt(doc.src)}),
-                .code = .{ .string = @tagName(err.tag) },
-                .source = if (err.tag == .token) "html tokenizer" else "html parser",
-                .relatedInformation = switch (err.tag) {
-                    else => null,
-                    .duplicate_id => |span| try arena.dupe(
-                        lsp.types.Diagnostic.RelatedInformation,
-                        &.{
-                            .{
-                                .location = .{ .uri = uri, .range = getRange(
-                                    span,
-                                    doc.src,
-                                ) },
-                                .message = "original",
-                            },
-                        },
-                    ),
-                    .duplicate_class => |span| try arena.dupe(
-                        lsp.types.Diagnostic.RelatedInformation,
-                        &.{
-                            .{
-                                .location = .{ .uri = uri, .range = getRange(
-                                    span,
-                                    doc.src,
-                                ) },
-                                .message = "original",
-                            },
-                        },
-                    ),
-                    .duplicate_attribute_name => |span| try arena.dupe(
-                        lsp.types.Diagnostic.RelatedInformation,
-                        &.{
-                            .{
-                                .location = .{ .uri = uri, .range = getRange(
-                                    span,
-                                    doc.src,
-                                ) },
-                                .message = "original",
-                            },
-                        },
-                    ),
-                    .duplicate_child => |dc| try arena.dupe(
-                        lsp.types.Diagnostic.RelatedInformation,
-                        &.{
-                            .{
-                                .location = .{ .uri = uri, .range = getRange(
-                                    dc.span,
-                                    doc.src,
-                                ) },
-                                .message = "original",
-                            },
-                        },
-                    ),
-                    .invalid_nesting => |in| try arena.dupe(
-                        lsp.types.Diagnostic.RelatedInformation,
-                        &.{
-                            .{
-                                .location = .{ .uri = uri, .range = getRange(
-                                    in.span,
-                                    doc.src,
-                                ) },
-                                .message = in.reason,
-                            },
+    try publishDiagnostics(self, arena, uri, doc);
+}
+
+pub fn publishDiagnostics(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    uri: []const u8,
+    doc: Document,
+) !void {
+    const diagnostics = doc.result.diagnostics;
+    const diags = try arena.alloc(lsp.types.Diagnostic, diagnostics.len);
+    for (diagnostics, diags) |diag, *d| {
+        d.* = .{
+            .range = getRange(diag.span, doc.src),
+            .severity = switch (diag.severity) {
+                .warning => .Warning,
+                .info => .Information,
+                .@"error" => .Error,
+            },
+            .message = diag.message,
+            .code = .{ .string = diag.code },
+            .source = if (std.mem.startsWith(u8, diag.code, "html.syntax."))
+                "html tokenizer"
+            else if (std.mem.startsWith(u8, diag.code, "superhtml."))
+                "superhtml"
+            else
+                "html parser",
+            .relatedInformation = if (diag.note) |note| try arena.dupe(
+                lsp.types.Diagnostic.RelatedInformation,
+                &.{
+                    .{
+                        .location = .{
+                            .uri = uri,
+                            .range = getRange(note.span, doc.src),
                         },
-                    ),
+                        .message = note.message,
+                    },
                 },
-            };
-        }
-        res.diagnostics = diags;
-    } else {
-        if (doc.super_ast) |super_ast| {
-            const diags = try arena.alloc(
-                lsp.types.Diagnostic,
-                super_ast.errors.len,
-            );
-            for (super_ast.errors, diags) |err, *d| {
-                const range = getRange(err.main_location, doc.src);
-                d.* = .{
-                    .range = range,
-                    .severity = .Error,
-                    .message = err.kind.message(),
-                };
-            }
-            res.diagnostics = diags;
-        }
+            ) else null,
+        };
     }
 
+    const res: lsp.types.publish_diagnostics.Params = .{
+        .uri = uri,
+        .diagnostics = diags,
+    };
     try self.transport.writeNotification(
         self.io,
         self.gpa,
@@ -148,3 +104,189 @@ pub fn loadFile(
         .{ .emit_null_optional_fields = false },
     );
 }
+
+/// Returns the path of the document, or null if it doesn't live on disk.
+pub fn uriPath(arena: std.mem.Allocator, uri: []const u8) !?[]const u8 {
+    const parsed = std.Uri.parse(uri) catch return null;
+    if (!std.mem.eql(u8, parsed.scheme, "file")) return null;
+    return try parsed.path.toRawMaybeAlloc(arena);
+}
+
+pub fn fileUri(arena: std.mem.Allocator, path: []const u8) ![]const u8 {
+    const uri: std.Uri = .{
+        .scheme = "file",
+        .host = .{ .raw = "" },
+        .path = .{ .raw = path },
+    };
+    return std.fmt.allocPrint(arena, "{f}", .{uri});
+}
+
+/// Loads the template extended by `doc`, if any. Returns null when the
+/// template can't be loaded or is invalid, in which case the document has a
+/// diagnostic about it. Open documents are used as they are in the editor,
+/// templates on disk are cached until they change.
+pub fn loadLayout(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    uri: []const u8,
+    doc: *const Document,
+) !?super.Validation.Layout {
+    const super_ast = doc.super_ast orelse return null;
+    const template = super_ast.extendTemplate() orelse return null;
+    const path = try uriPath(arena, uri) orelse return null;
+    const layout_path = try std.fs.path.resolve(arena, &.{
+        std.fs.path.dirname(path) orelse ".",
+        template.slice(doc.src),
+    });
+
+    var it = self.files.iterator();
+    while (it.next()) |entry| {
+        const open_path = try uriPath(arena, entry.key_ptr.*) orelse continue;
+        if (!std.mem.eql(u8, open_path, layout_path)) continue;
+
+        const layout_doc = entry.value_ptr;
+        if (layout_doc.stale) return super.Validation.Layout.parse(arena, .{
+            .path = layout_path,
+            .src = try arena.dupeZ(u8, layout_doc.src),
+        });
+
+        const layout_ast = layout_doc.super_ast orelse return null;
+        if (layout_doc.html.has_syntax_errors or layout_ast.errors.len > 0) {
+            return null;
+        }
+        return .{
+            .path = layout_path,
+            .src = layout_doc.src,
+            .html = layout_doc.html,
+            .ast = layout_ast,
+        };
+    }
+
+    const stat = std.Io.Dir.cwd().statFile(self.io, layout_path, .{}) catch {
+        if (self.layouts.fetchRemove(layout_path)) |kv| {
+            self.gpa.free(kv.key);
+            kv.value.arena.deinit();
+        }
+        return null;
+    };
+    if (self.layouts.get(layout_path)) |cached| {
+        if (std.meta.eql(cached.mtime, stat.mtime)) return cached.layout;
+    }
+
+    var layout_arena: std.heap.ArenaAllocator = .init(self.gpa);
+    errdefer layout_arena.deinit();
+
+    var templates: TemplateLoader = .{ .io = self.io, .path = path };
+    const layout: ?super.Validation.Layout = if (try templates.loader().load(
+        layout_arena.allocator(),
+        null,
+        template.slice(doc.src),
+    )) |loaded|
+        try super.Validation.Layout.parse(layout_arena.allocator(), loaded)
+    else
+        null;
+
+    const gop = try self.layouts.getOrPut(self.gpa, layout_path);
+    if (gop.found_existing) {
+        gop.value_ptr.arena.deinit();
+    } else {
+        gop.key_ptr.* = self.gpa.dupe(u8, layout_path) catch |err| {
+            self.layouts.removeByPtr(gop.key_ptr);
+            return err;
+        };
+    }
+    gop.value_ptr.* = .{
+        .arena = layout_arena,
+        .layout = layout,
+        .mtime = stat.mtime,
+    };
+    return layout;
+}
+
+pub const CachedLayout = struct {
+    /// Owns `layout`.
+    arena: std.heap.ArenaAllocator,
+    /// Null when the template is invalid.
+    layout: ?super.Validation.Layout,
+    /// Modification time of the template when it was loaded.
+    mtime: Mtime,
+};
+
+/// Loads the `.superhtml.json` closest to the document. Only works for
+/// documents that live on disk, other documents get the default config.
+/// Configs are cached per directory until the config file changes.
+pub fn loadConfig(
+    self: *Handler,
+    arena: std.mem.Allocator,
+    uri: []const u8,
+) !Config {
+    const path = try uriPath(arena, uri) orelse return .{};
+    const dir_path = std.fs.path.dirname(path) orelse return .{};
+
+    if (self.configs.get(dir_path)) |cached| {
+        if (std.meta.eql(cached.mtime, configMtime(self.io, cached.config))) {
+            return cached.config;
+        }
+    }
+
+    var config_arena: std.heap.ArenaAllocator = .init(self.gpa);
+    errdefer config_arena.deinit();
+
+    var diag: []const u8 = "";
+    const config = Config.load(
+        self.io,
+        config_arena.allocator(),
+        dir_path,
+        &diag,
+    ) catch |err| switch (err) {
+        error.OutOfMemory => return error.OutOfMemory,
+        error.InvalidConfig => {
+            log.err("{s}", .{diag});
+            config_arena.deinit();
+            return .{};
+        },
+    };
+
+    const gop = try self.configs.getOrPut(self.gpa, dir_path);
+    if (gop.found_existing) {
+        gop.value_ptr.arena.deinit();
+    } else {
+        gop.key_ptr.* = self.gpa.dupe(u8, dir_path) catch |err| {
+            self.configs.removeByPtr(gop.key_ptr);
+            return err;
+        };
+    }
+    gop.value_ptr.* = .{
+        .arena = config_arena,
+        .config = config,
+        .mtime = configMtime(self.io, config),
+    };
+    return config;
+}
+
+pub const CachedConfig = struct {
+    /// Owns `config`.
+    arena: std.heap.ArenaAllocator,
+    config: Config,
+    /// Modification time of `config.path` when it was loaded, null when
+    /// no config file was found.
+    mtime: ?Mtime,
+};
+
+const Mtime = @FieldType(std.Io.File.Stat, "mtime");
+
+fn configMtime(io: std.Io, config: Config) ?Mtime {
+    const path = config.path orelse return null;
+    const stat = std.Io.Dir.cwd().statFile(io, path, .{}) catch return null;
+    return stat.mtime;
+}
+
+/// Forgets all cached configs.
+pub fn clearConfigs(self: *Handler) void {
+    var it = self.configs.iterator();
+    while (it.next()) |entry| {
+        self.gpa.free(entry.key_ptr.*);
+        entry.value_ptr.arena.deinit();
+    }
+    self.configs.clearRetainingCapacity();
+}
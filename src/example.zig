@@ -37,7 +37,7 @@ test ExampleVM {
         \\<a href="$site.link()" :text="$site.name"></a>
     ;
 
-    const layout_html_ast: superhtml.html.Ast = try .init(arena, layout_src, .superhtml, false);
+    const layout_html_ast: superhtml.html.Ast = try .init(arena, layout_src, .superhtml, .{});
     try std.testing.expectEqual(0, layout_html_ast.errors.len);
 
     const layout_super_ast: superhtml.Ast = try .init(arena, layout_html_ast, layout_src);
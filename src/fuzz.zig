@@ -186,14 +186,14 @@ test "fuzz case" {
     defer std.testing.allocator.free(case);
     try std.base64.standard.Decoder.decode(case, case_b64);
 
-    const ast: Ast = try .init(std.testing.allocator, case, .html, false);
+    const ast: Ast = try .init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     if (!ast.has_syntax_errors) {
         var fmt_out: Io.Writer.Allocating = .init(std.testing.allocator);
         defer fmt_out.deinit();
 
-        try ast.render(case, &fmt_out.writer);
+        try ast.render(case, &fmt_out.writer, .{});
     }
 }
 
@@ -229,14 +229,14 @@ test "fuzz" {
             // try std.base64.standard.Encoder.encodeWriter(l, case.written());
             // try l.print("\n{s}\n---\n\n", .{case.written()});
 
-            const ast: Ast = try .init(std.testing.allocator, case.written(), .html, false);
+            const ast: Ast = try .init(std.testing.allocator, case.written(), .html, .{});
             defer ast.deinit(std.testing.allocator);
 
             if (!ast.has_syntax_errors) {
                 var fmt_out: Io.Writer.Allocating = .init(std.testing.allocator);
                 defer fmt_out.deinit();
 
-                try ast.render(case.written(), &fmt_out.writer);
+                try ast.render(case.written(), &fmt_out.writer, .{});
             }
         }
     }.fuzz, .{});
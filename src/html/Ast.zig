@@ -15,6 +15,8 @@ const Element = @import("Element.zig");
 const elements = Element.all;
 const kinds = Element.elements;
 const Attribute = @import("Attribute.zig");
+const foreign = @import("foreign.zig");
+const script = @import("elements/script.zig");
 
 const log = std.log.scoped(.@"html/ast");
 const fmtlog = std.log.scoped(.@"html/ast/fmt");
@@ -102,38 +104,6 @@ pub const rawtext_names = Set.initComptime(.{
     .{ "noscript", {} },
 });
 
-pub const unsupported_names = Set.initComptime(.{
-    .{ "applet", {} },
-    .{ "acronym", {} },
-    .{ "bgsound", {} },
-    .{ "dir", {} },
-    .{ "frame", {} },
-    .{ "frameset", {} },
-    .{ "noframes", {} },
-    .{ "isindex", {} },
-    .{ "keygen", {} },
-    .{ "listing", {} },
-    .{ "menuitem", {} },
-    .{ "nextid", {} },
-    .{ "noembed", {} },
-    .{ "param", {} },
-    .{ "plaintext", {} },
-    .{ "rb", {} },
-    .{ "rtc", {} },
-    .{ "strike", {} },
-    .{ "xmp", {} },
-    .{ "basefont", {} },
-    .{ "big", {} },
-    .{ "blink", {} },
-    .{ "center", {} },
-    .{ "font", {} },
-    .{ "marquee", {} },
-    .{ "multicol", {} },
-    .{ "nobr", {} },
-    .{ "spacer", {} },
-    .{ "tt", {} },
-});
-
 pub const Node = struct {
     /// Span covering start_tag, diamond brackets included
     open: Span,
@@ -209,6 +179,36 @@ pub const Node = struct {
         };
     }
 
+    /// Returns the value of the first attribute called `name` (case
+    /// insensitive), or null if the attribute is missing or has no value.
+    pub fn attrValue(
+        n: Node,
+        src: []const u8,
+        language: Language,
+        name: []const u8,
+    ) ?Span {
+        if (!n.kind.isElement()) return null;
+        var it = n.startTagIterator(src, language);
+        while (it.next(src)) |attr| {
+            if (!std.ascii.eqlIgnoreCase(attr.name.slice(src), name)) continue;
+            const value = attr.value orelse return null;
+            return value.span;
+        }
+        return null;
+    }
+
+    /// Returns the tag name of the end tag, the node must have one.
+    pub fn endTagName(n: Node, src: []const u8) Span {
+        assert(n.close.start != 0);
+        const start = n.close.start + "</".len;
+        var end = start;
+        while (end < n.close.end) : (end += 1) switch (src[end]) {
+            '>', '/', ' ', '\t', '\n', '\r', '\x0c' => break,
+            else => {},
+        };
+        return .{ .start = start, .end = end };
+    }
+
     pub fn span(n: Node, src: []const u8) Span {
         if (n.kind.isElement()) {
             return n.startTagIterator(src, .html).name_span;
@@ -247,6 +247,10 @@ pub const Error = struct {
         },
         invalid_attr_value: struct {
             reason: []const u8 = "",
+            /// Allowed values of enumerated attributes.
+            expected: []const Completion = &.{},
+            /// The allowed value closest to the invalid one.
+            suggestion: ?[]const u8 = null,
         },
 
         /// Only use for static limits
@@ -256,6 +260,7 @@ pub const Error = struct {
         invalid_attr_combination: []const u8, // reason
         duplicate_class: Span, // original
         missing_required_attr: []const u8,
+        missing_alt,
         wrong_position: enum { first, second, first_or_last },
         missing_ancestor: Kind,
         missing_child: Kind,
@@ -277,13 +282,30 @@ pub const Error = struct {
         },
         invalid_html_tag_name,
         html_elements_cant_self_close,
-        missing_end_tag,
+        missing_end_tag: Span, // where the end tag was expected
         erroneous_end_tag,
         void_end_tag,
         duplicate_attribute_name: Span, // original attribute
         duplicate_sibling_attr: Span, // original attribute in another element
         duplicate_id: Span, // original location
-        deprecated_and_unsupported,
+        deprecated_and_unsupported: []const u8, // suggested replacement
+        label_for_not_found,
+        label_for_not_labelable: Span, // id of the referenced element
+        heading_level_skipped: Span, // tag name of the previous heading
+        unused_suppression,
+        input_type_mismatch: []const u8, // value of [type]
+        invalid_foreign_tag_name: foreign.Name,
+        invalid_foreign_attr: foreign.Name,
+        missing_charset,
+        late_charset,
+        empty_link,
+        mismatched_tag_case: Span, // tag name of the start tag
+        missing_dimensions,
+        id_not_found,
+        too_many_attributes: struct { count: u32, max: u32 },
+        nesting_too_deep: struct { depth: u32, max: u32 },
+        uppercase_name,
+        missing_self_closing_slash,
 
         const Tag = @This();
         pub fn fmt(tag: Tag, src: []const u8) Tag.Formatter {
@@ -312,6 +334,19 @@ pub const Error = struct {
                         if (iav.reason.len > 0) {
                             try w.print(": {s}", .{iav.reason});
                         }
+                        if (iav.suggestion) |suggestion| {
+                            try w.print(", did you mean '{s}'?", .{suggestion});
+                        }
+                        var first = true;
+                        for (iav.expected) |c| {
+                            if (c.value != null) continue;
+                            try w.print("{s}'{s}'", .{
+                                if (first) " (valid values: " else ", ",
+                                c.label,
+                            });
+                            first = false;
+                        }
+                        if (!first) try w.print(")", .{});
                     },
                     .int_out_of_bounds => |ioob| {
                         try w.print(
@@ -327,12 +362,17 @@ pub const Error = struct {
                         "missing required attribute(s): {s}",
                         .{attr},
                     ),
+                    .missing_alt => w.print(
+                        "missing 'alt' attribute, use alt=\"\" for decorative images " ++
+                            "(https://html.spec.whatwg.org/multipage/images.html#alt)",
+                        .{},
+                    ),
                     .missing_attr_value => w.print(
                         "missing attribute value",
                         .{},
                     ),
                     .boolean_attr => w.print(
-                        "this attribute cannot have a value",
+                        "boolean attributes can only have an empty value or their own name as value",
                         .{},
                     ),
                     .duplicate_class => w.print(
@@ -376,10 +416,16 @@ pub const Error = struct {
                         "html elements can't self-close",
                         .{},
                     ),
-                    .missing_end_tag => w.print("missing end tag", .{}),
+                    .missing_end_tag => w.print(
+                        "unclosed element, missing end tag",
+                        .{},
+                    ),
                     .erroneous_end_tag => w.print("erroneous end tag", .{}),
                     .void_end_tag => w.print("void elements have no end tag", .{}),
-                    .duplicate_attribute_name => w.print("duplicate attribute name", .{}),
+                    .duplicate_attribute_name => w.print(
+                        "duplicate attribute name, only the first occurrence is used",
+                        .{},
+                    ),
                     .duplicate_sibling_attr => w.print(
                         "duplicate attribute name across sibling elements",
                         .{},
@@ -388,13 +434,354 @@ pub const Error = struct {
                         "duplicate id value",
                         .{},
                     ),
-                    .deprecated_and_unsupported => w.print("deprecated and unsupported", .{}),
+                    .deprecated_and_unsupported => |replacement| {
+                        try w.print("obsolete element", .{});
+                        if (replacement.len > 0) {
+                            try w.print(", use {s} instead", .{replacement});
+                        }
+                        try w.print(
+                            " (https://html.spec.whatwg.org/multipage/obsolete.html#non-conforming-features)",
+                            .{},
+                        );
+                    },
+                    .label_for_not_found => w.print(
+                        "no element with this id",
+                        .{},
+                    ),
+                    .label_for_not_labelable => w.print(
+                        "the referenced element is not a labelable form control",
+                        .{},
+                    ),
+                    .heading_level_skipped => |previous| w.print(
+                        "heading level skipped, the previous heading is <{s}> (https://html.spec.whatwg.org/multipage/sections.html#headings-and-outlines)",
+                        .{previous.slice(tf.src)},
+                    ),
+                    .unused_suppression => w.print(
+                        "this suppression comment doesn't silence any diagnostic",
+                        .{},
+                    ),
+                    .input_type_mismatch => |input_type| w.print(
+                        "attribute has no effect when [type] is '{s}'",
+                        .{input_type},
+                    ),
+                    .missing_charset => w.print(
+                        "missing character encoding declaration, add <meta charset=\"utf-8\"> to <head>",
+                        .{},
+                    ),
+                    .late_charset => w.print(
+                        "the character encoding declaration must be within the first {} bytes of the document",
+                        .{charset_max_offset},
+                    ),
+                    .mismatched_tag_case => |start_name| w.print(
+                        "end tag doesn't match the case of <{s}>, this is valid HTML but inconsistent",
+                        .{start_name.slice(tf.src)},
+                    ),
+                    .empty_link => w.print(
+                        "link without text or accessible name, add text content, [aria-label] or an image with [alt]",
+                        .{},
+                    ),
+                    .id_not_found => w.print(
+                        "no element with this id",
+                        .{},
+                    ),
+                    .missing_dimensions => w.print(
+                        "missing [width] and [height], the layout shifts when the content loads (https://web.dev/articles/optimize-cls#images-without-dimensions)",
+                        .{},
+                    ),
+                    .too_many_attributes => |limit| w.print(
+                        "element has {} attributes, more than the maximum of {}",
+                        .{ limit.count, limit.max },
+                    ),
+                    .nesting_too_deep => |limit| w.print(
+                        "element is nested {} levels deep, more than the maximum of {}",
+                        .{ limit.depth, limit.max },
+                    ),
+                    .uppercase_name => w.print(
+                        "uppercase name, this is valid HTML but names are usually lowercase",
+                        .{},
+                    ),
+                    .missing_self_closing_slash => w.print(
+                        "void elements must self-close in the configured style (void-element-style: xhtml)",
+                        .{},
+                    ),
+                    .invalid_foreign_tag_name => |name| {
+                        try w.print("not a valid {s} element", .{
+                            name.namespace.label(),
+                        });
+                        if (name.suggestion) |s| {
+                            try w.print(" (names are case-sensitive, did you mean '{s}'?)", .{s});
+                        }
+                    },
+                    .invalid_foreign_attr => |name| {
+                        try w.print("not a valid {s} attribute", .{
+                            name.namespace.label(),
+                        });
+                        if (name.suggestion) |s| {
+                            try w.print(" (names are case-sensitive, did you mean '{s}'?)", .{s});
+                        }
+                    },
                 };
             }
         };
     },
     main_location: Span,
     node_idx: u32, // 0 = missing node
+    severity: Severity = .@"error",
+
+    pub const Severity = enum { @"error", warning, info };
+
+    /// A secondary location relevant to an error.
+    pub const Note = struct {
+        message: []const u8,
+        span: Span,
+    };
+
+    pub fn note(err: Error) ?Note {
+        return switch (err.tag) {
+            else => null,
+            .duplicate_id,
+            .duplicate_attribute_name,
+            .duplicate_class,
+            => |original| .{
+                .message = "first used here",
+                .span = original,
+            },
+            .duplicate_child => |dc| .{
+                .message = "first used here",
+                .span = dc.span,
+            },
+            .invalid_nesting => |in| .{
+                .message = "not allowed inside of this element",
+                .span = in.span,
+            },
+            .label_for_not_labelable => |id| .{
+                .message = "referenced element",
+                .span = id,
+            },
+            .heading_level_skipped => |previous| .{
+                .message = "previous heading",
+                .span = previous,
+            },
+            .missing_end_tag => |expected| .{
+                .message = "end tag expected here",
+                .span = expected,
+            },
+        };
+    }
+
+    /// Returns the rule that reported this error, or null for syntax errors
+    /// (which can't be disabled).
+    pub fn rule(err: Error) ?Rule {
+        return switch (err.tag) {
+            .token,
+            .missing_end_tag,
+            .erroneous_end_tag,
+            .void_end_tag,
+            => null,
+            .unsupported_doctype => .doctype,
+            .invalid_html_tag_name,
+            .invalid_foreign_tag_name,
+            => .@"unknown-element",
+            .invalid_attr,
+            .invalid_foreign_attr,
+            => .@"unknown-attribute",
+            .invalid_attr_nesting,
+            .invalid_attr_value,
+            .int_out_of_bounds,
+            .missing_attr_value,
+            .boolean_attr,
+            .invalid_attr_combination,
+            => .attribute,
+            .missing_required_attr => .@"required-attribute",
+            .missing_alt => .@"img-alt",
+            .duplicate_attribute_name,
+            .duplicate_sibling_attr,
+            => .@"duplicate-attribute",
+            .duplicate_class => .@"duplicate-class",
+            .duplicate_id => .@"duplicate-id",
+            .wrong_position,
+            .missing_ancestor,
+            .missing_child,
+            .duplicate_child,
+            .wrong_sibling_sequence,
+            .invalid_nesting,
+            => .nesting,
+            .html_elements_cant_self_close,
+            .missing_self_closing_slash,
+            => .@"self-closing",
+            .deprecated_and_unsupported => .@"obsolete-element",
+            .label_for_not_found,
+            .label_for_not_labelable,
+            => .@"label-for",
+            .heading_level_skipped => .@"heading-order",
+            .unused_suppression => .@"unused-suppression",
+            .input_type_mismatch => .@"input-type",
+            .missing_charset,
+            .late_charset,
+            => .charset,
+            .empty_link => .@"link-name",
+            .mismatched_tag_case => .@"tag-case",
+            .missing_dimensions => .dimensions,
+            .id_not_found => .@"id-reference",
+            .too_many_attributes => .@"max-attributes",
+            .nesting_too_deep => .@"max-depth",
+            .uppercase_name => .@"name-case",
+        };
+    }
+
+    /// Returns a stable identifier for this kind of error, meant to be
+    /// referenced by tools and users. Never change an existing code.
+    pub fn code(err: Error) []const u8 {
+        return switch (err.tag) {
+            // Named after the parse errors defined in the HTML spec.
+            .token => |terr| switch (terr) {
+                inline else => |t| "html.syntax." ++ comptime kebabCase(@tagName(t)),
+            },
+            .unsupported_doctype => "html.doctype.unsupported",
+            .invalid_attr => "html.attr.unknown",
+            .invalid_attr_nesting => "html.attr.invalid-nesting",
+            .invalid_attr_value => "html.attr.invalid-value",
+            .int_out_of_bounds => "html.attr.out-of-bounds",
+            .missing_attr_value => "html.attr.missing-value",
+            .boolean_attr => "html.attr.boolean",
+            .invalid_attr_combination => "html.attr.invalid-combination",
+            .missing_required_attr => "html.attr.missing-required",
+            .missing_alt => "html.attr.missing-alt",
+            .duplicate_attribute_name => "html.attr.duplicate",
+            .duplicate_sibling_attr => "html.attr.duplicate-sibling",
+            .duplicate_class => "html.attr.duplicate-class",
+            .duplicate_id => "html.attr.duplicate-id",
+            .wrong_position => "html.nesting.wrong-position",
+            .missing_ancestor => "html.nesting.missing-ancestor",
+            .missing_child => "html.nesting.missing-child",
+            .duplicate_child => "html.nesting.duplicate-child",
+            .wrong_sibling_sequence => "html.nesting.wrong-sibling-sequence",
+            .invalid_nesting => "html.nesting.invalid-child",
+            .invalid_html_tag_name => "html.element.unknown",
+            .html_elements_cant_self_close => "html.element.self-closing",
+            .missing_end_tag => "html.element.missing-end-tag",
+            .erroneous_end_tag => "html.element.erroneous-end-tag",
+            .void_end_tag => "html.element.void-end-tag",
+            .deprecated_and_unsupported => "html.element.obsolete",
+            .label_for_not_found => "html.label.for-not-found",
+            .label_for_not_labelable => "html.label.for-not-labelable",
+            .heading_level_skipped => "html.heading.level-skipped",
+            .unused_suppression => "html.suppression.unused",
+            .input_type_mismatch => "html.attr.input-type-mismatch",
+            .invalid_foreign_tag_name => "html.foreign.unknown-element",
+            .invalid_foreign_attr => "html.foreign.unknown-attribute",
+            .missing_charset => "html.meta.missing-charset",
+            .late_charset => "html.meta.late-charset",
+            .empty_link => "html.link.missing-name",
+            .mismatched_tag_case => "html.element.mismatched-case",
+            .missing_dimensions => "html.attr.missing-dimensions",
+            .id_not_found => "html.attr.id-not-found",
+            .too_many_attributes => "html.attr.too-many",
+            .uppercase_name => "html.name.uppercase",
+            .missing_self_closing_slash => "html.element.missing-self-closing-slash",
+            .nesting_too_deep => "html.element.too-deep",
+        };
+    }
+};
+
+fn kebabCase(comptime name: []const u8) []const u8 {
+    var buf: [name.len]u8 = name[0..name.len].*;
+    std.mem.replaceScalar(u8, &buf, '_', '-');
+    const result = buf;
+    return &result;
+}
+
+/// Validation rules that can be individually downgraded or disabled.
+/// Names match the keys accepted in `.superhtml.json`.
+pub const Rule = enum {
+    doctype,
+    @"unknown-element",
+    @"unknown-attribute",
+    attribute,
+    @"required-attribute",
+    @"duplicate-attribute",
+    @"duplicate-class",
+    @"duplicate-id",
+    nesting,
+    @"self-closing",
+    @"obsolete-element",
+    @"img-alt",
+    @"label-for",
+    @"heading-order",
+    @"unused-suppression",
+    @"input-type",
+    charset,
+    @"link-name",
+    @"tag-case",
+    @"name-case",
+    dimensions,
+    @"id-reference",
+    @"max-attributes",
+    @"max-depth",
+
+    pub const Level = enum { @"error", warn, info, off };
+
+    pub fn defaultLevel(r: Rule) Level {
+        return switch (r) {
+            .@"img-alt",
+            .@"label-for",
+            .@"obsolete-element",
+            .@"input-type",
+            .@"link-name",
+            .@"id-reference",
+            .@"max-attributes",
+            .@"max-depth",
+            .charset,
+            => .warn,
+            .@"unused-suppression" => .info,
+            // Opinionated, must be opted into.
+            .@"heading-order",
+            .@"tag-case",
+            .@"name-case",
+            .dimensions,
+            => .off,
+            else => .@"error",
+        };
+    }
+};
+
+pub const Rules = struct {
+    levels: std.EnumArray(Rule, Rule.Level),
+
+    pub const default: Rules = blk: {
+        var levels: std.EnumArray(Rule, Rule.Level) = .initUndefined();
+        for (std.enums.values(Rule)) |r| levels.set(r, r.defaultLevel());
+        break :blk .{ .levels = levels };
+    };
+
+    pub fn get(rules: Rules, r: Rule) Rule.Level {
+        return rules.levels.get(r);
+    }
+
+    pub fn set(rules: *Rules, r: Rule, level: Rule.Level) void {
+        rules.levels.set(r, level);
+    }
+};
+
+pub const Options = struct {
+    /// Only report syntax errors, skip all validation.
+    syntax_only: bool = false,
+    /// Validate SuperHTML templates like regular HTML documents. When
+    /// disabled, only syntax errors are reported for templates.
+    superhtml_validation: bool = true,
+    /// Validate the document as a fragment (a partial meant to be included
+    /// in other documents) even if it has a top-level `<html>` or
+    /// `<!DOCTYPE>`. Documents without either are always fragments.
+    fragment: bool = false,
+    rules: Rules = .default,
+    /// Maximum number of attributes of an element, null for no limit.
+    max_attributes: ?u32 = null,
+    /// Maximum nesting depth of elements, top-level elements have a depth
+    /// of 1. Null for no limit.
+    max_depth: ?u32 = null,
+    /// Whether void elements must be written without a slash (`<br>`) or
+    /// with one (`<br />`).
+    void_element_style: VoidElementStyle = .html,
 };
 
 pub fn cursor(ast: Ast, idx: u32) Cursor {
@@ -417,10 +804,20 @@ pub fn printErrors(
         });
 
         try printSourceLine(src, err.main_location, w);
+
+        const n = err.note() orelse continue;
+        const note_range = n.span.range(src);
+        try w.print("{s}:{}:{}: note: {s}\n", .{
+            path orelse "<stdin>",
+            note_range.start.row,
+            note_range.start.col,
+            n.message,
+        });
+        try printSourceLine(src, n.span, w);
     }
 }
 
-fn printSourceLine(src: []const u8, span: Span, w: *Writer) !void {
+pub fn printSourceLine(src: []const u8, span: Span, w: *Writer) !void {
     // test.html:3:7: invalid attribute for this element
     //         <div foo bar baz>
     //              ^^^
@@ -459,8 +856,14 @@ pub fn init(
     gpa: Allocator,
     src: []const u8,
     language: Language,
-    syntax_only: bool,
+    options: Options,
 ) error{OutOfMemory}!Ast {
+    const syntax_only = options.syntax_only;
+    const validate = !syntax_only and switch (language) {
+        .html => true,
+        .superhtml => options.superhtml_validation,
+        .xml => false,
+    };
     log.debug("INIT ---- syntax only: {}", .{syntax_only});
     if (src.len > std.math.maxInt(u32)) @panic("too long");
 
@@ -556,6 +959,23 @@ pub fn init(
                         else => unreachable,
                         .start_self => {
                             if (svg_lvl != 0 or math_lvl != 0 or language == .xml) {
+                                if (validate and language != .xml) {
+                                    try foreign.validate(
+                                        gpa,
+                                        &errors,
+                                        &seen_attrs,
+                                        &seen_ids_stack.items[seen_ids_stack.items.len - 1],
+                                        language,
+                                        nodes.items,
+                                        switch (current.direction()) {
+                                            .in => current_idx,
+                                            .after => current.parent_idx,
+                                        },
+                                        src,
+                                        tag.span,
+                                        @intCast(nodes.items.len),
+                                    );
+                                }
                                 break :node .{
                                     .kind = .___,
                                     .open = tag.span,
@@ -566,14 +986,16 @@ pub fn init(
                                     .self_closing = true,
                                 };
                             }
-                            try errors.append(gpa, .{
+                            const allowed = options.void_element_style == .xhtml and
+                                if (kinds.get(name)) |kind| kind.isVoid() else false;
+                            if (!allowed) try errors.append(gpa, .{
                                 .tag = .html_elements_cant_self_close,
                                 .main_location = tag.name,
                                 .node_idx = current_idx + 1,
                             });
                             continue :node .start;
                         },
-                        .start => switch (language) {
+                        .start => lang: switch (language) {
                             .superhtml => {
                                 const kind: Ast.Kind = if (std.ascii.eqlIgnoreCase("ctx", name))
                                     .ctx
@@ -581,6 +1003,8 @@ pub fn init(
                                     .super
                                 else if (std.ascii.eqlIgnoreCase("extend", name))
                                     .extend
+                                else if (validate)
+                                    continue :lang .html
                                 else
                                     kinds.get(name) orelse .___;
 
@@ -603,7 +1027,8 @@ pub fn init(
                                         };
 
                                         const e = elements.get(kind);
-                                        const model = if (syntax_only or language != .html)
+                                        const first_attr_error = errors.items.len;
+                                        const model = if (!validate)
                                             undefined
                                         else
                                             try e.validateAttrs(
@@ -619,6 +1044,15 @@ pub fn init(
                                                 @intCast(nodes.items.len),
                                             );
 
+                                        if (language == .superhtml) {
+                                            dropScriptedValueErrors(
+                                                &errors,
+                                                first_attr_error,
+                                                src,
+                                                tag.span,
+                                            );
+                                        }
+
                                         if (kind == .template) {
                                             try seen_ids_stack.append(gpa, .empty);
                                         }
@@ -629,7 +1063,9 @@ pub fn init(
                                             .model = model,
                                             .self_closing = self_closing,
                                         };
-                                    } else if (std.mem.indexOfScalar(u8, name, '-') == null and !syntax_only) {
+                                    } else if (!Element.isCustomElementName(name) and
+                                        !syntax_only and !Element.obsolete.has(name))
+                                    {
                                         try errors.append(gpa, .{
                                             .tag = .invalid_html_tag_name,
                                             .main_location = tag.name,
@@ -638,6 +1074,37 @@ pub fn init(
                                     }
                                 }
 
+                                if (validate and (svg_lvl != 0 or math_lvl != 0)) {
+                                    try foreign.validate(
+                                        gpa,
+                                        &errors,
+                                        &seen_attrs,
+                                        &seen_ids_stack.items[seen_ids_stack.items.len - 1],
+                                        language,
+                                        nodes.items,
+                                        switch (current.direction()) {
+                                            .in => current_idx,
+                                            .after => current.parent_idx,
+                                        },
+                                        src,
+                                        tag.span,
+                                        @intCast(nodes.items.len),
+                                    );
+                                } else if (validate) {
+                                    // Elements without a known model are
+                                    // still checked for duplicate attributes.
+                                    var vait: Attribute.ValidatingIterator = .init(
+                                        &errors,
+                                        &seen_attrs,
+                                        &seen_ids_stack.items[seen_ids_stack.items.len - 1],
+                                        language,
+                                        tag.span,
+                                        src,
+                                        @intCast(nodes.items.len),
+                                    );
+                                    while (try vait.next(gpa, src)) |_| {}
+                                }
+
                                 break :node .{
                                     .kind = .___,
                                     .open = tag.span,
@@ -693,10 +1160,14 @@ pub fn init(
                             const ancestor = nodes.items[ancestor_idx];
                             defer ancestor_idx = ancestor.parent_idx;
 
+                            // Template contents are separate fragments
+                            if (ancestor.kind == .template) break;
+
                             switch (ancestor.kind) {
                                 .html,
                                 .body,
                                 .div,
+                                .ctx,
                                 .___,
                                 => {},
                                 .form => {
@@ -722,12 +1193,16 @@ pub fn init(
                         tokenizer.gotoScriptData();
                     } else if (rawtext_names.has(name)) {
                         tokenizer.gotoRawText(name);
-                    } else if (unsupported_names.has(name)) {
-                        try errors.append(gpa, .{
-                            .tag = .deprecated_and_unsupported,
-                            .main_location = tag.name,
-                            .node_idx = current_idx,
-                        });
+                    }
+
+                    if (svg_lvl == 0 and math_lvl == 0) {
+                        if (Element.obsolete.get(name)) |replacement| {
+                            try errors.append(gpa, .{
+                                .tag = .{ .deprecated_and_unsupported = replacement },
+                                .main_location = tag.name,
+                                .node_idx = current_idx,
+                            });
+                        }
                     }
                 },
                 .end, .end_self => {
@@ -834,30 +1309,28 @@ pub fn init(
 
                             current.close = tag.span;
 
+                            // Elements left open between the current node
+                            // and the one being closed are reported at
+                            // their start tag, pointing at this end tag
+                            // as the place where they should have been
+                            // closed.
                             var cur = original_current;
+                            var cur_idx = original_current_idx;
                             while (cur != current) {
                                 if (!cur.isClosed()) {
-                                    const cur_name: Span = blk: {
-                                        var temp_tok: Tokenizer = .{
-                                            .language = language,
-                                            .return_attrs = true,
-                                        };
-                                        const tag_src = cur.open.slice(src);
-                                        const rel_name = temp_tok.getName(tag_src).?;
-                                        break :blk .{
-                                            .start = rel_name.start + cur.open.start,
-                                            .end = rel_name.end + cur.open.start,
-                                        };
-                                    };
                                     has_syntax_errors = true;
                                     try errors.append(gpa, .{
-                                        .tag = .missing_end_tag,
-                                        .main_location = cur_name,
-                                        .node_idx = current_idx,
+                                        .tag = .{ .missing_end_tag = tag.span },
+                                        .main_location = cur.startTagIterator(
+                                            src,
+                                            language,
+                                        ).name_span,
+                                        .node_idx = cur_idx,
                                     });
                                 }
 
-                                cur = &nodes.items[cur.parent_idx];
+                                cur_idx = cur.parent_idx;
+                                cur = &nodes.items[cur_idx];
                             }
 
                             log.debug("----- closing '{s}' cur: {} par: {}", .{
@@ -957,13 +1430,22 @@ pub fn init(
         }
     }
 
-    // finalize tree
+    // finalize tree, elements still open were expected to be closed
+    // before the end of the document
     while (current.kind != .root) {
         if (!current.isClosed()) {
             has_syntax_errors = true;
             try errors.append(gpa, .{
-                .tag = .missing_end_tag,
-                .main_location = current.open,
+                .tag = .{
+                    .missing_end_tag = .{
+                        .start = @intCast(src.len),
+                        .end = @intCast(src.len),
+                    },
+                },
+                .main_location = current.startTagIterator(
+                    src,
+                    language,
+                ).name_span,
                 .node_idx = current_idx,
             });
         }
@@ -972,16 +1454,111 @@ pub fn init(
         current = &nodes.items[current.parent_idx];
     }
 
-    if (!syntax_only and !has_syntax_errors and language == .html) try validateNesting(
+    const fragment = options.fragment or blk: {
+        var child_idx = nodes.items[0].first_child_idx;
+        while (child_idx != 0) : (child_idx = nodes.items[child_idx].next_idx) {
+            switch (nodes.items[child_idx].kind) {
+                .html, .doctype => break :blk false,
+                else => {},
+            }
+        }
+        break :blk true;
+    };
+
+    if (validate and !has_syntax_errors) try validateNesting(
         gpa,
         nodes.items,
         &seen_attrs,
         &seen_ids_stack,
         &errors,
         src,
+        fragment,
+    );
+
+    if (validate and !has_syntax_errors) try validateLabels(
+        gpa,
+        nodes.items,
+        &errors,
+        src,
         language,
     );
 
+    if (validate and !has_syntax_errors and
+        options.rules.get(.@"id-reference") != .off)
+    {
+        try validateIdReferences(gpa, nodes.items, &errors, src, language);
+    }
+
+    if (validate and !has_syntax_errors and
+        options.rules.get(.@"heading-order") != .off)
+    {
+        try validateHeadings(gpa, nodes.items, &errors, src, language);
+    }
+
+    if (validate and !has_syntax_errors and
+        options.rules.get(.@"tag-case") != .off)
+    {
+        try validateTagCase(gpa, nodes.items, &errors, src, language);
+    }
+
+    if (validate and !has_syntax_errors and
+        options.rules.get(.@"name-case") != .off)
+    {
+        try validateNameCase(gpa, nodes.items, &errors, src, language);
+    }
+
+    if (validate and !has_syntax_errors and
+        options.void_element_style == .xhtml and
+        options.rules.get(.@"self-closing") != .off)
+    {
+        try validateVoidSlash(gpa, nodes.items, &errors, src, language);
+    }
+
+    if (validate and !has_syntax_errors and
+        options.rules.get(.@"link-name") != .off)
+    {
+        try validateLinks(gpa, nodes.items, &errors, src, language);
+    }
+
+    if (validate and !has_syntax_errors and
+        options.rules.get(.dimensions) != .off)
+    {
+        try validateDimensions(gpa, nodes.items, &errors, src, language);
+    }
+
+    if (validate and !has_syntax_errors and
+        options.rules.get(.@"max-attributes") != .off)
+    {
+        if (options.max_attributes) |max| {
+            try validateAttributeCount(gpa, nodes.items, &errors, src, language, max);
+        }
+    }
+
+    if (validate and !has_syntax_errors and
+        options.rules.get(.@"max-depth") != .off)
+    {
+        if (options.max_depth) |max| {
+            try validateDepth(gpa, nodes.items, &errors, src, max);
+        }
+    }
+
+    // Byte offsets in templates don't match the ones of the generated
+    // documents, so only plain HTML documents are checked.
+    if (validate and !has_syntax_errors and language == .html and
+        !fragment and options.rules.get(.charset) != .off)
+    {
+        try validateCharset(gpa, nodes.items, &errors, src);
+    }
+
+    try applySuppressions(
+        gpa,
+        nodes.items,
+        &errors,
+        src,
+        validate and !has_syntax_errors,
+    );
+    applyRules(&errors, options.rules);
+
     return .{
         .has_syntax_errors = has_syntax_errors,
         .language = language,
@@ -990,89 +1567,529 @@ pub fn init(
     };
 }
 
-pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
-    assert(!ast.has_syntax_errors);
-
-    if (ast.nodes.len < 2) return;
+/// Drops the errors reported by attribute validation, starting from
+/// `first`, that point inside of a scripted attribute value since those
+/// values are only known at runtime.
+fn dropScriptedValueErrors(
+    errors: *std.ArrayListUnmanaged(Error),
+    first: usize,
+    src: []const u8,
+    tag: Span,
+) void {
+    var i = first;
+    while (i < errors.items.len) {
+        if (inScriptedValue(src, tag, errors.items[i].main_location)) {
+            _ = errors.orderedRemove(i);
+        } else i += 1;
+    }
+}
 
-    var indentation: u32 = 0;
-    var current = ast.nodes[1];
-    var direction: enum { enter, exit } = .enter;
-    var last_rbracket: u32 = 0;
-    var last_was_text = false;
-    var pre: u32 = 0;
-    while (true) {
-        const zone_outer = tracy.trace(@src());
-        defer zone_outer.end();
-        fmtlog.debug("looping, ind: {}, dir: {s}", .{
-            indentation,
-            @tagName(direction),
-        });
+fn inScriptedValue(src: []const u8, tag: Span, location: Span) bool {
+    var it: Tokenizer = .{
+        .language = .superhtml,
+        .idx = tag.start,
+        .return_attrs = true,
+    };
+    while (it.next(src[0..tag.end])) |tok| switch (tok) {
+        else => {},
+        .tag => break,
+        .attr => |attr| {
+            const value = attr.value orelse continue;
+            if (!std.mem.startsWith(u8, value.span.slice(src), "$")) continue;
+            if (location.start >= value.span.start and
+                location.end <= value.span.end) return true;
+        },
+    };
+    return false;
+}
 
-        const crt = current;
-        defer last_was_text = crt.kind == .text;
-        switch (direction) {
-            .enter => {
-                const zone = tracy.trace(@src());
-                defer zone.end();
-                fmtlog.debug("rendering enter ({}): {t} lwt: {}", .{
-                    indentation,
-                    current.kind,
-                    last_was_text,
-                });
+/// Drops the errors silenced by `superhtml-disable-next-line` comments
+/// (which apply to the start tag of the next element) and by
+/// `superhtml-disable-line` comments (which apply to their own line). Both
+/// accept a list of error codes and silence all errors when none is given.
+/// Suppressions that silence nothing are reported when `report_unused` is
+/// set, so that stale ones can be cleaned up. Template errors (`super.Ast`)
+/// are found later on and can't be suppressed.
+fn applySuppressions(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    report_unused: bool,
+) !void {
+    const Suppression = struct {
+        comment_idx: u32,
+        region: Span,
+        codes: []const u8,
+        used: bool = false,
+
+        fn silences(s: @This(), err: Error) bool {
+            const loc = err.main_location.start;
+            if (loc < s.region.start or loc >= s.region.end) return false;
+            if (s.codes.len == 0) return true;
+            var it = std.mem.tokenizeAny(u8, s.codes, " \t\n\r,");
+            while (it.next()) |c| {
+                if (std.mem.eql(u8, c, err.code())) return true;
+            }
+            return false;
+        }
+    };
 
-                const maybe_ws = src[last_rbracket..current.open.start];
-                fmtlog.debug("maybe_ws = '{s}'", .{maybe_ws});
-                if (pre > 0) {
-                    try w.writeAll(maybe_ws);
-                } else {
-                    const vertical = if (last_was_text and current.kind != .text)
-                        std.mem.indexOfScalar(u8, maybe_ws, '\n') != null
-                    else
-                        maybe_ws.len > 0;
+    var suppressions: std.ArrayList(Suppression) = .empty;
+    defer suppressions.deinit(gpa);
 
-                    if (vertical) {
-                        fmtlog.debug("adding a newline", .{});
-                        const lines = std.mem.count(u8, maybe_ws, "\n");
-                        if (last_rbracket > 0) {
-                            if (lines >= 2) {
-                                try w.writeAll("\n\n");
-                            } else {
-                                try w.writeAll("\n");
-                            }
-                        }
+    for (nodes, 0..) |n, idx| {
+        if (n.kind != .comment) continue;
+        const comment = n.open.slice(src);
+        if (comment.len < "<!---->".len or
+            !std.mem.endsWith(u8, comment, "-->")) continue;
 
-                        for (0..indentation) |_| {
-                            try w.writeAll("\t");
-                        }
-                    } else if ((last_was_text or current.kind == .text) and maybe_ws.len > 0) {
-                        try w.writeAll(" ");
-                    }
-                }
+        const content = std.mem.trim(
+            u8,
+            comment["<!--".len .. comment.len - "-->".len],
+            &std.ascii.whitespace,
+        );
+        const directive_end = std.mem.indexOfAny(
+            u8,
+            content,
+            &std.ascii.whitespace,
+        ) orelse content.len;
+        const directive = content[0..directive_end];
+
+        const region: Span = if (std.mem.eql(u8, directive, "superhtml-disable-line")) .{
+            .start = if (std.mem.lastIndexOfScalar(u8, src[0..n.open.start], '\n')) |nl|
+                @intCast(nl + 1)
+            else
+                0,
+            .end = @intCast(std.mem.indexOfScalarPos(u8, src, n.open.end, '\n') orelse src.len),
+        } else if (std.mem.eql(u8, directive, "superhtml-disable-next-line")) blk: {
+            for (nodes[idx + 1 ..]) |next| {
+                if (next.kind.isElement()) break :blk next.open;
+            }
+            break :blk .{ .start = 0, .end = 0 };
+        } else continue;
 
-                const child_is_vertical = if (ast.child(current)) |c|
-                    (c.kind == .text or c.open.start - current.open.end > 0)
-                else
-                    false;
-                if (!current.self_closing and
-                    current.kind.isElement() and
-                    !current.kind.isVoid() and
-                    child_is_vertical)
-                {
-                    indentation += 1;
-                }
-            },
-            .exit => {
-                const zone = tracy.trace(@src());
-                defer zone.end();
-                assert(current.kind != .text);
-                assert(!current.kind.isElement() or !current.kind.isVoid());
-                assert(!current.self_closing);
+        try suppressions.append(gpa, .{
+            .comment_idx = @intCast(idx),
+            .region = region,
+            .codes = content[directive_end..],
+        });
+    }
 
-                if (current.kind == .root) {
-                    try w.writeAll("\n");
-                    return;
-                }
+    if (suppressions.items.len == 0) return;
+
+    var i: usize = 0;
+    outer: for (errors.items) |err| {
+        for (suppressions.items) |*s| {
+            if (!s.silences(err)) continue;
+            s.used = true;
+            continue :outer;
+        }
+        errors.items[i] = err;
+        i += 1;
+    }
+    errors.shrinkRetainingCapacity(i);
+
+    if (!report_unused) return;
+    for (suppressions.items) |s| {
+        if (s.used) continue;
+        try errors.append(gpa, .{
+            .tag = .unused_suppression,
+            .main_location = nodes[s.comment_idx].open,
+            .node_idx = s.comment_idx,
+        });
+    }
+}
+
+/// Drops errors reported by disabled rules and sets the severity of the
+/// remaining ones according to the configured level.
+fn applyRules(errors: *std.ArrayListUnmanaged(Error), rules: Rules) void {
+    var i: usize = 0;
+    for (errors.items) |err| {
+        var e = err;
+        if (err.rule()) |r| switch (rules.get(r)) {
+            .off => continue,
+            .warn => e.severity = .warning,
+            .info => e.severity = .info,
+            .@"error" => e.severity = .@"error",
+        };
+        errors.items[i] = e;
+        i += 1;
+    }
+    errors.shrinkRetainingCapacity(i);
+}
+
+/// Updates the tree in place after `src[start..end]` was replaced with
+/// `new_len` bytes, where `src` is the new source. Only edits that fall
+/// inside of a text node and that don't introduce markup are supported,
+/// returns false otherwise, in which case the caller must reparse the
+/// document.
+pub fn applyTextEdit(
+    ast: *Ast,
+    src: []const u8,
+    start: u32,
+    end: u32,
+    new_len: u32,
+) bool {
+    if (ast.language != .html) return false;
+
+    // The edit must not touch the boundaries of the text node, as those
+    // depend on how surrounding whitespace gets trimmed.
+    const text = for (ast.nodes) |n| {
+        if (n.kind == .text and n.open.start < start and end < n.open.end) break n;
+    } else return false;
+
+    switch (ast.nodes[text.parent_idx].kind) {
+        // Raw text elements are tokenized differently.
+        .script, .style, .textarea, .title, .noscript => return false,
+        else => {},
+    }
+
+    const delta = @as(i64, new_len) - (end - start);
+    const text_end: u32 = @intCast(text.open.end + delta);
+    if (text_end > src.len) return false;
+    const content = src[text.open.start..text_end];
+    if (std.mem.indexOfAny(u8, content, "<&\x00") != null) return false;
+
+    for (@constCast(ast.nodes)) |*n| {
+        shiftSpans(&n.open, end, delta);
+        shiftSpans(&n.close, end, delta);
+    }
+
+    for (@constCast(ast.errors)) |*err| {
+        shiftSpans(&err.main_location, end, delta);
+        switch (err.tag) {
+            inline else => |*payload| shiftSpans(payload, end, delta),
+        }
+    }
+
+    return true;
+}
+
+/// Moves by `delta` all span offsets contained in `ptr` that come at or
+/// after `at`.
+pub fn shiftSpans(ptr: anytype, at: u32, delta: i64) void {
+    const T = @TypeOf(ptr.*);
+    if (T == Span) {
+        if (ptr.start >= at) ptr.start = @intCast(ptr.start + delta);
+        if (ptr.end >= at) ptr.end = @intCast(ptr.end + delta);
+        return;
+    }
+
+    switch (@typeInfo(T)) {
+        .optional => if (ptr.*) |*s| shiftSpans(s, at, delta),
+        .@"struct" => |info| inline for (info.fields) |f| {
+            shiftSpans(&@field(ptr.*, f.name), at, delta);
+        },
+        else => {},
+    }
+}
+
+pub const RenderOptions = struct {
+    attribute_order: AttributeOrder = .preserve,
+    boolean_attribute_style: BooleanAttributeStyle = .collapse,
+    /// Start tags longer than this are rendered with one attribute per
+    /// line. Each level of indentation with tabs counts as `tab_width`
+    /// columns.
+    print_width: ?u32 = null,
+    indent_style: IndentStyle = .tab,
+    /// Number of spaces per indentation level, ignored when indenting with
+    /// tabs.
+    indent_width: u32 = 4,
+    blank_lines: BlankLines = .collapse,
+    void_element_style: VoidElementStyle = .html,
+
+    pub const tab_width = 4;
+
+    pub fn writeIndentation(options: RenderOptions, w: *Writer, level: usize) !void {
+        switch (options.indent_style) {
+            .tab => for (0..level) |_| try w.writeAll("\t"),
+            .space => try w.splatByteAll(' ', level * options.indent_width),
+        }
+    }
+
+    /// Columns taken by one indentation level.
+    fn indentationWidth(options: RenderOptions) usize {
+        return switch (options.indent_style) {
+            .tab => tab_width,
+            .space => options.indent_width,
+        };
+    }
+};
+
+pub const IndentStyle = enum { tab, space };
+
+/// How blank lines between nodes are rendered. Blank lines before end tags
+/// are always removed.
+pub const BlankLines = enum {
+    /// Runs of blank lines are collapsed into a single one.
+    collapse,
+    /// Same as `collapse`, but blank lines right after a start tag are
+    /// removed too, so that only gaps between siblings are kept.
+    @"preserve-one",
+};
+
+/// How valid boolean attributes are rendered, boolean attributes with any
+/// other value are rendered as-is.
+pub const BooleanAttributeStyle = enum {
+    /// `disabled`
+    collapse,
+    /// `disabled="disabled"`
+    value,
+};
+
+pub const VoidElementStyle = enum {
+    /// `<br>`
+    html,
+    /// `<br />`
+    xhtml,
+};
+
+pub const AttributeOrder = enum {
+    /// Keep attributes in the order they appear in the source.
+    preserve,
+    /// SuperHTML directives, then `id`, `class`, all other attributes
+    /// alphabetically and finally event handlers (`on*`).
+    canonical,
+};
+
+/// A run of sibling nodes that can be rendered on its own, see `fragments`.
+pub const Fragment = struct {
+    first_idx: u32,
+    last_idx: u32,
+    /// The source code replaced by the rendered fragment, which also
+    /// includes the indentation of the first node when it starts its line.
+    span: Span,
+};
+
+/// Returns the outermost runs of sibling nodes fully contained in `range`.
+/// Nodes that straddle the boundaries of `range` are left out, and so are
+/// nodes that are rendered verbatim (eg. the content of `<pre>`).
+pub fn fragments(
+    ast: Ast,
+    gpa: Allocator,
+    src: []const u8,
+    range: Span,
+) ![]Fragment {
+    var result: std.ArrayList(Fragment) = .empty;
+    errdefer result.deinit(gpa);
+
+    var idx: u32 = 1;
+    while (idx < ast.nodes.len) {
+        const n = ast.nodes[idx];
+        if (!ast.contains(idx, range)) {
+            idx += 1;
+            continue;
+        }
+
+        if (ast.isVerbatim(idx, src)) {
+            idx = n.stop(ast.nodes);
+            continue;
+        }
+
+        var last_idx = idx;
+        while (true) {
+            const next_idx = ast.nodes[last_idx].next_idx;
+            if (next_idx == 0 or !ast.contains(next_idx, range)) break;
+            last_idx = next_idx;
+        }
+
+        const line_start: u32 = if (std.mem.lastIndexOfScalar(
+            u8,
+            src[0..n.open.start],
+            '\n',
+        )) |nl| @intCast(nl + 1) else 0;
+
+        try result.append(gpa, .{
+            .first_idx = idx,
+            .last_idx = last_idx,
+            .span = .{
+                .start = if (isBlank(src[line_start..n.open.start]))
+                    line_start
+                else
+                    n.open.start,
+                .end = ast.nodeEnd(last_idx).?,
+            },
+        });
+
+        idx = ast.nodes[last_idx].stop(ast.nodes);
+    }
+
+    return result.toOwnedSlice(gpa);
+}
+
+/// Returns the end of the source code of a node, or null if the node is an
+/// element that was not closed.
+fn nodeEnd(ast: Ast, idx: u32) ?u32 {
+    const n = ast.nodes[idx];
+    if (!n.kind.isElement() or n.kind.isVoid() or n.self_closing) {
+        return n.open.end;
+    }
+    if (n.close.start == 0) return null;
+    return n.close.end;
+}
+
+fn contains(ast: Ast, idx: u32, range: Span) bool {
+    const n_end = ast.nodeEnd(idx) orelse return false;
+    return ast.nodes[idx].open.start >= range.start and n_end <= range.end;
+}
+
+/// Returns true if one of the ancestors of a node preserves whitespace.
+fn isVerbatim(ast: Ast, idx: u32, src: []const u8) bool {
+    var cur_idx = ast.nodes[idx].parent_idx;
+    while (cur_idx != 0) : (cur_idx = ast.nodes[cur_idx].parent_idx) {
+        if (preservesWhitespace(ast.nodes[cur_idx], src, ast.language)) {
+            return true;
+        }
+    }
+    return false;
+}
+
+/// Renders a fragment indented to match its depth in the document. The
+/// output is meant to replace `fragment.span`.
+pub fn renderFragment(
+    ast: Ast,
+    src: []const u8,
+    w: *Writer,
+    options: RenderOptions,
+    fragment: Fragment,
+) !void {
+    const first = ast.nodes[fragment.first_idx];
+
+    // Same as the indentation computed by `render` when entering each
+    // ancestor.
+    var indentation: u32 = 0;
+    var idx = first.parent_idx;
+    while (idx != 0) : (idx = ast.nodes[idx].parent_idx) {
+        const n = ast.nodes[idx];
+        const child_is_vertical = if (ast.child(n)) |c|
+            (c.kind == .text or c.open.start - n.open.end > 0)
+        else
+            false;
+        if (!n.self_closing and
+            n.kind.isElement() and
+            !n.kind.isVoid() and
+            child_is_vertical)
+        {
+            indentation += 1;
+        }
+    }
+
+    if (fragment.span.start < first.open.start) {
+        try options.writeIndentation(w, indentation);
+    }
+
+    try ast.renderNodes(src, w, options, fragment, indentation);
+}
+
+pub fn render(ast: Ast, src: []const u8, w: *Writer, options: RenderOptions) !void {
+    try ast.renderNodes(src, w, options, null, 0);
+}
+
+fn renderNodes(
+    ast: Ast,
+    src: []const u8,
+    w: *Writer,
+    options: RenderOptions,
+    fragment: ?Fragment,
+    base_indentation: u32,
+) !void {
+    assert(!ast.has_syntax_errors);
+
+    if (ast.nodes.len < 2) return;
+
+    const first_idx = if (fragment) |f| f.first_idx else 1;
+    var indentation: u32 = base_indentation;
+    var current = ast.nodes[first_idx];
+    var direction: enum { enter, exit } = .enter;
+    var last_rbracket: u32 = if (fragment != null) current.open.start else 0;
+    var last_was_text = false;
+    var pre: u32 = 0;
+    while (true) {
+        const zone_outer = tracy.trace(@src());
+        defer zone_outer.end();
+
+        if (fragment) |f| {
+            // Stop as soon as we move past the last node of the fragment.
+            const done = switch (direction) {
+                .enter => current.open.start >= f.span.end,
+                .exit => current.kind == .root or
+                    current.open.start < ast.nodes[f.first_idx].open.start,
+            };
+            if (done) return;
+        }
+        fmtlog.debug("looping, ind: {}, dir: {s}", .{
+            indentation,
+            @tagName(direction),
+        });
+
+        const crt = current;
+        defer last_was_text = crt.kind == .text;
+        switch (direction) {
+            .enter => {
+                const zone = tracy.trace(@src());
+                defer zone.end();
+                fmtlog.debug("rendering enter ({}): {t} lwt: {}", .{
+                    indentation,
+                    current.kind,
+                    last_was_text,
+                });
+
+                const maybe_ws = src[last_rbracket..current.open.start];
+                fmtlog.debug("maybe_ws = '{s}'", .{maybe_ws});
+                if (pre > 0) {
+                    try w.writeAll(maybe_ws);
+                } else {
+                    const vertical = if (last_was_text and current.kind != .text)
+                        std.mem.indexOfScalar(u8, maybe_ws, '\n') != null
+                    else
+                        maybe_ws.len > 0;
+
+                    if (vertical) {
+                        fmtlog.debug("adding a newline", .{});
+                        const lines = std.mem.count(u8, maybe_ws, "\n");
+                        const parent_node = ast.nodes[current.parent_idx];
+                        const is_first_child = current.parent_idx != 0 and
+                            ast.nodes[parent_node.first_child_idx].open.start == current.open.start;
+                        const keep_blank_line = lines >= 2 and
+                            (options.blank_lines == .collapse or !is_first_child);
+                        if (last_rbracket > 0) {
+                            if (keep_blank_line) {
+                                try w.writeAll("\n\n");
+                            } else {
+                                try w.writeAll("\n");
+                            }
+                        }
+
+                        try options.writeIndentation(w, indentation);
+                    } else if ((last_was_text or current.kind == .text) and maybe_ws.len > 0) {
+                        try w.writeAll(" ");
+                    }
+                }
+
+                const child_is_vertical = if (ast.child(current)) |c|
+                    (c.kind == .text or c.open.start - current.open.end > 0)
+                else
+                    false;
+                if (!current.self_closing and
+                    current.kind.isElement() and
+                    !current.kind.isVoid() and
+                    child_is_vertical)
+                {
+                    indentation += 1;
+                }
+            },
+            .exit => {
+                const zone = tracy.trace(@src());
+                defer zone.end();
+                assert(current.kind != .text);
+                assert(!current.kind.isElement() or !current.kind.isVoid());
+                assert(!current.self_closing);
+
+                if (current.kind == .root) {
+                    try w.writeAll("\n");
+                    return;
+                }
 
                 fmtlog.debug("rendering exit ({}): {s} {any}", .{
                     indentation,
@@ -1113,9 +2130,7 @@ pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
                         std.ascii.isWhitespace(src[current.open.end]);
                     if (open_was_vertical) {
                         try w.writeAll("\n");
-                        for (0..indentation) |_| {
-                            try w.writeAll("\t");
-                        }
+                        try options.writeIndentation(w, indentation);
                     }
                 }
             },
@@ -1157,23 +2172,50 @@ pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
                             if (line.len == 0) {
                                 if (empty_line) continue;
                                 empty_line = true;
-                                if (!first) for (0..indentation) |_| try w.print("\t", .{});
+                                if (!first) try options.writeIndentation(w, indentation);
                                 try w.print("\n", .{});
                                 continue;
                             } else empty_line = false;
-                            if (!first) for (0..indentation) |_| try w.print("\t", .{});
+                            if (!first) try options.writeIndentation(w, indentation);
                             try w.print("{s}", .{line});
                             if (it.peek() != null) try w.print("\n", .{});
                             first = false;
                         }
                     },
-                    .style, .script => {
-                        var css_indent = indentation;
+                    .style, .script => if (pre > 0) {
+                        try w.writeAll(txt);
+                    } else {
+                        // Shift the block so that its base indentation
+                        // matches the element's depth, preserving the
+                        // relative indentation of each line.
                         var it = std.mem.splitScalar(u8, txt, '\n');
-                        var first = true;
+                        const first_line = it.first();
+                        try w.writeAll(first_line);
+
+                        // The text node is trimmed so the indentation of the
+                        // first line is found in the source before it, but
+                        // only if the first line doesn't share its line with
+                        // the start tag.
+                        const line_start = if (std.mem.lastIndexOfScalar(
+                            u8,
+                            src[0..current.open.start],
+                            '\n',
+                        )) |nl| nl + 1 else 0;
+                        const first_indent = src[line_start..current.open.start];
+                        var base: usize = if (isBlank(first_indent))
+                            first_indent.len
+                        else
+                            std.math.maxInt(usize);
+                        while (it.next()) |line| {
+                            if (isBlank(line)) continue;
+                            base = @min(base, leadingBlanks(line));
+                        }
+
+                        it.reset();
+                        _ = it.first();
                         var empty_line = false;
                         while (it.next()) |raw_line| {
-                            const line = std.mem.trim(
+                            const line = std.mem.trimEnd(
                                 u8,
                                 raw_line,
                                 &std.ascii.whitespace,
@@ -1181,26 +2223,12 @@ pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
                             if (line.len == 0) {
                                 if (empty_line) continue;
                                 empty_line = true;
-                                if (!first) for (0..css_indent) |_| try w.print("\t", .{});
-                                try w.print("\n", .{});
+                                try w.writeAll("\n");
                                 continue;
                             } else empty_line = false;
-                            if (std.mem.endsWith(u8, line, "{")) {
-                                if (!first) for (0..css_indent) |_| try w.print("\t", .{});
-                                try w.print("{s}", .{line});
-                                css_indent += 1;
-                            } else if (std.mem.eql(u8, line, "}")) {
-                                css_indent -|= 1;
-                                if (!first) for (0..css_indent) |_| try w.print("\t", .{});
-                                try w.print("{s}", .{line});
-                            } else {
-                                if (!first) for (0..css_indent) |_| try w.print("\t", .{});
-                                try w.print("{s}", .{line});
-                            }
-
-                            if (it.peek() != null) try w.print("\n", .{});
-
-                            first = false;
+                            try w.writeAll("\n");
+                            try options.writeIndentation(w, indentation);
+                            try w.writeAll(line[@min(base, leadingBlanks(line))..]);
                         }
                     },
                 }
@@ -1278,88 +2306,129 @@ pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
                     defer zone.end();
                     last_rbracket = current.open.end;
 
-                    var sti = current.startTagIterator(src, ast.language);
+                    const sti = current.startTagIterator(src, ast.language);
                     const name = sti.name_span.slice(src);
 
-                    if (current.kind == .pre and !current.self_closing) {
+                    // Elements nested inside of a whitespace-sensitive
+                    // element are rendered verbatim.
+                    const verbatim = pre > 0;
+                    if (!current.self_closing and !current.kind.isVoid() and
+                        preservesWhitespace(current, src, ast.language))
+                    {
                         pre += 1;
                     }
 
-                    try w.print("<{s}", .{name});
-
-                    const vertical = std.ascii.isWhitespace(
-                        // <div arst="arst" >
-                        //                 ^
-                        src[current.open.end - 2],
-                    ) and blk: {
-                        // Don't do vertical alignment if we don't have
-                        // at least 2 attributes.
-                        var temp_sti = sti;
-                        _ = temp_sti.next(src) orelse break :blk false;
-                        _ = temp_sti.next(src) orelse break :blk false;
-                        break :blk true;
-                    };
+                    if (verbatim) {
+                        try w.writeAll(current.open.slice(src));
+                    } else {
+                        try w.print("<{s}", .{name});
+
+                        const vertical = std.ascii.isWhitespace(
+                            // <div arst="arst" >
+                            //                 ^
+                            src[current.open.end - 2],
+                        ) and blk: {
+                            // Don't do vertical alignment if we don't have
+                            // at least 2 attributes.
+                            var temp_sti = sti;
+                            _ = temp_sti.next(src) orelse break :blk false;
+                            _ = temp_sti.next(src) orelse break :blk false;
+                            break :blk true;
+                        };
 
-                    fmtlog.debug("element <{s}> vertical = {}", .{ name, vertical });
+                        fmtlog.debug("element <{s}> vertical = {}", .{ name, vertical });
 
-                    // if (std.mem.eql(u8, name, "path")) @breakpoint();
+                        // if (std.mem.eql(u8, name, "path")) @breakpoint();
 
-                    const child_is_vertical = if (ast.child(current)) |c|
-                        (c.kind == .text or c.open.start - current.open.end > 0)
-                    else
-                        false;
-                    const attr_indent = indentation - @intFromBool(!current.kind.isVoid() and !current.self_closing and child_is_vertical);
-                    const extra = blk: {
-                        if (current.kind == .doctype) break :blk 1;
-                        assert(current.kind.isElement());
-                        break :blk name.len + 2;
-                    };
+                        const child_is_vertical = if (ast.child(current)) |c|
+                            (c.kind == .text or c.open.start - current.open.end > 0)
+                        else
+                            false;
+                        const attr_indent = indentation - @intFromBool(!current.kind.isVoid() and !current.self_closing and child_is_vertical);
+                        const extra = blk: {
+                            if (current.kind == .doctype) break :blk 1;
+                            assert(current.kind.isElement());
+                            break :blk name.len + 2;
+                        };
 
-                    var first = true;
-                    while (sti.next(src)) |attr| {
-                        if (vertical) {
-                            if (first) {
-                                first = false;
-                                try w.print(" ", .{});
-                            } else {
+                        // When a print width is set, start tags that don't
+                        // fit get one attribute per line, and so do
+                        // vertical ones in order for the output to be
+                        // stable across runs.
+                        const wrap = if (options.print_width) |max| blk: {
+                            var temp_sti = sti;
+                            _ = temp_sti.next(src) orelse break :blk false;
+                            break :blk vertical or
+                                startTagWidth(
+                                    current,
+                                    sti,
+                                    src,
+                                    attr_indent,
+                                    options,
+                                ) > max;
+                        } else false;
+
+                        var first = true;
+                        var attrs: AttrOrderIterator = .{
+                            .sti = sti,
+                            .order = options.attribute_order,
+                            .language = ast.language,
+                        };
+                        while (attrs.next(src)) |attr| {
+                            if (wrap) {
                                 try w.print("\n", .{});
-                                for (0..attr_indent) |_| {
-                                    try w.print("\t", .{});
-                                }
-                                for (0..extra) |_| {
+                                try options.writeIndentation(w, attr_indent + 1);
+                            } else if (vertical) {
+                                if (first) {
+                                    first = false;
                                     try w.print(" ", .{});
+                                } else {
+                                    try w.print("\n", .{});
+                                    try options.writeIndentation(w, attr_indent);
+                                    for (0..extra) |_| {
+                                        try w.print(" ", .{});
+                                    }
                                 }
+                            } else {
+                                try w.print(" ", .{});
+                            }
+                            const attr_name = attr.name.slice(src);
+                            try w.print("{s}", .{attr_name});
+                            if (Attribute.isBoolean(current.kind, attr_name) and
+                                Attribute.isBooleanValue(attr, src))
+                            {
+                                switch (options.boolean_attribute_style) {
+                                    .collapse => {},
+                                    .value => try w.print("=\"{s}\"", .{attr_name}),
+                                }
+                            } else if (attr.value) |val| {
+                                const q = switch (val.quote) {
+                                    .none => "",
+                                    .single => "'",
+                                    .double => "\"",
+                                };
+                                try w.print("={s}{s}{s}", .{
+                                    q,
+                                    val.span.slice(src),
+                                    q,
+                                });
                             }
-                        } else {
-                            try w.print(" ", .{});
-                        }
-                        try w.print("{s}", .{
-                            attr.name.slice(src),
-                        });
-                        if (attr.value) |val| {
-                            const q = switch (val.quote) {
-                                .none => "",
-                                .single => "'",
-                                .double => "\"",
-                            };
-                            try w.print("={s}{s}{s}", .{
-                                q,
-                                val.span.slice(src),
-                                q,
-                            });
                         }
-                    }
-                    if (vertical) {
-                        try w.print("\n", .{});
-                        for (0..attr_indent) |_| {
-                            try w.print("\t", .{});
+                        if (wrap or vertical) {
+                            try w.print("\n", .{});
+                            try options.writeIndentation(w, attr_indent);
                         }
-                    }
 
-                    if (current.self_closing and !current.kind.isVoid()) {
-                        try w.print("/", .{});
+                        if (current.self_closing and !current.kind.isVoid()) {
+                            try w.print("/", .{});
+                        } else if (options.void_element_style == .xhtml and
+                            current.kind.isVoid() and
+                            @intFromEnum(current.kind) > @intFromEnum(Kind.___))
+                        {
+                            try w.print("{s}/", .{if (wrap or vertical) "" else " "});
+                        }
+                        try w.print(">", .{});
                     }
-                    try w.print(">", .{});
 
                     assert(current.kind.isElement());
 
@@ -1384,6 +2453,9 @@ pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
                     std.debug.assert(!current.kind.isVoid());
                     std.debug.assert(!current.self_closing);
                     last_rbracket = current.close.end;
+                    if (preservesWhitespace(current, src, ast.language)) {
+                        pre -= 1;
+                    }
                     if (current.close.start != 0) {
                         const name = blk: {
                             var tt: Tokenizer = .{
@@ -1395,9 +2467,6 @@ pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
                             break :blk tt.getName(tag).?.slice(tag);
                         };
 
-                        if (std.ascii.eqlIgnoreCase("pre", name)) {
-                            pre -= 1;
-                        }
                         try w.print("</{s}>", .{name});
                     }
                     if (current.next_idx != 0) {
@@ -1412,44 +2481,779 @@ pub fn render(ast: Ast, src: []const u8, w: *Writer) !void {
     }
 }
 
-// Only executed if strict is enabled
-pub fn validateNesting(
+/// Returns true for elements whose content must be rendered verbatim because
+/// whitespace is significant in it: `<pre>`, `<textarea>` and elements with
+/// an inline style that sets `white-space` to a value that preserves it.
+/// Script data blocks (eg `<script type="application/json">`) are also
+/// rendered verbatim since their content is opaque to us.
+fn preservesWhitespace(n: Node, src: []const u8, language: Language) bool {
+    switch (n.kind) {
+        .pre, .textarea => return true,
+        else => {},
+    }
+
+    if (!n.kind.isElement()) return false;
+
+    var preserve = false;
+    var sti = n.startTagIterator(src, language);
+    while (sti.next(src)) |attr| {
+        if (n.kind == .script and
+            std.ascii.eqlIgnoreCase(attr.name.slice(src), "type"))
+        {
+            const value = attr.value orelse continue;
+            if (script.isDataBlock(value.span.slice(src))) return true;
+            continue;
+        }
+
+        if (!std.ascii.eqlIgnoreCase(attr.name.slice(src), "style")) continue;
+        const value = attr.value orelse continue;
+
+        // The last declaration wins.
+        var it = std.mem.splitScalar(u8, value.span.slice(src), ';');
+        while (it.next()) |decl| {
+            const colon = std.mem.indexOfScalar(u8, decl, ':') orelse continue;
+            const prop = std.mem.trim(u8, decl[0..colon], &std.ascii.whitespace);
+            if (!std.ascii.eqlIgnoreCase(prop, "white-space")) continue;
+            const ws = std.mem.trim(u8, decl[colon + 1 ..], &std.ascii.whitespace);
+            preserve = std.ascii.startsWithIgnoreCase(ws, "pre") or
+                std.ascii.startsWithIgnoreCase(ws, "break-spaces");
+        }
+    }
+    return preserve;
+}
+
+/// Reports headings that skip a level compared to the previous heading,
+/// eg. an <h4> that follows an <h2>. Sectioning elements start a new
+/// sequence of headings.
+fn validateHeadings(
     gpa: Allocator,
     nodes: []const Node,
-    seen_attrs: *std.StringHashMapUnmanaged(Span),
-    seen_ids_stack: *std.ArrayList(std.StringHashMapUnmanaged(Span)),
     errors: *std.ArrayListUnmanaged(Error),
     src: []const u8,
     language: Language,
 ) !void {
-    if (language != .html) return;
+    const Heading = struct { level: u8, name: Span };
+    const Section = struct { stop: u32, previous: ?Heading };
+
+    var sections: std.ArrayList(Section) = .empty;
+    defer sections.deinit(gpa);
+
+    var previous: ?Heading = null;
+    for (nodes, 0..) |n, idx| {
+        while (sections.items.len > 0 and
+            sections.items[sections.items.len - 1].stop <= idx)
+        {
+            previous = sections.pop().?.previous;
+        }
 
-    var node_idx: u32 = 0;
-    while (node_idx < nodes.len) {
-        log.debug("validating {}", .{node_idx});
-        const n = nodes[node_idx];
         switch (n.kind) {
-            .extend,
-            .super,
-            // html
-            .area,
-            .base,
-            .br,
-            .col,
-            .embed,
-            .hr,
-            .img,
-            .input,
-            .link,
-            .meta,
-            .source,
-            .track,
-            .wbr,
-            // end void
-            .svg,
-            .math,
-            .___,
-            .comment,
+            else => {},
+            .article, .aside, .main, .nav, .section => {
+                try sections.append(gpa, .{
+                    .stop = n.stop(nodes),
+                    .previous = previous,
+                });
+                previous = null;
+            },
+            .h1, .h2, .h3, .h4, .h5, .h6 => {
+                const heading: Heading = .{
+                    .level = @intCast(@intFromEnum(n.kind) - @intFromEnum(Kind.h1) + 1),
+                    .name = n.startTagIterator(src, language).name_span,
+                };
+                if (previous) |p| if (heading.level > p.level + 1) {
+                    try errors.append(gpa, .{
+                        .tag = .{ .heading_level_skipped = p.name },
+                        .main_location = heading.name,
+                        .node_idx = @intCast(idx),
+                    });
+                };
+                previous = heading;
+            },
+        }
+    }
+}
+
+/// Reports end tags whose name differs in case from the name of their start
+/// tag, eg. `<DIV></div>`.
+fn validateTagCase(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+) !void {
+    for (nodes, 0..) |n, idx| {
+        if (!n.kind.isElement() or n.close.start == 0) continue;
+        const start_name = n.startTagIterator(src, language).name_span;
+        const end_name = n.endTagName(src);
+        if (std.mem.eql(u8, start_name.slice(src), end_name.slice(src))) continue;
+
+        try errors.append(gpa, .{
+            .tag = .{ .mismatched_tag_case = start_name },
+            .main_location = end_name,
+            .node_idx = @intCast(idx),
+        });
+    }
+}
+
+/// Reports element and attribute names that contain uppercase letters, eg.
+/// `<DIV Class="a">`. Names of foreign elements and attributes are
+/// case-sensitive and are left alone.
+fn validateNameCase(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+) !void {
+    for (nodes, 0..) |n, idx| {
+        // Foreign and custom elements don't have a kind.
+        if (@intFromEnum(n.kind) <= @intFromEnum(Kind.___)) continue;
+
+        var sti = n.startTagIterator(src, language);
+        if (hasUppercase(sti.name_span.slice(src))) {
+            try errors.append(gpa, .{
+                .tag = .uppercase_name,
+                .main_location = sti.name_span,
+                .node_idx = @intCast(idx),
+            });
+        }
+
+        // Attributes of <svg> and <math> are foreign too (eg. `viewBox`).
+        if (n.kind == .svg or n.kind == .math) continue;
+        while (sti.next(src)) |attr| {
+            if (!hasUppercase(attr.name.slice(src))) continue;
+            try errors.append(gpa, .{
+                .tag = .uppercase_name,
+                .main_location = attr.name,
+                .node_idx = @intCast(idx),
+            });
+        }
+    }
+}
+
+/// Reports void elements written without a slash, for documents that use
+/// the XHTML style (`<br />`).
+fn validateVoidSlash(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+) !void {
+    for (nodes, 0..) |n, idx| {
+        if (@intFromEnum(n.kind) <= @intFromEnum(Kind.___)) continue;
+        if (!n.kind.isVoid() or n.self_closing) continue;
+
+        try errors.append(gpa, .{
+            .tag = .missing_self_closing_slash,
+            .main_location = n.startTagIterator(src, language).name_span,
+            .node_idx = @intCast(idx),
+        });
+    }
+}
+
+fn hasUppercase(name: []const u8) bool {
+    for (name) |c| {
+        if (std.ascii.isUpper(c)) return true;
+    }
+    return false;
+}
+
+/// Reports links (`<a href>`) that have no accessible name: no text content,
+/// no [aria-label] or [aria-labelledby] and no image with a non-empty [alt].
+/// In SuperHTML templates, content set through `:text` and `:html` or
+/// coming from a `<super>` block is assumed to be non-empty.
+fn validateLinks(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+) !void {
+    for (nodes, 0..) |n, idx| {
+        if (n.kind != .a) continue;
+        if (n.attrValue(src, language, "href") == null) continue;
+        if (hasAccessibleName(n, src, language)) continue;
+
+        const stop_idx = n.stop(nodes);
+        const has_content = for (nodes[idx + 1 .. stop_idx]) |d| {
+            if (isLinkContent(d, src, language)) break true;
+        } else false;
+        if (has_content) continue;
+
+        try errors.append(gpa, .{
+            .tag = .empty_link,
+            .main_location = n.span(src),
+            .node_idx = @intCast(idx),
+        });
+    }
+}
+
+fn hasAccessibleName(n: Node, src: []const u8, language: Language) bool {
+    for ([_][]const u8{ "aria-label", "aria-labelledby" }) |name| {
+        const value = n.attrValue(src, language, name) orelse continue;
+        if (!isWhitespace(value.slice(src))) return true;
+    }
+
+    if (language == .superhtml) {
+        for ([_][]const u8{ ":text", ":html" }) |name| {
+            if (n.attrValue(src, language, name) != null) return true;
+        }
+    }
+    return false;
+}
+
+/// Reports `<img>` and `<iframe>` elements that don't set both [width] and
+/// [height], unless their inline style sets `aspect-ratio`. Without
+/// dimensions the browser can't reserve space for the content before it
+/// loads, which causes layout shifts.
+fn validateDimensions(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+) !void {
+    for (nodes, 0..) |n, idx| {
+        if (n.kind != .img and n.kind != .iframe) continue;
+
+        var has_width = false;
+        var has_height = false;
+        var has_aspect_ratio = false;
+        var sti = n.startTagIterator(src, language);
+        while (sti.next(src)) |attr| {
+            const name = attr.name.slice(src);
+            if (std.ascii.eqlIgnoreCase(name, "width")) {
+                has_width = true;
+            } else if (std.ascii.eqlIgnoreCase(name, "height")) {
+                has_height = true;
+            } else if (std.ascii.eqlIgnoreCase(name, "style")) {
+                const value = attr.value orelse continue;
+                has_aspect_ratio = setsAspectRatio(value.span.slice(src));
+            }
+        }
+        if ((has_width and has_height) or has_aspect_ratio) continue;
+
+        try errors.append(gpa, .{
+            .tag = .missing_dimensions,
+            .main_location = n.span(src),
+            .node_idx = @intCast(idx),
+        });
+    }
+}
+
+/// Reports elements with more than `max` attributes.
+fn validateAttributeCount(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+    max: u32,
+) !void {
+    for (nodes, 0..) |n, idx| {
+        if (!n.kind.isElement()) continue;
+
+        var count: u32 = 0;
+        var sti = n.startTagIterator(src, language);
+        while (sti.next(src)) |_| count += 1;
+        if (count <= max) continue;
+
+        try errors.append(gpa, .{
+            .tag = .{ .too_many_attributes = .{ .count = count, .max = max } },
+            .main_location = sti.name_span,
+            .node_idx = @intCast(idx),
+        });
+    }
+}
+
+/// Reports elements nested deeper than `max`. Only the outermost elements
+/// past the limit are reported, not all of their descendants.
+fn validateDepth(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    max: u32,
+) !void {
+    // Nodes come before their descendants, so the depth of the parent is
+    // always known.
+    const depths = try gpa.alloc(u32, nodes.len);
+    defer gpa.free(depths);
+
+    for (nodes, depths, 0..) |n, *depth, idx| {
+        if (idx == 0) {
+            depth.* = 0;
+            continue;
+        }
+        depth.* = depths[n.parent_idx] + @intFromBool(n.kind.isElement());
+        if (!n.kind.isElement() or depth.* - 1 != max) continue;
+
+        try errors.append(gpa, .{
+            .tag = .{ .nesting_too_deep = .{ .depth = depth.*, .max = max } },
+            .main_location = n.span(src),
+            .node_idx = @intCast(idx),
+        });
+    }
+}
+
+fn setsAspectRatio(style: []const u8) bool {
+    var it = std.mem.splitScalar(u8, style, ';');
+    while (it.next()) |decl| {
+        const colon = std.mem.indexOfScalar(u8, decl, ':') orelse continue;
+        const prop = std.mem.trim(u8, decl[0..colon], &std.ascii.whitespace);
+        if (std.ascii.eqlIgnoreCase(prop, "aspect-ratio")) return true;
+    }
+    return false;
+}
+
+/// Returns true if `n`, a descendant of a link, gives a name to the link.
+fn isLinkContent(n: Node, src: []const u8, language: Language) bool {
+    return switch (n.kind) {
+        .text => !isWhitespace(n.open.slice(src)),
+        .img => if (n.attrValue(src, language, "alt")) |alt|
+            !isWhitespace(alt.slice(src))
+        else
+            false,
+        .super => true,
+        .comment, .doctype, .root => false,
+        else => hasAccessibleName(n, src, language),
+    };
+}
+
+fn isWhitespace(str: []const u8) bool {
+    return std.mem.trim(u8, str, &std.ascii.whitespace).len == 0;
+}
+
+/// The character encoding declaration must be serialized completely within
+/// this many bytes from the start of the document.
+const charset_max_offset = 1024;
+
+/// Reports documents with a `<head>` that lack a character encoding
+/// declaration, either `<meta charset>` or the legacy
+/// `<meta http-equiv="content-type" content="...; charset=...">`, or that
+/// declare it too late. Documents without a `<head>` are not checked.
+fn validateCharset(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+) !void {
+    const head_idx: u32 = for (nodes, 0..) |n, idx| {
+        if (n.kind == .head) break @intCast(idx);
+    } else return;
+    const head = nodes[head_idx];
+
+    var child_idx = head.first_child_idx;
+    while (child_idx != 0) : (child_idx = nodes[child_idx].next_idx) {
+        const n = nodes[child_idx];
+        if (n.kind != .meta) continue;
+
+        const declares_charset = n.attrValue(src, .html, "charset") != null or blk: {
+            const http_equiv = n.attrValue(src, .html, "http-equiv") orelse break :blk false;
+            if (!std.ascii.eqlIgnoreCase(http_equiv.slice(src), "content-type")) break :blk false;
+            const content = n.attrValue(src, .html, "content") orelse break :blk false;
+            break :blk std.ascii.indexOfIgnoreCase(content.slice(src), "charset=") != null;
+        };
+        if (!declares_charset) continue;
+
+        if (n.open.end > charset_max_offset) {
+            try errors.append(gpa, .{
+                .tag = .late_charset,
+                .main_location = n.span(src),
+                .node_idx = child_idx,
+            });
+        }
+        return;
+    }
+
+    try errors.append(gpa, .{
+        .tag = .missing_charset,
+        .main_location = head.span(src),
+        .node_idx = head_idx,
+    });
+}
+
+/// Returns the width of a start tag rendered on a single line, including its
+/// indentation.
+fn startTagWidth(
+    n: Node,
+    sti: Node.TagIterator,
+    src: []const u8,
+    indentation: u32,
+    options: RenderOptions,
+) usize {
+    var it = sti;
+    var width: usize = indentation * options.indentationWidth();
+    width += "<".len + it.name_span.len();
+    while (it.next(src)) |attr| {
+        width += " ".len + attr.name.len();
+        if (Attribute.isBoolean(n.kind, attr.name.slice(src)) and
+            Attribute.isBooleanValue(attr, src))
+        {
+            if (options.boolean_attribute_style == .value) width += "=\"\"".len + attr.name.len();
+        } else if (attr.value) |val| {
+            const quotes: usize = if (val.quote == .none) 0 else 2;
+            width += "=".len + quotes + val.span.len();
+        }
+    }
+    if (n.self_closing and !n.kind.isVoid()) width += "/".len;
+    return width + ">".len;
+}
+
+/// Iterates over the attributes of a start tag in the order they should be
+/// rendered in.
+const AttrOrderIterator = struct {
+    sti: Node.TagIterator,
+    order: AttributeOrder,
+    language: Language,
+    last: ?Key = null,
+
+    const Key = struct {
+        group: u8,
+        name: []const u8,
+        // Breaks ties between duplicate attributes so that they keep their
+        // relative order (the first one is the one that counts).
+        pos: u32,
+
+        fn lessThan(a: Key, b: Key) bool {
+            if (a.group != b.group) return a.group < b.group;
+            // SuperHTML directives are order-sensitive (eg :else must be
+            // first) so they are never sorted by name.
+            if (a.group != 0) switch (std.ascii.orderIgnoreCase(a.name, b.name)) {
+                .lt => return true,
+                .gt => return false,
+                .eq => {},
+            };
+            return a.pos < b.pos;
+        }
+    };
+
+    fn next(it: *AttrOrderIterator, src: []const u8) ?Tokenizer.Attr {
+        if (it.order == .preserve) return it.sti.next(src);
+
+        // Selection sort without allocations, start tags rarely have more
+        // than a handful of attributes.
+        var best: ?struct { Key, Tokenizer.Attr } = null;
+        var sti = it.sti;
+        var pos: u32 = 0;
+        while (sti.next(src)) |attr| : (pos += 1) {
+            const k = it.key(attr.name.slice(src), pos);
+            if (it.last) |last| if (!last.lessThan(k)) continue;
+            if (best) |b| if (!k.lessThan(b[0])) continue;
+            best = .{ k, attr };
+        }
+
+        const b = best orelse return null;
+        it.last = b[0];
+        return b[1];
+    }
+
+    fn key(it: AttrOrderIterator, name: []const u8, pos: u32) Key {
+        const group: u8 = if (it.language == .superhtml and name[0] == ':')
+            0
+        else if (std.ascii.eqlIgnoreCase(name, "id"))
+            1
+        else if (std.ascii.eqlIgnoreCase(name, "class"))
+            2
+        else if (name.len > 2 and std.ascii.startsWithIgnoreCase(name, "on"))
+            4
+        else
+            3;
+        return .{ .group = group, .name = name, .pos = pos };
+    }
+};
+
+fn isBlank(str: []const u8) bool {
+    return leadingBlanks(str) == str.len;
+}
+
+fn leadingBlanks(line: []const u8) usize {
+    for (line, 0..) |c, idx| switch (c) {
+        ' ', '\t' => {},
+        else => return idx,
+    };
+    return line.len;
+}
+
+pub const IdIndex = std.StringHashMapUnmanaged(IdEntry);
+pub const IdEntry = struct {
+    node_idx: u32,
+    /// Span of the attribute value
+    span: Span,
+};
+
+/// Builds an index of all `id` values in the document. Only the first
+/// element that uses a given id is indexed. The keys point into `src`.
+pub fn idIndex(ast: Ast, gpa: Allocator, src: []const u8) !IdIndex {
+    return buildIdIndex(gpa, ast.nodes, src, ast.language);
+}
+
+fn buildIdIndex(
+    gpa: Allocator,
+    nodes: []const Node,
+    src: []const u8,
+    language: Language,
+) !IdIndex {
+    var index: IdIndex = .empty;
+    errdefer index.deinit(gpa);
+
+    for (nodes, 0..) |n, idx| {
+        const value = n.attrValue(src, language, "id") orelse continue;
+        const id = value.slice(src);
+        // Scripted values are only known at runtime.
+        if (id.len == 0 or (language == .superhtml and id[0] == '$')) continue;
+        const gop = try index.getOrPut(gpa, id);
+        if (gop.found_existing) continue;
+        gop.value_ptr.* = .{ .node_idx = @intCast(idx), .span = value };
+    }
+
+    return index;
+}
+
+pub const IdReference = struct {
+    /// Points into `src`.
+    id: []const u8,
+    node_idx: u32,
+    /// Span of the id in the attribute value.
+    span: Span,
+    source: Source,
+
+    pub const Source = enum {
+        /// The `for` attribute of a label.
+        label,
+        /// An IDREF or IDREFS attribute, eg. [aria-labelledby] or [list].
+        idrefs,
+        /// A fragment link, eg. `href="#id"`.
+        link,
+    };
+};
+
+/// Attributes that reference elements by id, with the elements they apply
+/// to (null for all elements). IDREFS attributes hold a list of ids.
+const idref_attributes = [_]struct { []const u8, ?[]const Kind }{
+    .{ "aria-activedescendant", null },
+    .{ "aria-controls", null },
+    .{ "aria-describedby", null },
+    .{ "aria-details", null },
+    .{ "aria-errormessage", null },
+    .{ "aria-flowto", null },
+    .{ "aria-labelledby", null },
+    .{ "aria-owns", null },
+    .{ "for", &.{.output} },
+    .{ "form", &.{ .button, .fieldset, .input, .object, .output, .select, .textarea } },
+    .{ "headers", &.{ .td, .th } },
+    .{ "list", &.{.input} },
+};
+
+/// Returns all references to ids in document order: the `for` attribute of
+/// labels, each id listed in IDREF(S) attributes like [aria-labelledby],
+/// [form], [list] or [headers] and fragment links (`href="#id"`).
+/// Declarations are not included, see `idIndex` for those. The caller owns
+/// the returned slice.
+pub fn idReferences(ast: Ast, gpa: Allocator, src: []const u8) ![]const IdReference {
+    var refs = try buildIdReferences(gpa, ast.nodes, src, ast.language);
+    return refs.toOwnedSlice(gpa);
+}
+
+fn buildIdReferences(
+    gpa: Allocator,
+    nodes: []const Node,
+    src: []const u8,
+    language: Language,
+) !std.ArrayList(IdReference) {
+    var refs: std.ArrayList(IdReference) = .empty;
+    errdefer refs.deinit(gpa);
+
+    for (nodes, 0..) |n, idx| {
+        if (!n.kind.isElement()) continue;
+        var sti = n.startTagIterator(src, language);
+        while (sti.next(src)) |attr| {
+            const value = (attr.value orelse continue).span;
+            const slice = value.slice(src);
+            // Scripted values are only known at runtime.
+            if (language == .superhtml and
+                slice.len > 0 and slice[0] == '$') continue;
+
+            const name = attr.name.slice(src);
+            if (n.kind == .label and std.ascii.eqlIgnoreCase(name, "for")) {
+                if (slice.len == 0) continue;
+                try refs.append(gpa, .{
+                    .id = slice,
+                    .node_idx = @intCast(idx),
+                    .span = value,
+                    .source = .label,
+                });
+            } else if (std.ascii.eqlIgnoreCase(name, "href")) {
+                if (slice.len < 2 or slice[0] != '#') continue;
+                try refs.append(gpa, .{
+                    .id = slice[1..],
+                    .node_idx = @intCast(idx),
+                    .span = .{ .start = value.start + 1, .end = value.end },
+                    .source = .link,
+                });
+            } else if (isIdrefAttribute(n.kind, name)) {
+                var it = std.mem.tokenizeAny(u8, slice, &std.ascii.whitespace);
+                while (it.next()) |id| {
+                    const start: u32 = @intCast(value.start + it.index - id.len);
+                    try refs.append(gpa, .{
+                        .id = id,
+                        .node_idx = @intCast(idx),
+                        .span = .{ .start = start, .end = @intCast(start + id.len) },
+                        .source = .idrefs,
+                    });
+                }
+            }
+        }
+    }
+
+    return refs;
+}
+
+fn isIdrefAttribute(kind: Kind, name: []const u8) bool {
+    for (idref_attributes) |entry| {
+        if (!std.ascii.eqlIgnoreCase(entry[0], name)) continue;
+        const allowed = entry[1] orelse return true;
+        return std.mem.indexOfScalar(Kind, allowed, kind) != null;
+    }
+    return false;
+}
+
+/// Reports ids referenced by IDREF(S) attributes that don't belong to any
+/// element. Labels are checked by `validateLabels`, while fragment links are
+/// not checked since `#top` scrolls to the top even without a matching id.
+fn validateIdReferences(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+) !void {
+    // In SuperHTML the target might be defined by the layout or by a
+    // template that extends this one.
+    if (language == .superhtml) return;
+
+    var ids = try buildIdIndex(gpa, nodes, src, language);
+    defer ids.deinit(gpa);
+    var refs = try buildIdReferences(gpa, nodes, src, language);
+    defer refs.deinit(gpa);
+
+    for (refs.items) |ref| {
+        if (ref.source != .idrefs) continue;
+        if (ids.contains(ref.id)) continue;
+        try errors.append(gpa, .{
+            .tag = .id_not_found,
+            .main_location = ref.span,
+            .node_idx = ref.node_idx,
+        });
+    }
+}
+
+// Runs after the whole document has been parsed since `for` is allowed to
+// reference elements that come later in the document.
+fn validateLabels(
+    gpa: Allocator,
+    nodes: []const Node,
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    language: Language,
+) !void {
+    var ids = try buildIdIndex(gpa, nodes, src, language);
+    defer ids.deinit(gpa);
+
+    for (nodes, 0..) |n, idx| {
+        if (n.kind != .label) continue;
+        const value = n.attrValue(src, language, "for") orelse continue;
+        // Empty values are already reported by attribute validation.
+        if (value.len() == 0) continue;
+        if (language == .superhtml and value.slice(src)[0] == '$') continue;
+
+        const entry = ids.get(value.slice(src)) orelse {
+            // In SuperHTML the target might be defined by the layout or by
+            // a template that extends this one.
+            if (language == .superhtml) continue;
+            try errors.append(gpa, .{
+                .tag = .label_for_not_found,
+                .main_location = value,
+                .node_idx = @intCast(idx),
+            });
+            continue;
+        };
+
+        if (!isLabelable(nodes[entry.node_idx], src, language)) {
+            try errors.append(gpa, .{
+                .tag = .{ .label_for_not_labelable = entry.span },
+                .main_location = value,
+                .node_idx = @intCast(idx),
+            });
+        }
+    }
+}
+
+fn isLabelable(n: Node, src: []const u8, language: Language) bool {
+    return switch (n.kind) {
+        .button, .meter, .output, .progress, .select, .textarea => true,
+        .input => if (n.attrValue(src, language, "type")) |t|
+            !std.ascii.eqlIgnoreCase(t.slice(src), "hidden")
+        else
+            true,
+        // Custom elements can be form-associated.
+        .___ => true,
+        else => false,
+    };
+}
+
+// Only executed if strict is enabled
+pub fn validateNesting(
+    gpa: Allocator,
+    nodes: []const Node,
+    seen_attrs: *std.StringHashMapUnmanaged(Span),
+    seen_ids_stack: *std.ArrayList(std.StringHashMapUnmanaged(Span)),
+    errors: *std.ArrayListUnmanaged(Error),
+    src: []const u8,
+    fragment: bool,
+) !void {
+    var node_idx: u32 = 0;
+    while (node_idx < nodes.len) {
+        log.debug("validating {}", .{node_idx});
+        const n = nodes[node_idx];
+        if (node_idx == 0 and fragment) {
+            // The top level of a fragment can contain anything.
+            if (n.first_child_idx == 0) return;
+            node_idx = n.first_child_idx;
+            continue;
+        }
+        if (n.first_child_idx != 0 and Element.isTransparent(n, src)) {
+            // Transparent elements are skipped, their children are validated
+            // as if they were children of the closest non-transparent
+            // ancestor.
+            node_idx = n.first_child_idx;
+            continue;
+        }
+        switch (n.kind) {
+            .extend,
+            .super,
+            .ctx,
+            // html
+            .area,
+            .base,
+            .br,
+            .col,
+            .embed,
+            .hr,
+            .img,
+            .input,
+            .link,
+            .meta,
+            .source,
+            .track,
+            .wbr,
+            // end void
+            .svg,
+            .math,
+            .___,
+            .comment,
             .text,
             .doctype,
             => {
@@ -1502,6 +3306,9 @@ pub const Completion = struct {
     // This value is used by the lsp to know how to interpret
     // the value field of this list of suggestions.
     kind: enum { attribute, element_open, element_close } = .attribute,
+    /// Set for obsolete elements, which editors should show as deprecated
+    /// and sort after the others.
+    obsolete: bool = false,
 };
 
 pub fn completions(
@@ -1528,6 +3335,9 @@ pub fn completions(
         cpllog.debug("completions before check", .{});
         const parent_idx = err.node_idx;
         const parent_node = ast.nodes[parent_idx];
+        if (foreign.namespace(ast.nodes, src, parent_idx)) |ns| {
+            return foreign.elementCompletions(ns);
+        }
         if ((!parent_node.kind.isElement() and
             parent_node.kind != .root) or
             parent_node.kind == .svg or
@@ -1537,7 +3347,21 @@ pub fn completions(
 
         const e = Element.all.get(parent_node.kind);
         cpllog.debug("===== completions content: {t}", .{parent_node.kind});
-        return e.completions(arena, ast, src, parent_idx, offset, .content);
+        const cpls = try e.completions(arena, ast, src, parent_idx, offset, .content);
+
+        // Obsolete elements are offered wherever other elements are, so that
+        // their replacement shows up while typing them.
+        for (cpls) |cpl| {
+            if (cpl.kind != .element_open) continue;
+            var with_obsolete: std.ArrayList(Completion) = try .initCapacity(
+                arena,
+                cpls.len + Element.obsolete_completions.len,
+            );
+            with_obsolete.appendSliceAssumeCapacity(cpls);
+            with_obsolete.appendSliceAssumeCapacity(Element.obsolete_completions);
+            return with_obsolete.items;
+        }
+        return cpls;
     }
 
     const node_idx = ast.findNodeTagsIdx(offset);
@@ -1548,11 +3372,45 @@ pub fn completions(
     cpllog.debug("===== node: {any}", .{n});
     if (!n.kind.isElement()) return &.{};
     if (offset >= n.open.end) return &.{};
+    if (n.kind == .___) {
+        if (foreign.namespace(ast.nodes, src, n.parent_idx)) |ns| {
+            return foreign.attributeCompletions(ns);
+        }
+    }
 
     const e = Element.all.get(n.kind);
     return e.completions(arena, ast, src, node_idx, offset, .attrs);
 }
 
+/// Returns the tag name of the element whose start tag ends at `offset` if
+/// an end tag should be inserted right after it, eg. because the user just
+/// typed the `>` of `<section>`. Void elements, self-closing tags and
+/// foreign elements that are usually empty never need one.
+pub fn missingEndTag(ast: Ast, src: []const u8, offset: u32) ?Span {
+    const idx: u32 = for (ast.nodes, 0..) |n, i| {
+        if (n.kind.isElement() and n.open.end == offset) break @intCast(i);
+    } else return null;
+    const n = ast.nodes[idx];
+    if (n.kind.isVoid() or n.self_closing) return null;
+
+    const name = n.startTagIterator(src, ast.language).name_span;
+    if (foreign.namespace(ast.nodes, src, n.parent_idx)) |ns| {
+        if (ns.isEmpty(name.slice(src))) return null;
+    }
+    if (n.close.start == 0) return name;
+
+    // A new start tag steals the end tag of an ancestor with the same name,
+    // eg. `<div><div></div>`, in which case the end tag is still missing.
+    var parent_idx = n.parent_idx;
+    while (parent_idx != 0) : (parent_idx = ast.nodes[parent_idx].parent_idx) {
+        const p = ast.nodes[parent_idx];
+        if (p.close.start != 0) continue;
+        const p_name = p.startTagIterator(src, ast.language).name_span;
+        if (std.ascii.eqlIgnoreCase(p_name.slice(src), name.slice(src))) return name;
+    }
+    return null;
+}
+
 pub fn description(ast: *const Ast, src: []const u8, offset: u32) ?[]const u8 {
     const node_idx = ast.findNodeTagsIdx(offset);
     if (node_idx == 0) return null;
@@ -1682,12 +3540,16 @@ pub fn child(ast: Ast, n: Node) ?Node {
 pub fn formatter(ast: Ast, src: []const u8) Formatter {
     return .{ .ast = ast, .src = src };
 }
+pub fn formatterOptions(ast: Ast, src: []const u8, options: RenderOptions) Formatter {
+    return .{ .ast = ast, .src = src, .options = options };
+}
 const Formatter = struct {
     ast: Ast,
     src: []const u8,
+    options: RenderOptions = .{},
 
     pub fn format(f: Formatter, w: *Writer) !void {
-        try f.ast.render(f.src, w);
+        try f.ast.render(f.src, w, f.options);
     }
 };
 
@@ -1745,7 +3607,7 @@ fn debugNodes(nodes: []const Node, src: []const u8) void {
 test "basics" {
     const case = "<html><head></head><body><div><br></div></body></html>\n";
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
@@ -1756,7 +3618,7 @@ test "basics - attributes" {
         \\<div id="foo" class="bar">
     ++ "<link></div></body></html>\n";
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
@@ -1783,7 +3645,7 @@ test "newlines" {
         \\</html>
         \\
     , .{'\t'});
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -1802,7 +3664,7 @@ test "tight tags inner indentation" {
         \\</html>
         \\
     , .{'\t'});
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
@@ -1819,7 +3681,7 @@ test "bad html" {
         \\
         \\</html>
     ;
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
@@ -1841,7 +3703,7 @@ test "formatting - simple" {
         \\</html>
         \\
     , .{'\t'});
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -1873,7 +3735,7 @@ test "formatting - attributes" {
         \\</html>
         \\
     , .{'\t'});
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -1891,7 +3753,7 @@ test "pre" {
         \\
     ;
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -1910,7 +3772,7 @@ test "pre text" {
         \\
     , .{'\t'});
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -1948,7 +3810,7 @@ test "what" {
         \\
     , .{'\t'});
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -1985,7 +3847,7 @@ test "spans" {
         \\
     , .{'\t'});
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -1996,7 +3858,7 @@ test "arrow span" {
         \\
     ;
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
@@ -2022,7 +3884,7 @@ test "self-closing tag complex example" {
         \\</div>
         \\
     , .{'\t'});
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -2075,7 +3937,7 @@ test "respect empty lines" {
         \\</div>
         \\
     , .{'\t'});
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
 
     try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
@@ -2098,11 +3960,1399 @@ test "pre formatting" {
         \\
     , .{'\t'});
 
-    const ast = try Ast.init(std.testing.allocator, case, .html, false);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
+}
+
+test "pre leading and trailing newlines" {
+    // Browsers drop a single newline right after the start tag of <pre> and
+    // <textarea>, so a second one is significant and must be preserved.
+    const case =
+        \\<div>
+        \\	<pre>
+        \\
+        \\  first
+        \\    second
+        \\
+        \\</pre>
+        \\	<textarea>
+        \\
+        \\   text
+        \\</textarea>
+        \\</div>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
+}
+
+test "pre nested elements" {
+    const case =
+        \\<div>
+        \\	<pre><code class="a"
+        \\   id="b">  foo
+        \\      <span>bar</span>
+        \\</code>
+        \\</pre>
+        \\	<div style="color: red; white-space: pre-wrap">  one
+        \\     two  </div>
+        \\</div>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
     defer ast.deinit(std.testing.allocator);
     try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
 }
 
+test "canonical attribute order" {
+    {
+        const case =
+            \\<div onclick="f()" data-b="1" class="c" hidden id="x" DATA-A title="t" class="d"></div>
+            \\
+        ;
+        const expected =
+            \\<div id="x" class="c" class="d" DATA-A data-b="1" hidden title="t" onclick="f()"></div>
+            \\
+        ;
+
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectFmt(case, "{f}", .{ast.formatter(case)});
+        try std.testing.expectFmt(expected, "{f}", .{
+            ast.formatterOptions(case, .{ .attribute_order = .canonical }),
+        });
+    }
+    {
+        const case =
+            \\<div :loop="$page.tags" :if="$loop.it" title="t" id="a"></div>
+            \\
+        ;
+        const expected =
+            \\<div :loop="$page.tags" :if="$loop.it" id="a" title="t"></div>
+            \\
+        ;
+
+        const ast = try Ast.init(std.testing.allocator, case, .superhtml, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectFmt(expected, "{f}", .{
+            ast.formatterOptions(case, .{ .attribute_order = .canonical }),
+        });
+    }
+}
+
+test "print width" {
+    const case =
+        \\<div>
+        \\	<a href="https://example.com/a/very/long/path" class="link external" target="_blank">Link</a>
+        \\	<p id="x">short</p>
+        \\	<svg><path d="M 10 10 L 20 20 L 30 30 L 40 40 L 50 50"/></svg>
+        \\</div>
+        \\
+    ;
+    const expected =
+        \\<div>
+        \\	<a
+        \\		href="https://example.com/a/very/long/path"
+        \\		class="link external"
+        \\		target="_blank"
+        \\	>Link</a>
+        \\	<p id="x">short</p>
+        \\	<svg><path
+        \\		d="M 10 10 L 20 20 L 30 30 L 40 40 L 50 50"
+        \\	/></svg>
+        \\</div>
+        \\
+    ;
+
+    inline for (.{ case, expected }) |src| {
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectFmt(expected, "{f}", .{
+            ast.formatterOptions(src, .{ .print_width = 40 }),
+        });
+    }
+}
+
+test "range formatting" {
+    const src =
+        \\<div>
+        \\	<p>before</p>
+        \\      <ul>
+        \\ <li>a</li>
+        \\      </ul>
+        \\	<p>after</p>
+        \\</div>
+        \\
+    ;
+    const expected =
+        \\	<ul>
+        \\		<li>a</li>
+        \\	</ul>
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, src, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+
+    // The paragraphs straddle the range and are left alone.
+    const range: Span = .{
+        .start = @intCast(std.mem.indexOf(u8, src, "fore").?),
+        .end = @intCast(std.mem.indexOf(u8, src, "ter").?),
+    };
+    const frags = try ast.fragments(std.testing.allocator, src, range);
+    defer std.testing.allocator.free(frags);
+    try std.testing.expectEqual(1, frags.len);
+    try std.testing.expect(ast.nodes[frags[0].first_idx].kind == .ul);
+
+    var aw: Writer.Allocating = .init(std.testing.allocator);
+    defer aw.deinit();
+    try ast.renderFragment(src, &aw.writer, .{}, frags[0]);
+    try std.testing.expectEqualStrings(expected, aw.written());
+
+    const start: u32 = @intCast(std.mem.indexOf(u8, src, "      <ul>").?);
+    try std.testing.expectEqual(start, frags[0].span.start);
+    const stop: u32 = @intCast(std.mem.indexOf(u8, src, "</ul>").? + "</ul>".len);
+    try std.testing.expectEqual(stop, frags[0].span.end);
+}
+
+test "boolean attributes" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\	<head>
+        \\		<meta charset="utf-8">
+        \\		<title>Test</title>
+        \\	</head>
+        \\	<body>
+        \\		<button disabled="">A</button>
+        \\		<button DISABLED="Disabled">B</button>
+        \\		<button disabled="no">C</button>
+        \\	</body>
+        \\</html>
+        \\
+    ;
+    const collapsed =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\	<head>
+        \\		<meta charset="utf-8">
+        \\		<title>Test</title>
+        \\	</head>
+        \\	<body>
+        \\		<button disabled>A</button>
+        \\		<button DISABLED>B</button>
+        \\		<button disabled="no">C</button>
+        \\	</body>
+        \\</html>
+        \\
+    ;
+    const valued =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\	<head>
+        \\		<meta charset="utf-8">
+        \\		<title>Test</title>
+        \\	</head>
+        \\	<body>
+        \\		<button disabled="disabled">A</button>
+        \\		<button DISABLED="DISABLED">B</button>
+        \\		<button disabled="no">C</button>
+        \\	</body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+
+    // Only the value that is neither empty nor the attribute name is wrong.
+    try std.testing.expectEqual(1, ast.errors.len);
+    try std.testing.expect(ast.errors[0].tag == .boolean_attr);
+    try std.testing.expectEqualStrings(
+        "<button disabled=\"no\">",
+        ast.nodes[ast.errors[0].node_idx].open.slice(case),
+    );
+
+    try std.testing.expectFmt(collapsed, "{f}", .{ast.formatter(case)});
+    try std.testing.expectFmt(valued, "{f}", .{
+        ast.formatterOptions(case, .{ .boolean_attribute_style = .value }),
+    });
+}
+
+test "indentation style" {
+    const case =
+        \\<div>
+        \\	<ul>
+        \\		<li>One</li>
+        \\	</ul>
+        \\	<pre>
+        \\	keep	this
+        \\</pre>
+        \\</div>
+        \\
+    ;
+    const spaces =
+        \\<div>
+        \\  <ul>
+        \\    <li>One</li>
+        \\  </ul>
+        \\  <pre>
+        \\	keep	this
+        \\</pre>
+        \\</div>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+
+    try std.testing.expectFmt(spaces, "{f}", .{ast.formatterOptions(case, .{
+        .indent_style = .space,
+        .indent_width = 2,
+    })});
+    // The width only applies to spaces.
+    try std.testing.expectFmt(case, "{f}", .{ast.formatterOptions(case, .{
+        .indent_width = 2,
+    })});
+}
+
+test "blank lines" {
+    const case =
+        \\<div>
+        \\
+        \\	<p>A</p>
+        \\
+        \\
+        \\
+        \\	<p>B</p>
+        \\	<p>C</p>
+        \\
+        \\</div>
+        \\
+    ;
+    const collapsed =
+        \\<div>
+        \\
+        \\	<p>A</p>
+        \\
+        \\	<p>B</p>
+        \\	<p>C</p>
+        \\</div>
+        \\
+    ;
+    const preserved =
+        \\<div>
+        \\	<p>A</p>
+        \\
+        \\	<p>B</p>
+        \\	<p>C</p>
+        \\</div>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+
+    try std.testing.expectFmt(collapsed, "{f}", .{ast.formatter(case)});
+    try std.testing.expectFmt(preserved, "{f}", .{ast.formatterOptions(case, .{
+        .blank_lines = .@"preserve-one",
+    })});
+}
+
+test "style and script indentation" {
+    const case =
+        \\<div>
+        \\<style>
+        \\        .a {
+        \\          color: red;
+        \\        }
+        \\
+        \\        .b {}
+        \\</style>
+        \\<script>
+        \\    if (x) {
+        \\      s = "</div>";
+        \\    }
+        \\</script>
+        \\<script type="application/json">
+        \\  {"a":
+        \\      1}
+        \\</script>
+        \\<style></style>
+        \\</div>
+        \\
+    ;
+    const expected = comptime std.fmt.comptimePrint(
+        \\<div>
+        \\{0c}<style>
+        \\{0c}{0c}.a {{
+        \\{0c}{0c}  color: red;
+        \\{0c}{0c}}}
+        \\
+        \\{0c}{0c}.b {{}}
+        \\{0c}</style>
+        \\{0c}<script>
+        \\{0c}{0c}if (x) {{
+        \\{0c}{0c}  s = "</div>";
+        \\{0c}{0c}}}
+        \\{0c}</script>
+        \\{0c}<script type="application/json">
+        \\  {{"a":
+        \\      1}}
+        \\</script>
+        \\{0c}<style></style>
+        \\</div>
+        \\
+    , .{'\t'});
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectFmt(expected, "{f}", .{ast.formatter(case)});
+}
+
+test "duplicate id" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <div id="a"></div>
+        \\    <div id="b"></div>
+        \\    <p id="a"></p>
+        \\    <template><div id="a"></div></template>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(1, ast.errors.len);
+    const err = ast.errors[0];
+    try std.testing.expect(err.tag == .duplicate_id);
+    try std.testing.expectEqual(
+        std.mem.indexOf(u8, case, "\"a\"></p>").? + 1,
+        err.main_location.start,
+    );
+    try std.testing.expectEqual(
+        std.mem.indexOf(u8, case, "\"a\"></div>").? + 1,
+        err.tag.duplicate_id.start,
+    );
+}
+
+test "duplicate attributes" {
+    {
+        const case =
+            \\<!DOCTYPE html>
+            \\<html>
+            \\  <head><meta charset="utf-8"><title>Test</title></head>
+            \\  <body>
+            \\    <input type="text" TYPE="email">
+            \\    <my-widget foo="a" foo="b"></my-widget>
+            \\  </body>
+            \\</html>
+            \\
+        ;
+
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(2, ast.errors.len);
+        for (ast.errors) |err| {
+            try std.testing.expect(err.tag == .duplicate_attribute_name);
+        }
+        try std.testing.expectEqualStrings("TYPE", ast.errors[0].main_location.slice(case));
+        try std.testing.expectEqualStrings(
+            "type",
+            ast.errors[0].tag.duplicate_attribute_name.slice(case),
+        );
+        try std.testing.expectEqual(
+            std.mem.indexOf(u8, case, "foo=\"b\"").?,
+            ast.errors[1].main_location.start,
+        );
+    }
+    {
+        const case =
+            \\<div class="a" class="$page.custom.get('class')"></div>
+            \\<p :if="$page.draft" :if="$page.x"></p>
+            \\
+        ;
+
+        const ast = try Ast.init(std.testing.allocator, case, .superhtml, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+}
+
+test "img alt" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <img src="a.png">
+        \\    <img src="b.png" alt="">
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        try std.testing.expect(ast.errors[0].tag == .missing_alt);
+        try std.testing.expectEqual(.warning, ast.errors[0].severity);
+    }
+
+    {
+        var rules: Rules = .default;
+        rules.set(.@"img-alt", .off);
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+}
+
+test "label for" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <label for="name">Name</label>
+        \\    <label for="missing">Missing</label>
+        \\    <label for="box">Box</label>
+        \\    <input id="name">
+        \\    <div id="box"></div>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(2, ast.errors.len);
+    try std.testing.expect(ast.errors[0].tag == .label_for_not_found);
+    try std.testing.expectEqualStrings("missing", ast.errors[0].main_location.slice(case));
+    try std.testing.expect(ast.errors[1].tag == .label_for_not_labelable);
+    try std.testing.expectEqualStrings("box", ast.errors[1].tag.label_for_not_labelable.slice(case));
+}
+
+test "id references" {
+    const case =
+        \\<label for="name">Name</label>
+        \\<input id="name" aria-describedby="hint  name-help">
+        \\<p id="hint">Hint</p>
+        \\<p id="name-help" aria-labelledby="name">Help</p>
+        \\<a href="#name">Go</a>
+        \\<a href="/page#name">Elsewhere</a>
+        \\<a href="#">Top</a>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    const refs = try ast.idReferences(std.testing.allocator, case);
+    defer std.testing.allocator.free(refs);
+
+    const expected = [_][]const u8{ "name", "hint", "name-help", "name", "name" };
+    try std.testing.expectEqual(expected.len, refs.len);
+    for (refs, expected) |ref, id| {
+        try std.testing.expectEqualStrings(id, ref.id);
+        try std.testing.expectEqualStrings(id, ref.span.slice(case));
+    }
+    try std.testing.expectEqual(
+        std.mem.indexOf(u8, case, "name\">Go").?,
+        refs[4].span.start,
+    );
+}
+
+test "dangling id references" {
+    const case =
+        \\<form id="signup"></form>
+        \\<input form="signup" list="colors" aria-describedby="hint typo">
+        \\<input form="singup" list="colours">
+        \\<datalist id="colors"></datalist>
+        \\<p id="hint">Hint</p>
+        \\<a href="#top">Top</a>
+        \\<table><tr><th id="h">H</th><td headers="h x">A</td></tr></table>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{
+        .fragment = true,
+    });
+    defer ast.deinit(std.testing.allocator);
+
+    const expected = [_][]const u8{ "typo", "singup", "colours", "x" };
+    try std.testing.expectEqual(expected.len, ast.errors.len);
+    for (ast.errors, expected) |err, id| {
+        try std.testing.expect(err.tag == .id_not_found);
+        try std.testing.expectEqual(.warning, err.severity);
+        try std.testing.expectEqualStrings(id, err.main_location.slice(case));
+    }
+
+    var rules: Rules = .default;
+    rules.set(.@"id-reference", .off);
+    const ast_off = try Ast.init(std.testing.allocator, case, .html, .{
+        .fragment = true,
+        .rules = rules,
+    });
+    defer ast_off.deinit(std.testing.allocator);
+    try std.testing.expectEqual(0, ast_off.errors.len);
+}
+
+test "obsolete elements" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <center>Hello</center>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(1, ast.errors.len);
+    const err = ast.errors[0];
+    try std.testing.expectEqual(.warning, err.severity);
+    try std.testing.expectEqualStrings(
+        "CSS text-align",
+        err.tag.deprecated_and_unsupported,
+    );
+}
+
+test "obsolete element completions" {
+    var arena_impl: std.heap.ArenaAllocator = .init(std.testing.allocator);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    const case =
+        \\<div>
+        \\  <
+        \\</div>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+
+    const offset: u32 = @intCast(std.mem.indexOfScalar(u8, case[1..], '<').? + 2);
+    const cpls = try ast.completions(arena, case, offset);
+
+    var seen_obsolete = false;
+    var found_center = false;
+    for (cpls) |cpl| {
+        if (!cpl.obsolete) {
+            try std.testing.expect(!seen_obsolete);
+            continue;
+        }
+        seen_obsolete = true;
+        if (std.mem.eql(u8, cpl.label, "center")) {
+            found_center = true;
+            try std.testing.expectEqualStrings(
+                "Obsolete element, use CSS text-align instead.",
+                cpl.desc,
+            );
+        }
+    }
+    try std.testing.expect(found_center);
+}
+
+test "custom elements" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <my-widget foo="bar" data-x><div></div></my-widget>
+        \\    <ul><my-item><li>Item</li></my-item></ul>
+        \\    <span><my-wrapper><div></div></my-wrapper></span>
+        \\    <annotation-xml></annotation-xml>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(2, ast.errors.len);
+    try std.testing.expect(ast.errors[0].tag == .invalid_html_tag_name);
+    try std.testing.expectEqualStrings(
+        "annotation-xml",
+        ast.errors[0].main_location.slice(case),
+    );
+    try std.testing.expect(ast.errors[1].tag == .invalid_nesting);
+    try std.testing.expectEqualStrings(
+        "span",
+        ast.errors[1].tag.invalid_nesting.span.slice(case),
+    );
+}
+
+test "template content" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <template><tr><td>Cell</td></tr></template>
+        \\    <template><li value="1">Item</li><legend>Title</legend></template>
+        \\    <template><area shape="default" href="/" alt="Home"><main></main></template>
+        \\    <a href="/"><template><a href="/">Link</a></template></a>
+        \\    <template><template><td>Nested</td></template></template>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(0, ast.errors.len);
+
+    // The subtree is still built normally.
+    for (ast.nodes) |n| {
+        if (n.kind != .td) continue;
+        try std.testing.expect(ast.nodes[n.parent_idx].kind == .tr or
+            ast.nodes[n.parent_idx].kind == .template);
+    }
+}
+
+test "foreign content" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <svg viewBox="0 0 10 10" xmlns="http://www.w3.org/2000/svg">
+        \\      <defs>
+        \\        <linearGradient id="g" gradientUnits="userSpaceOnUse">
+        \\          <stop offset="0" stop-color="red"/>
+        \\        </linearGradient>
+        \\      </defs>
+        \\      <path d="M0 0L10 10" fill="url(#g)" xlink:href="#g"/>
+        \\      <circle cx="5" cy="5" r="2" data-x="1" ></circle>
+        \\      <lineargradient></lineargradient>
+        \\      <rect viewbox="0 0 1 1" foo="bar"/>
+        \\      <foreignObject><div foo="bar"></div></foreignObject>
+        \\    </svg>
+        \\    <math><mi>x</mi><mfrac><mn>1</mn><mn>2</mn></mfrac><mfoo></mfoo></math>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    var arena_impl: std.heap.ArenaAllocator = .init(std.testing.allocator);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(4, ast.errors.len);
+    const expected = [_]struct { name: []const u8, suggestion: ?[]const u8 }{
+        .{ .name = "lineargradient", .suggestion = "linearGradient" },
+        .{ .name = "viewbox", .suggestion = "viewBox" },
+        .{ .name = "foo", .suggestion = null },
+        .{ .name = "mfoo", .suggestion = null },
+    };
+    for (ast.errors, expected) |err, e| {
+        try std.testing.expectEqualStrings(e.name, err.main_location.slice(case));
+        const name = switch (err.tag) {
+            .invalid_foreign_tag_name, .invalid_foreign_attr => |n| n,
+            else => return error.TestUnexpectedResult,
+        };
+        if (e.suggestion) |s| {
+            try std.testing.expectEqualStrings(s, name.suggestion.?);
+        } else {
+            try std.testing.expect(name.suggestion == null);
+        }
+    }
+    try std.testing.expect(ast.errors[3].tag.invalid_foreign_tag_name.namespace == .math);
+
+    const offset: u32 = @intCast(std.mem.indexOf(u8, case, "\"1\" >").? + "\"1\" ".len);
+    const cpls = try ast.completions(arena, case, offset);
+    for (cpls) |cpl| {
+        if (std.mem.eql(u8, cpl.label, "viewBox")) break;
+    } else return error.TestUnexpectedResult;
+}
+
+test "superhtml validation" {
+    const case =
+        \\<extend template="base.shtml">
+        \\<div id="content">
+        \\  <ul :if="$page.tags">
+        \\    <li :loop="$page.tags" :text="$loop.it"></li>
+        \\  </ul>
+        \\  <ul><ctx :loop="$page.tags"><li :text="$loop.it"></li></ctx></ul>
+        \\  <input type="$page.custom.get('type')">
+        \\  <span><ctx :if="$page.draft"><div></div></ctx></span>
+        \\</div>
+        \\
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .superhtml, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        try std.testing.expect(ast.errors[0].tag == .invalid_nesting);
+        try std.testing.expectEqualStrings(
+            "span",
+            ast.errors[0].tag.invalid_nesting.span.slice(case),
+        );
+    }
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .superhtml, .{
+            .superhtml_validation = false,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+}
+
+test "enumerated attribute values" {
+    const cases = .{
+        .{ "<input type=\"emial\">", "emial", "email" },
+        .{ "<input type=\"EMAIL\">", "", "" },
+        .{ "<table><tr><th scope=\"col-row\">A</th></tr></table>", "col-row", "" },
+        .{ "<table><tr><th scope=\"rowgrup\">A</th></tr></table>", "rowgrup", "rowgroup" },
+    };
+
+    inline for (cases) |case| {
+        const ast = try Ast.init(std.testing.allocator, case[0], .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        if (case[1].len == 0) {
+            try std.testing.expectEqual(0, ast.errors.len);
+        } else {
+            try std.testing.expectEqual(1, ast.errors.len);
+            const err = ast.errors[0];
+            try std.testing.expectEqualStrings(case[1], err.main_location.slice(case[0]));
+            const iav = err.tag.invalid_attr_value;
+            try std.testing.expect(iav.expected.len > 0);
+            if (case[2].len == 0) {
+                try std.testing.expect(iav.suggestion == null);
+            } else {
+                try std.testing.expectEqualStrings(case[2], iav.suggestion.?);
+            }
+        }
+    }
+
+    // Interpolated values are only known at runtime.
+    const template = "<input type=\"$page.custom.type\">";
+    const ast = try Ast.init(std.testing.allocator, template, .superhtml, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(0, ast.errors.len);
+}
+
+test "input type attributes" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <input min="1" checked>
+        \\    <input type="checkbox" checked>
+        \\    <input type="number" min="1" max="10" step="1" accept="image/*">
+        \\    <input type="image" src="foo.png" alt="Foo" width="10">
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(3, ast.errors.len);
+    const expected = [_]struct { name: []const u8, type: []const u8 }{
+        .{ .name = "checked", .type = "text" },
+        .{ .name = "min", .type = "text" },
+        .{ .name = "accept", .type = "number" },
+    };
+    for (ast.errors, expected) |err, e| {
+        try std.testing.expectEqual(.warning, err.severity);
+        try std.testing.expectEqualStrings(e.name, err.main_location.slice(case));
+        try std.testing.expectEqualStrings(e.type, err.tag.input_type_mismatch);
+    }
+}
+
+test "aria attributes" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <div aria-hidden="true" aria-expanded="maybe" aria-foo="bar"></div>
+        \\    <span data-state="a"></span><span ></span>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    var arena_impl: std.heap.ArenaAllocator = .init(std.testing.allocator);
+    defer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(2, ast.errors.len);
+    try std.testing.expectEqualStrings("maybe", ast.errors[0].main_location.slice(case));
+    try std.testing.expect(ast.errors[1].tag == .invalid_attr);
+    try std.testing.expectEqualStrings("aria-foo", ast.errors[1].main_location.slice(case));
+
+    const offset: u32 = @intCast(std.mem.indexOf(u8, case, "<span >").? + "<span ".len);
+    const cpls = try ast.completions(arena, case, offset);
+    var found_aria = false;
+    var found_data = false;
+    for (cpls) |cpl| {
+        found_aria = found_aria or std.mem.eql(u8, cpl.label, "aria-expanded");
+        found_data = found_data or std.mem.eql(u8, cpl.label, "data-state");
+    }
+    try std.testing.expect(found_aria);
+    try std.testing.expect(found_data);
+}
+
+test "heading order" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <h1>Title</h1>
+        \\    <h3>Skipped</h3>
+        \\    <section><h3>Section</h3><h4>Sub</h4></section>
+        \\    <h4>After</h4>
+        \\    <h2>Up</h2>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+    {
+        var rules: Rules = .default;
+        rules.set(.@"heading-order", .warn);
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        const err = ast.errors[0];
+        try std.testing.expect(err.tag == .heading_level_skipped);
+        try std.testing.expectEqual(.warning, err.severity);
+        try std.testing.expectEqual(
+            std.mem.indexOf(u8, case, "h3>Skipped").?,
+            err.main_location.start,
+        );
+        try std.testing.expectEqual(
+            std.mem.indexOf(u8, case, "h1>").?,
+            err.tag.heading_level_skipped.start,
+        );
+    }
+}
+
+test "charset" {
+    const missing =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><title>Test</title></head>
+        \\  <body></body>
+        \\</html>
+        \\
+    ;
+    const legacy =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head>
+        \\    <meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+        \\    <title>Test</title>
+        \\  </head>
+        \\  <body></body>
+        \\</html>
+        \\
+    ;
+    const late = "<!DOCTYPE html>\n<html>\n  <head>\n    <!-- " ++
+        ("a" ** charset_max_offset) ++
+        " -->\n    <meta charset=\"utf-8\">\n    <title>Test</title>\n  </head>\n" ++
+        "  <body></body>\n</html>\n";
+    const fragment = "<p>No head</p>\n";
+
+    inline for (.{
+        .{ missing, .missing_charset },
+        .{ late, .late_charset },
+    }) |case| {
+        const ast = try Ast.init(std.testing.allocator, case[0], .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        try std.testing.expect(ast.errors[0].tag == case[1]);
+        try std.testing.expectEqual(.warning, ast.errors[0].severity);
+    }
+
+    inline for (.{ legacy, fragment }) |src| {
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+
+    {
+        var rules: Rules = .default;
+        rules.set(.charset, .off);
+        const ast = try Ast.init(std.testing.allocator, missing, .html, .{
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+}
+
+test "link names" {
+    const empty_cases: []const [:0]const u8 = &.{
+        "<a href=\"/\"></a>",
+        "<a href=\"/\">\n  </a>",
+        "<a href=\"/\"><img src=\"icon.png\" alt=\"\"></a>",
+        "<a href=\"/\"><span></span><!-- icon --></a>",
+    };
+    const named_cases: []const [:0]const u8 = &.{
+        "<a href=\"/\">Home</a>",
+        "<a href=\"/\"><span><b>Home</b></span></a>",
+        "<a href=\"/\"><img src=\"icon.png\" alt=\"Home\"></a>",
+        "<a href=\"/\" aria-label=\"Home\"><img src=\"icon.png\" alt=\"\"></a>",
+        "<a href=\"/\" aria-labelledby=\"home\"></a><span id=\"home\">Home</span>",
+        "<a id=\"top\"></a>",
+    };
+
+    for (empty_cases) |case| {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        try std.testing.expect(ast.errors[0].tag == .empty_link);
+        try std.testing.expectEqual(.warning, ast.errors[0].severity);
+    }
+
+    for (named_cases) |case| {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+
+    // Interpolated content is assumed to be non-empty.
+    const template = "<a href=\"$page.link()\" :text=\"$page.title\"></a>";
+    const ast = try Ast.init(std.testing.allocator, template, .superhtml, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(0, ast.errors.len);
+}
+
+test "dimensions" {
+    const missing_cases: []const [:0]const u8 = &.{
+        "<img src=\"a.png\" alt=\"A\">",
+        "<img src=\"a.png\" alt=\"A\" width=\"100\">",
+        "<iframe src=\"a.html\" height=\"100\"></iframe>",
+        "<img src=\"a.png\" alt=\"A\" style=\"max-width: 100%\">",
+    };
+    const sized_cases: []const [:0]const u8 = &.{
+        "<img src=\"a.png\" alt=\"A\" width=\"100\" height=\"50\">",
+        "<iframe src=\"a.html\" width=\"100\" height=\"50\"></iframe>",
+        "<img src=\"a.png\" alt=\"A\" style=\"width: 100%; aspect-ratio: 16 / 9\">",
+    };
+
+    {
+        const ast = try Ast.init(std.testing.allocator, missing_cases[0], .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+
+    var rules: Rules = .default;
+    rules.set(.dimensions, .warn);
+
+    for (missing_cases) |case| {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        try std.testing.expect(ast.errors[0].tag == .missing_dimensions);
+        try std.testing.expectEqual(.warning, ast.errors[0].severity);
+    }
+
+    for (sized_cases) |case| {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+}
+
+test "max attributes and depth" {
+    const src =
+        \\<div id="a" class="b" title="c">
+        \\  <p><span><b>deep</b><i>deep</i></span></p>
+        \\</div>
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+
+    {
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{
+            .max_attributes = 2,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        const err = ast.errors[0];
+        try std.testing.expectEqual(.warning, err.severity);
+        try std.testing.expectEqual(3, err.tag.too_many_attributes.count);
+        try std.testing.expectEqualStrings("div", err.main_location.slice(src));
+    }
+
+    {
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{
+            .max_depth = 3,
+        });
+        defer ast.deinit(std.testing.allocator);
+        // Only the outermost elements past the limit.
+        try std.testing.expectEqual(2, ast.errors.len);
+        for (ast.errors, [_][]const u8{ "b", "i" }) |err, name| {
+            try std.testing.expectEqual(4, err.tag.nesting_too_deep.depth);
+            try std.testing.expectEqualStrings(name, err.main_location.slice(src));
+        }
+    }
+
+    {
+        var rules: Rules = .default;
+        rules.set(.@"max-depth", .off);
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{
+            .max_depth = 1,
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+}
+
+test "missing end tags" {
+    // Source before the cursor, source after it, expected tag name (if any).
+    inline for (.{
+        .{ "<section>", "", "section" },
+        .{ "<div><p>", "</div>", "p" },
+        // The new start tag took the end tag of its parent.
+        .{ "<div><div>", "</div>", "div" },
+        .{ "<section>", "</section>", "" },
+        .{ "<br>", "", "" },
+        .{ "<div/>", "", "" },
+        .{ "<svg><path>", "</svg>", "" },
+        .{ "<svg><g>", "</svg>", "g" },
+    }) |case| {
+        const src = case[0] ++ case[1];
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        const name = ast.missingEndTag(src, case[0].len);
+        if (case[2].len == 0) {
+            try std.testing.expect(name == null);
+        } else {
+            try std.testing.expectEqualStrings(case[2], name.?.slice(src));
+        }
+    }
+}
+
+test "tag case" {
+    const case =
+        \\<div>
+        \\  <DIV>A</div>
+        \\  <Section>B</section >
+        \\  <p>C</p>
+        \\</div>
+        \\
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+
+    var rules: Rules = .default;
+    rules.set(.@"tag-case", .warn);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{
+        .rules = rules,
+    });
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(2, ast.errors.len);
+    for (ast.errors, [_][]const u8{ "DIV", "Section" }) |err, start_name| {
+        try std.testing.expect(err.tag == .mismatched_tag_case);
+        try std.testing.expectEqual(.warning, err.severity);
+        try std.testing.expectEqualStrings(
+            start_name,
+            err.tag.mismatched_tag_case.slice(case),
+        );
+        // The end tag is reported.
+        try std.testing.expectEqual('/', case[err.main_location.start - 1]);
+        try std.testing.expect(std.ascii.eqlIgnoreCase(
+            start_name,
+            err.main_location.slice(case),
+        ));
+    }
+}
+
+test "name case" {
+    const case =
+        \\<DIV Class="a" data-x="1">
+        \\  <svg viewBox="0 0 1 1"><linearGradient></linearGradient></svg>
+        \\  <p>C</p>
+        \\</DIV>
+        \\
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+
+    var rules: Rules = .default;
+    rules.set(.@"name-case", .warn);
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{
+        .rules = rules,
+    });
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(2, ast.errors.len);
+    for (ast.errors, [_][]const u8{ "DIV", "Class" }) |err, name| {
+        try std.testing.expect(err.tag == .uppercase_name);
+        try std.testing.expectEqualStrings(name, err.main_location.slice(case));
+    }
+}
+
+test "void element style" {
+    const case =
+        \\<div>
+        \\	<br>
+        \\	<hr/>
+        \\	<img src="a.png" alt="" />
+        \\</div>
+        \\
+    ;
+    const xhtml =
+        \\<div>
+        \\	<br />
+        \\	<hr />
+        \\	<img src="a.png" alt="" />
+        \\</div>
+        \\
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(2, ast.errors.len);
+        for (ast.errors, [_][]const u8{ "hr", "img" }) |err, name| {
+            try std.testing.expect(err.tag == .html_elements_cant_self_close);
+            try std.testing.expectEqualStrings(name, err.main_location.slice(case));
+        }
+    }
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{
+        .void_element_style = .xhtml,
+    });
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(1, ast.errors.len);
+    try std.testing.expect(ast.errors[0].tag == .missing_self_closing_slash);
+    try std.testing.expectEqualStrings("br", ast.errors[0].main_location.slice(case));
+
+    try std.testing.expectFmt(xhtml, "{f}", .{
+        ast.formatterOptions(case, .{ .void_element_style = .xhtml }),
+    });
+}
+
+test "fragments" {
+    // Partials are detected by the lack of a document shell.
+    const partial =
+        \\<li>First</li>
+        \\<li>Second</li>
+        \\
+    ;
+    const head_partial =
+        \\<head><title>Test</title></head>
+        \\
+    ;
+    const with_doctype =
+        \\<!DOCTYPE html>
+        \\<p>Hello</p>
+        \\
+    ;
+
+    var rules: Rules = .default;
+    rules.set(.charset, .@"error");
+
+    inline for (.{ partial, head_partial }) |src| {
+        const ast = try Ast.init(std.testing.allocator, src, .html, .{
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+
+    {
+        const ast = try Ast.init(std.testing.allocator, with_doctype, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+    }
+    {
+        const ast = try Ast.init(std.testing.allocator, with_doctype, .html, .{
+            .fragment = true,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(0, ast.errors.len);
+    }
+}
+
+test "text edit" {
+    const before =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><title>Test</title></head>
+        \\  <body><p>Hello world</p><span class="a a"></span></body>
+        \\</html>
+        \\
+    ;
+    const after =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><title>Test</title></head>
+        \\  <body><p>Hello there, world</p><span class="a a"></span></body>
+        \\</html>
+        \\
+    ;
+
+    const start: u32 = @intCast(std.mem.indexOf(u8, before, " world").?);
+    var ast = try Ast.init(std.testing.allocator, before, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expect(ast.applyTextEdit(after, start, start, 7));
+
+    const expected = try Ast.init(std.testing.allocator, after, .html, .{});
+    defer expected.deinit(std.testing.allocator);
+    try std.testing.expectEqualDeep(expected.nodes, ast.nodes);
+    try std.testing.expectEqualDeep(expected.errors, ast.errors);
+
+    // Edits that introduce markup require a reparse.
+    const markup =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><title>Test</title></head>
+        \\  <body><p>Hello there, <b>world</p><span class="a a"></span></body>
+        \\</html>
+        \\
+    ;
+    const b: u32 = @intCast(std.mem.indexOf(u8, after, "world").?);
+    try std.testing.expect(!ast.applyTextEdit(markup, b, b, 3));
+}
+
+test "suppression comments" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body>
+        \\    <!-- superhtml-disable-next-line html.attr.unknown -->
+        \\    <div foo></div>
+        \\    <div bar></div> <!-- superhtml-disable-line -->
+        \\    <!-- superhtml-disable-next-line html.attr.duplicate-id -->
+        \\    <div baz></div>
+        \\  </body>
+        \\</html>
+        \\
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(2, ast.errors.len);
+    try std.testing.expectEqualStrings("baz", ast.errors[0].main_location.slice(case));
+    try std.testing.expect(ast.errors[1].tag == .unused_suppression);
+    try std.testing.expectEqual(.info, ast.errors[1].severity);
+    try std.testing.expectEqual(
+        std.mem.indexOf(u8, case, "<!-- superhtml-disable-next-line html.attr.dup").?,
+        ast.errors[1].main_location.start,
+    );
+}
+
+test "unclosed elements" {
+    const src =
+        \\<div>
+        \\	<span>
+        \\</div>
+        \\<p>
+    ;
+
+    const ast = try Ast.init(std.testing.allocator, src, .html, .{});
+    defer ast.deinit(std.testing.allocator);
+    try std.testing.expectEqual(2, ast.errors.len);
+
+    // The location is the start tag that was never closed, while the
+    // payload points to where the end tag was expected.
+    const span = ast.errors[0];
+    try std.testing.expectEqualStrings("span", span.main_location.slice(src));
+    try std.testing.expectEqualStrings(
+        "</div>",
+        span.tag.missing_end_tag.slice(src),
+    );
+    try std.testing.expect(ast.nodes[span.node_idx].kind == .span);
+
+    const p = ast.errors[1];
+    try std.testing.expectEqualStrings("p", p.main_location.slice(src));
+    try std.testing.expectEqual(src.len, p.tag.missing_end_tag.start);
+}
+
+test "error codes" {
+    const err: Error = .{
+        .tag = .{ .token = .eof_in_tag },
+        .main_location = undefined,
+        .node_idx = 0,
+    };
+    try std.testing.expectEqualStrings("html.syntax.eof-in-tag", err.code());
+}
+
+test "rules" {
+    const case =
+        \\<!DOCTYPE html>
+        \\<html>
+        \\  <head><meta charset="utf-8"><title>Test</title></head>
+        \\  <body><span class="a a"><div></div></span></body>
+        \\</html>
+        \\
+    ;
+
+    {
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{});
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(2, ast.errors.len);
+        try std.testing.expectEqual(.@"error", ast.errors[0].severity);
+        try std.testing.expectEqual(.@"error", ast.errors[1].severity);
+    }
+
+    {
+        var rules: Rules = .default;
+        rules.set(.nesting, .off);
+        rules.set(.@"duplicate-class", .warn);
+        const ast = try Ast.init(std.testing.allocator, case, .html, .{
+            .rules = rules,
+        });
+        defer ast.deinit(std.testing.allocator);
+        try std.testing.expectEqual(1, ast.errors.len);
+        try std.testing.expect(ast.errors[0].tag == .duplicate_class);
+        try std.testing.expectEqual(.warning, ast.errors[0].severity);
+    }
+}
+
 pub const Cursor = struct {
     ast: Ast,
     idx: u32,
@@ -2172,7 +5422,7 @@ pub const Cursor = struct {
 //                 std.debug.print("--begin--\n{s}\n\n", .{out.written()});
 //             }
 
-//             const ast: Ast = try .init(gpa, out.written(), .html, false);
+//             const ast: Ast = try .init(gpa, out.written(), .html, .{});
 
 //             var bufnull: [4096]u8 = undefined;
 //             var devnull: Writer.Discarding = .init(&bufnull);
@@ -47,6 +47,27 @@ pub const Map = std.StaticStringMapWithEql(
     std.static_string_map.eqlAsciiIgnoreCase,
 );
 
+/// Levenshtein distance between `a` and `b`, ignoring case. Strings longer
+/// than 64 bytes are never considered similar.
+fn editDistance(a: []const u8, b: []const u8) usize {
+    const max_len = 64;
+    if (a.len > max_len or b.len > max_len) return std.math.maxInt(usize);
+
+    var row: [max_len + 1]usize = undefined;
+    for (row[0 .. b.len + 1], 0..) |*d, j| d.* = j;
+    for (a, 1..) |ca, i| {
+        var diagonal = row[0];
+        row[0] = i;
+        for (b, 1..) |cb, j| {
+            const substitution = diagonal +
+                @intFromBool(std.ascii.toLower(ca) != std.ascii.toLower(cb));
+            diagonal = row[j];
+            row[j] = @min(substitution, row[j] + 1, row[j - 1] + 1);
+        }
+    }
+    return row[b.len];
+}
+
 pub const Rule = union(enum) {
     /// This rule is checked manually in code that builds the tree or that performs
     /// element validation. It's an error for such attribute to end up being
@@ -54,7 +75,8 @@ pub const Rule = union(enum) {
     manual,
 
     /// Presence of the attribute indicates true value, absence indicates
-    /// false value, so no actual explicit value is allowed.
+    /// false value. The only values allowed are the empty string and the
+    /// name of the attribute.
     bool,
 
     /// All values are fine, including no value at all
@@ -200,7 +222,10 @@ pub const Rule = union(enum) {
 
             try errors.append(gpa, .{
                 .tag = .{
-                    .invalid_attr_value = .{},
+                    .invalid_attr_value = .{
+                        .expected = list.completions,
+                        .suggestion = list.suggestion(item),
+                    },
                 },
                 .main_location = .{
                     .start = offset,
@@ -211,6 +236,23 @@ pub const Rule = union(enum) {
 
             return .none;
         }
+
+        /// Returns the valid value closest to `item`, if it's close enough
+        /// to be a likely typo.
+        pub fn suggestion(list: List, item: []const u8) ?[]const u8 {
+            const max_distance = 2;
+            var best: ?[]const u8 = null;
+            var best_distance: usize = max_distance + 1;
+            for (list.completions) |c| {
+                if (c.value != null) continue;
+                const distance = editDistance(item, c.label);
+                if (distance < best_distance and distance < c.label.len) {
+                    best = c.label;
+                    best_distance = distance;
+                }
+            }
+            return best;
+        }
     };
 
     const cors_list: List = .init(.missing_or_empty, .one, &.{
@@ -251,7 +293,7 @@ pub const Rule = union(enum) {
             .manual => unreachable,
             .any => {},
             .bool => {
-                if (attr.value != null) {
+                if (!isBooleanValue(attr, src)) {
                     try errors.append(gpa, .{
                         .tag = .boolean_attr,
                         .main_location = attr.name,
@@ -884,6 +926,7 @@ pub const ValidatingIterator = struct {
 
     /// Will add a duplicate_attribute error for each duplicate attribute.
     /// Duplicate attributes will not be returned by this function.
+    /// Attribute names are compared case-insensitively.
     pub fn next(
         vait: *ValidatingIterator,
         gpa: Allocator,
@@ -897,45 +940,78 @@ pub const ValidatingIterator = struct {
                 .parse_error => {},
                 .attr => |attr| {
                     const attr_name = attr.name.slice(src);
-                    const gop = try vait.seen_attrs.getOrPut(gpa, attr_name);
-                    if (gop.found_existing) {
-                        try vait.errors.append(gpa, .{
-                            .tag = .{
-                                .duplicate_attribute_name = gop.value_ptr.*,
-                            },
-                            .main_location = .{
-                                .start = attr.name.start,
-                                .end = attr.name.end,
-                            },
-                            .node_idx = vait.node_idx,
-                        });
+                    // SuperHTML directives (:if, :loop, ...) are not
+                    // HTML attributes.
+                    if (vait.it.language == .superhtml and attr_name[0] == ':') {
                         continue;
-                    } else {
-                        if (std.ascii.eqlIgnoreCase(attr_name, "id")) {
-                            if (attr.value) |v| {
-                                const idgop = try vait.seen_ids.getOrPut(gpa, v.span.slice(src));
-                                if (idgop.found_existing) {
-                                    try vait.errors.append(gpa, .{
-                                        .tag = .{ .duplicate_id = idgop.value_ptr.* },
-                                        .main_location = v.span,
-                                        .node_idx = vait.node_idx,
-                                    });
-                                } else idgop.value_ptr.* = v.span;
-                            }
+                    }
+                    const scripted = vait.isScripted(attr, src);
+
+                    // A scripted attribute can evaluate to null and be
+                    // omitted from the output, so only duplicate static
+                    // attributes are reported.
+                    if (!scripted) {
+                        if (vait.seenName(attr_name)) |original| {
+                            try vait.errors.append(gpa, .{
+                                .tag = .{ .duplicate_attribute_name = original },
+                                .main_location = .{
+                                    .start = attr.name.start,
+                                    .end = attr.name.end,
+                                },
+                                .node_idx = vait.node_idx,
+                            });
+                            continue;
                         }
-                        gop.value_ptr.* = attr.name;
-                        return attr;
+                        try vait.seen_attrs.put(gpa, attr_name, attr.name);
                     }
+
+                    if (!scripted and std.ascii.eqlIgnoreCase(attr_name, "id")) {
+                        if (attr.value) |v| {
+                            const idgop = try vait.seen_ids.getOrPut(gpa, v.span.slice(src));
+                            if (idgop.found_existing) {
+                                try vait.errors.append(gpa, .{
+                                    .tag = .{ .duplicate_id = idgop.value_ptr.* },
+                                    .main_location = v.span,
+                                    .node_idx = vait.node_idx,
+                                });
+                            } else idgop.value_ptr.* = v.span;
+                        }
+                    }
+                    return attr;
                 },
             }
         }
         return null;
     }
+
+    /// Scripted values in SuperHTML are only known at runtime.
+    pub fn isScripted(
+        vait: *const ValidatingIterator,
+        attr: Tokenizer.Attr,
+        src: []const u8,
+    ) bool {
+        const value = attr.value orelse return false;
+        return vait.it.language == .superhtml and
+            std.mem.startsWith(u8, value.span.slice(src), "$");
+    }
+
+    /// Returns the span of the first attribute named `name`, if any.
+    fn seenName(vait: *ValidatingIterator, name: []const u8) ?Span {
+        var it = vait.seen_attrs.iterator();
+        while (it.next()) |entry| {
+            if (std.ascii.eqlIgnoreCase(entry.key_ptr.*, name)) {
+                return entry.value_ptr.*;
+            }
+        }
+        return null;
+    }
 };
 
 pub fn completions(
     arena: Allocator,
     src: []const u8,
+    nodes: []const Ast.Node,
+    language: Language,
     stt: *Ast.Node.TagIterator,
     element_tag: Ast.Kind,
     offset: u32,
@@ -947,6 +1023,7 @@ pub fn completions(
 
     var seen: std.DynamicBitSetUnmanaged = try .initEmpty(arena, total_count);
     var seen_count: u32 = 0;
+    var seen_data: std.StringHashMapUnmanaged(void) = .empty;
     while (stt.next(src)) |attr| {
         log.debug("completions attr: {any}", .{attr});
         const name = attr.name.slice(src);
@@ -961,6 +1038,7 @@ pub fn completions(
                 break :blk .{ ea.model, idx };
             }
 
+            if (isData(name)) try seen_data.put(arena, name, {});
             continue;
         };
 
@@ -1087,30 +1165,68 @@ pub fn completions(
         }
     }
 
-    const items = try arena.alloc(Ast.Completion, total_count - seen_count + 1);
-    var items_idx: u32 = 0;
+    var items: std.ArrayList(Ast.Completion) = try .initCapacity(
+        arena,
+        total_count - seen_count + 1,
+    );
     var it = seen.iterator(.{ .kind = .unset });
-    while (it.next()) |seen_idx| : (items_idx += 1) {
+    while (it.next()) |seen_idx| {
         const item = if (seen_idx < elem_attrs.list.len)
             elem_attrs.list[seen_idx]
         else
             global.list[seen_idx - elem_attrs.list.len];
 
-        items[items_idx] = .{
+        items.appendAssumeCapacity(.{
             .label = item.name,
             .desc = item.model.desc,
-        };
+        });
     }
 
-    items[items_idx] = .{
+    items.appendAssumeCapacity(.{
         .label = "Data Attribute",
         .desc = "A data attribute",
         .value = "data-",
-    };
+    });
+
+    // Data attributes used by other elements in the document.
+    for (nodes) |n| {
+        if (!n.kind.isElement()) continue;
+        var nit = n.startTagIterator(src, language);
+        while (nit.next(src)) |attr| {
+            const name = attr.name.slice(src);
+            if (!isData(name)) continue;
+            const gop = try seen_data.getOrPut(arena, name);
+            if (gop.found_existing) continue;
+            try items.append(arena, .{
+                .label = name,
+                .desc = "A data attribute used elsewhere in this document",
+            });
+        }
+    }
 
-    items_idx += 1;
-    assert(items_idx == items.len);
-    return items;
+    return items.items;
+}
+
+/// Returns true if `name` is a boolean attribute of elements of kind `kind`.
+/// Attributes of foreign elements are never considered boolean.
+pub fn isBoolean(kind: Ast.Kind, name: []const u8) bool {
+    switch (kind) {
+        .___, .svg, .math => return false,
+        else => if (!kind.isElement()) return false,
+    }
+
+    const model = element_attrs.get(kind).get(name) orelse
+        global.get(name) orelse return false;
+    return model.rule == .bool;
+}
+
+/// Returns true if the value of a boolean attribute is one of its valid
+/// forms: no value, the empty string or the name of the attribute.
+pub fn isBooleanValue(attr: Tokenizer.Attr, src: []const u8) bool {
+    const value = attr.value orelse return true;
+    const value_slice = value.span.slice(src);
+    return value_slice.len == 0 or
+        std.ascii.eqlIgnoreCase(value_slice, attr.name.slice(src));
 }
 
 const empty_set: *const AttributeSet = &.{
@@ -1287,10 +1403,7 @@ pub const element_attrs: std.EnumArray(Ast.Kind, *const AttributeSet) = .init(.{
 
 pub fn isData(name: []const u8) bool {
     if (name.len < "data-*".len) return false;
-    const data = std.ascii.eqlIgnoreCase("data-", name[0.."data-".len]);
-    // TODO: remove this hack once aria attributes are implemented
-    const aria = std.ascii.eqlIgnoreCase("aria-", name[0.."aria-".len]);
-    return data or aria;
+    return std.ascii.eqlIgnoreCase("data-", name[0.."data-".len]);
 }
 
 pub const global: AttributeSet = .init(&.{
@@ -2301,8 +2414,581 @@ pub const global: AttributeSet = .init(&.{
             .desc = "",
         },
     },
+    // https://w3c.github.io/aria/#state_prop_def
+    .{
+        .name = "aria-activedescendant",
+        .model = .{
+            .rule = .id,
+            .desc = "Identifies the currently active element when focus is on a composite widget, combobox, textbox, group, or application.",
+        },
+    },
+    .{
+        .name = "aria-atomic",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates whether assistive technologies will present all, or only parts of, the changed region based on the change notifications defined by the `aria-relevant` attribute.",
+        },
+    },
+    .{
+        .name = "aria-autocomplete",
+        .model = .{
+            .desc = "Indicates whether inputting text could trigger display of one or more predictions of the user's intended value for a combobox, searchbox, or textbox and specifies how predictions would be presented if they were made.",
+            .rule = .{
+                .list = .init(.none, .one, &.{
+                    .{
+                        .label = "inline",
+                        .desc = "Text suggesting one way to complete the provided input may be dynamically inserted after the caret.",
+                    },
+                    .{
+                        .label = "list",
+                        .desc = "When a user is providing input, an element containing a collection of values that could complete the provided input may be displayed.",
+                    },
+                    .{
+                        .label = "both",
+                        .desc = "An input to offer both models at the same time.",
+                    },
+                    .{
+                        .label = "none",
+                        .desc = "No input completion suggestions are provided.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-braillelabel",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a string value that labels the current element, which is intended to be converted into Braille.",
+        },
+    },
+    .{
+        .name = "aria-brailleroledescription",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a human-readable, author-localized abbreviated description for the role of an element, which is intended to be converted into Braille.",
+        },
+    },
+    .{
+        .name = "aria-busy",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates an element is being modified and that assistive technologies may want to wait until the modifications are complete before exposing them to the user.",
+        },
+    },
+    .{
+        .name = "aria-checked",
+        .model = .{
+            .rule = aria_tristate,
+            .desc = "Indicates the current \"checked\" state of checkboxes, radio buttons, and other widgets.",
+        },
+    },
+    .{
+        .name = "aria-colcount",
+        .model = .{
+            .rule = .any,
+            .desc = "Defines the total number of columns in a table, grid, or treegrid.",
+        },
+    },
+    .{
+        .name = "aria-colindex",
+        .model = .{
+            .rule = .{ .non_neg_int = .{ .min = 1 } },
+            .desc = "Defines an element's column index or position with respect to the total number of columns within a table, grid, or treegrid.",
+        },
+    },
+    .{
+        .name = "aria-colindextext",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a human readable text alternative of `aria-colindex`.",
+        },
+    },
+    .{
+        .name = "aria-colspan",
+        .model = .{
+            .rule = .{ .non_neg_int = .{ .min = 1 } },
+            .desc = "Defines the number of columns spanned by a cell or gridcell within a table, grid, or treegrid.",
+        },
+    },
+    .{
+        .name = "aria-controls",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Identifies the element (or elements) whose contents or presence are controlled by the current element.",
+        },
+    },
+    .{
+        .name = "aria-current",
+        .model = .{
+            .desc = "Indicates the element that represents the current item within a container or set of related elements.",
+            .rule = .{
+                .list = .init(.none, .one, &.{
+                    .{
+                        .label = "page",
+                        .desc = "Represents the current page within a set of pages.",
+                    },
+                    .{
+                        .label = "step",
+                        .desc = "Represents the current step within a process.",
+                    },
+                    .{
+                        .label = "location",
+                        .desc = "Represents the current location within an environment or context.",
+                    },
+                    .{
+                        .label = "date",
+                        .desc = "Represents the current date within a collection of dates.",
+                    },
+                    .{
+                        .label = "time",
+                        .desc = "Represents the current time within a set of times.",
+                    },
+                    .{
+                        .label = "true",
+                        .desc = "Represents the current item within a set.",
+                    },
+                    .{
+                        .label = "false",
+                        .desc = "Does not represent the current item within a set.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-describedby",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Identifies the element (or elements) that describes the object.",
+        },
+    },
+    .{
+        .name = "aria-description",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a string value that describes or annotates the current element.",
+        },
+    },
+    .{
+        .name = "aria-details",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Identifies the element (or elements) that provide additional information related to the object.",
+        },
+    },
+    .{
+        .name = "aria-disabled",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates that the element is perceivable but disabled, so it is not editable or otherwise operable.",
+        },
+    },
+    .{
+        .name = "aria-errormessage",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Identifies the element (or elements) that provides an error message for an object.",
+        },
+    },
+    .{
+        .name = "aria-expanded",
+        .model = .{
+            .rule = aria_true_false_undefined,
+            .desc = "Indicates whether a grouping element owned or controlled by this element is expanded or collapsed.",
+        },
+    },
+    .{
+        .name = "aria-flowto",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Identifies the next element (or elements) in an alternate reading order of content which, at the user's discretion, allows assistive technology to override the general default of reading in document source order.",
+        },
+    },
+    .{
+        .name = "aria-haspopup",
+        .model = .{
+            .desc = "Indicates the availability and type of interactive popup element, such as menu or dialog, that can be triggered by an element.",
+            .rule = .{
+                .list = .init(.none, .one, &.{
+                    .{
+                        .label = "false",
+                        .desc = "Indicates the element does not have a popup.",
+                    },
+                    .{
+                        .label = "true",
+                        .desc = "Indicates the popup is a menu.",
+                    },
+                    .{
+                        .label = "menu",
+                        .desc = "Indicates the popup is a menu.",
+                    },
+                    .{
+                        .label = "listbox",
+                        .desc = "Indicates the popup is a listbox.",
+                    },
+                    .{
+                        .label = "tree",
+                        .desc = "Indicates the popup is a tree.",
+                    },
+                    .{
+                        .label = "grid",
+                        .desc = "Indicates the popup is a grid.",
+                    },
+                    .{
+                        .label = "dialog",
+                        .desc = "Indicates the popup is a dialog.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-hidden",
+        .model = .{
+            .rule = aria_true_false_undefined,
+            .desc = "Indicates whether the element is exposed to an accessibility API.",
+        },
+    },
+    .{
+        .name = "aria-invalid",
+        .model = .{
+            .desc = "Indicates the entered value does not conform to the format expected by the application.",
+            .rule = .{
+                .list = .init(.none, .one, &.{
+                    .{
+                        .label = "grammar",
+                        .desc = "A grammatical error was detected.",
+                    },
+                    .{
+                        .label = "false",
+                        .desc = "There are no detected errors in the value.",
+                    },
+                    .{
+                        .label = "spelling",
+                        .desc = "A spelling error was detected.",
+                    },
+                    .{
+                        .label = "true",
+                        .desc = "The value entered by the user has failed validation.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-keyshortcuts",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Indicates keyboard shortcuts that an author has implemented to activate or give focus to an element.",
+        },
+    },
+    .{
+        .name = "aria-label",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a string value that labels the current element.",
+        },
+    },
+    .{
+        .name = "aria-labelledby",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Identifies the element (or elements) that labels the current element.",
+        },
+    },
+    .{
+        .name = "aria-level",
+        .model = .{
+            .rule = .{ .non_neg_int = .{ .min = 1 } },
+            .desc = "Defines the hierarchical level of an element within a structure.",
+        },
+    },
+    .{
+        .name = "aria-live",
+        .model = .{
+            .desc = "Indicates that an element will be updated, and describes the types of updates the user agents, assistive technologies, and user can expect from the live region.",
+            .rule = .{
+                .list = .init(.none, .one, &.{
+                    .{
+                        .label = "assertive",
+                        .desc = "Indicates that updates to the region have the highest priority and should be presented the user immediately.",
+                    },
+                    .{
+                        .label = "off",
+                        .desc = "Indicates that updates to the region should not be presented to the user unless the user is currently focused on that region.",
+                    },
+                    .{
+                        .label = "polite",
+                        .desc = "Indicates that updates to the region should be presented at the next graceful opportunity.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-modal",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates whether an element is modal when displayed.",
+        },
+    },
+    .{
+        .name = "aria-multiline",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates whether a text box accepts multiple lines of input or only a single line.",
+        },
+    },
+    .{
+        .name = "aria-multiselectable",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates that the user can select more than one item from the current selectable descendants.",
+        },
+    },
+    .{
+        .name = "aria-orientation",
+        .model = .{
+            .desc = "Indicates whether the element's orientation is horizontal, vertical, or unknown/ambiguous.",
+            .rule = .{
+                .list = .init(.none, .one, &.{
+                    .{
+                        .label = "horizontal",
+                        .desc = "The element is oriented horizontally.",
+                    },
+                    .{
+                        .label = "vertical",
+                        .desc = "The element is oriented vertically.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-owns",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Identifies an element (or elements) in order to define a visual, functional, or contextual parent/child relationship between DOM elements where the DOM hierarchy cannot be used to represent the relationship.",
+        },
+    },
+    .{
+        .name = "aria-placeholder",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a short hint (a word or short phrase) intended to aid the user with data entry when the control has no value.",
+        },
+    },
+    .{
+        .name = "aria-posinset",
+        .model = .{
+            .rule = .{ .non_neg_int = .{ .min = 1 } },
+            .desc = "Defines an element's number or position in the current set of listitems or treeitems.",
+        },
+    },
+    .{
+        .name = "aria-pressed",
+        .model = .{
+            .rule = aria_tristate,
+            .desc = "Indicates the current \"pressed\" state of toggle buttons.",
+        },
+    },
+    .{
+        .name = "aria-readonly",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates that the element is not editable, but is otherwise operable.",
+        },
+    },
+    .{
+        .name = "aria-relevant",
+        .model = .{
+            .desc = "Indicates what notifications the user agent will trigger when the accessibility tree within a live region is modified.",
+            .rule = .{
+                .list = .init(.none, .many_unique, &.{
+                    .{
+                        .label = "additions",
+                        .desc = "Element nodes are added to the accessibility tree within the live region.",
+                    },
+                    .{
+                        .label = "all",
+                        .desc = "Equivalent to the combination of all values, `additions removals text`.",
+                    },
+                    .{
+                        .label = "removals",
+                        .desc = "Text content, a text alternative, or an element node within the live region is removed from the accessibility tree.",
+                    },
+                    .{
+                        .label = "text",
+                        .desc = "Text content or a text alternative is added to any descendant in the accessibility tree of the live region.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-required",
+        .model = .{
+            .rule = aria_true_false,
+            .desc = "Indicates that user input is required on the element before a form may be submitted.",
+        },
+    },
+    .{
+        .name = "aria-roledescription",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a human-readable, author-localized description for the role of an element.",
+        },
+    },
+    .{
+        .name = "aria-rowcount",
+        .model = .{
+            .rule = .any,
+            .desc = "Defines the total number of rows in a table, grid, or treegrid.",
+        },
+    },
+    .{
+        .name = "aria-rowindex",
+        .model = .{
+            .rule = .{ .non_neg_int = .{ .min = 1 } },
+            .desc = "Defines an element's row index or position with respect to the total number of rows within a table, grid, or treegrid.",
+        },
+    },
+    .{
+        .name = "aria-rowindextext",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines a human readable text alternative of `aria-rowindex`.",
+        },
+    },
+    .{
+        .name = "aria-rowspan",
+        .model = .{
+            .rule = .{ .non_neg_int = .{} },
+            .desc = "Defines the number of rows spanned by a cell or gridcell within a table, grid, or treegrid.",
+        },
+    },
+    .{
+        .name = "aria-selected",
+        .model = .{
+            .rule = aria_true_false_undefined,
+            .desc = "Indicates the current \"selected\" state of various widgets.",
+        },
+    },
+    .{
+        .name = "aria-setsize",
+        .model = .{
+            .rule = .any,
+            .desc = "Defines the number of items in the current set of listitems or treeitems.",
+        },
+    },
+    .{
+        .name = "aria-sort",
+        .model = .{
+            .desc = "Indicates if items in a table or grid are sorted in ascending or descending order.",
+            .rule = .{
+                .list = .init(.none, .one, &.{
+                    .{
+                        .label = "ascending",
+                        .desc = "Items are sorted in ascending order by this column.",
+                    },
+                    .{
+                        .label = "descending",
+                        .desc = "Items are sorted in descending order by this column.",
+                    },
+                    .{
+                        .label = "none",
+                        .desc = "There is no defined sort applied to the column.",
+                    },
+                    .{
+                        .label = "other",
+                        .desc = "A sort algorithm other than ascending or descending has been applied.",
+                    },
+                }),
+            },
+        },
+    },
+    .{
+        .name = "aria-valuemax",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines the maximum allowed value for a range widget.",
+        },
+    },
+    .{
+        .name = "aria-valuemin",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines the minimum allowed value for a range widget.",
+        },
+    },
+    .{
+        .name = "aria-valuenow",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines the current value for a range widget.",
+        },
+    },
+    .{
+        .name = "aria-valuetext",
+        .model = .{
+            .rule = .not_empty,
+            .desc = "Defines the human readable text alternative of `aria-valuenow` for a range widget.",
+        },
+    },
 });
 
+const aria_true_false: Rule = .{
+    .list = .init(.none, .one, &.{
+        .{
+            .label = "true",
+            .desc = "The state is on.",
+        },
+        .{
+            .label = "false",
+            .desc = "The state is off.",
+        },
+    }),
+};
+
+const aria_true_false_undefined: Rule = .{
+    .list = .init(.none, .one, &.{
+        .{
+            .label = "true",
+            .desc = "The state is on.",
+        },
+        .{
+            .label = "false",
+            .desc = "The state is off.",
+        },
+        .{
+            .label = "undefined",
+            .desc = "The state is not applicable to this element.",
+        },
+    }),
+};
+
+const aria_tristate: Rule = .{
+    .list = .init(.none, .one, &.{
+        .{
+            .label = "true",
+            .desc = "The element is checked or pressed.",
+        },
+        .{
+            .label = "false",
+            .desc = "The element is not checked or pressed.",
+        },
+        .{
+            .label = "mixed",
+            .desc = "Indicates a mixed mode value for a tri-state checkbox or toggle button.",
+        },
+        .{
+            .label = "undefined",
+            .desc = "The element does not support being checked or pressed.",
+        },
+    }),
+};
+
 pub fn accesskey(
     gpa: Allocator,
     errors: *std.ArrayListUnmanaged(Ast.Error),
@@ -214,6 +214,89 @@ pub const Categories = packed struct {
     }
 };
 
+/// Names that contain a hyphen but that are reserved by SVG and MathML, and
+/// thus are not valid custom element names.
+const reserved_custom_names = std.StaticStringMapWithEql(
+    void,
+    std.static_string_map.eqlAsciiIgnoreCase,
+).initComptime(.{
+    .{"annotation-xml"},
+    .{"color-profile"},
+    .{"font-face"},
+    .{"font-face-src"},
+    .{"font-face-uri"},
+    .{"font-face-format"},
+    .{"font-face-name"},
+    .{"missing-glyph"},
+});
+
+/// https://html.spec.whatwg.org/multipage/custom-elements.html#valid-custom-element-name
+pub fn isCustomElementName(name: []const u8) bool {
+    if (name.len == 0 or !std.ascii.isAlphabetic(name[0])) return false;
+    if (std.mem.indexOfScalar(u8, name, '-') == null) return false;
+    return !reserved_custom_names.has(name);
+}
+
+/// Returns true if `n` is a custom element (as opposed to an unknown
+/// element). Custom elements have a transparent content model.
+pub fn isCustomElement(n: Ast.Node, src: []const u8) bool {
+    if (n.kind != .___) return false;
+    return isCustomElementName(n.span(src).slice(src));
+}
+
+/// Returns true if the children of `n` should be validated as if they were
+/// children of its parent: custom elements and SuperHTML `<ctx>` elements.
+pub fn isTransparent(n: Ast.Node, src: []const u8) bool {
+    return n.kind == .ctx or isCustomElement(n, src);
+}
+
+/// Iterates over the children of a node, descending into transparent
+/// elements as if their children were direct children of the node.
+pub const ChildIterator = struct {
+    nodes: []const Ast.Node,
+    src: []const u8,
+    parent_idx: u32,
+    idx: u32,
+
+    pub fn init(nodes: []const Ast.Node, src: []const u8, parent_idx: u32) ChildIterator {
+        return .{
+            .nodes = nodes,
+            .src = src,
+            .parent_idx = parent_idx,
+            .idx = nodes[parent_idx].first_child_idx,
+        };
+    }
+
+    pub fn next(it: *ChildIterator) ?u32 {
+        while (it.idx != 0) {
+            const idx = it.idx;
+            const n = it.nodes[idx];
+            if (isTransparent(n, it.src)) {
+                if (n.first_child_idx != 0) {
+                    it.idx = n.first_child_idx;
+                } else it.advance(idx);
+                continue;
+            }
+
+            it.advance(idx);
+            return idx;
+        }
+        return null;
+    }
+
+    fn advance(it: *ChildIterator, idx: u32) void {
+        var cur = it.nodes[idx];
+        while (cur.next_idx == 0) {
+            if (cur.parent_idx == it.parent_idx) {
+                it.idx = 0;
+                return;
+            }
+            cur = it.nodes[cur.parent_idx];
+        }
+        it.idx = cur.next_idx;
+    }
+};
+
 pub const Rejection = struct {
     reason: []const u8,
     span: Span,
@@ -276,7 +359,10 @@ pub inline fn modelRejects(
             ancestor_idx = ancestor.parent_idx;
 
             assert(ancestor.kind.isElement());
-            assert(ancestor.kind != .___);
+            // Custom elements and <ctx> are transparent
+            if (ancestor.kind == .___ or ancestor.kind == .ctx) continue;
+            // Template contents are fragments that accept any content
+            if (ancestor.kind == .template) return null;
             const element = Element.all.get(ancestor.kind);
             if (!element.model.content.overlaps(descendant_rt_model.categories)) {
                 return .{
@@ -353,16 +439,17 @@ pub inline fn validateContent(
             assert(parent.kind != .___);
             const first_child_idx = nodes[parent_idx].first_child_idx;
 
-            var child_idx = first_child_idx;
-            outer: while (child_idx != 0) {
+            var it: ChildIterator = .init(nodes, src, parent_idx);
+            outer: while (it.next()) |child_idx| {
                 const child = nodes[child_idx];
-                defer child_idx = child.next_idx;
 
                 switch (child.kind) {
                     else => {},
                     .doctype => continue,
                     .comment => continue,
                     .___ => continue,
+                    // Replaced by the content of the extending template.
+                    .super => continue,
                     .text => {
                         if (!parent.model.content.flow and
                             !parent.model.content.phrasing and
@@ -442,10 +529,16 @@ pub inline fn validateContent(
                 const node_idx = next_idx;
                 const node = nodes[node_idx];
 
-                if (node.kind == .___) {
+                if (isTransparent(node, src)) {
+                    next_idx += 1;
+                    continue;
+                } else if (node.kind == .___) {
                     next_idx = node.stop(nodes);
                     continue;
-                } else if (node.kind == .svg or node.kind == .math) {
+                } else if (node.kind == .svg or node.kind == .math or node.kind == .template) {
+                    // The content of a template is a separate document
+                    // fragment, it's not subject to the rules of its
+                    // ancestors.
                     next_idx = node.stop(nodes);
                 } else if (node.kind == .comment or node.kind == .text) {
                     next_idx += 1;
@@ -586,6 +679,8 @@ pub inline fn completions(
             return Attribute.completions(
                 arena,
                 src,
+                ast.nodes,
+                ast.language,
                 &stt,
                 element.tag,
                 offset,
@@ -716,6 +811,63 @@ const KindMap = std.StaticStringMapWithEql(
     std.static_string_map.eqlAsciiIgnoreCase,
 );
 
+/// Elements that are obsolete in the HTML spec and that should not be used
+/// anymore. Values are the suggested modern replacement, empty when the
+/// spec doesn't offer one.
+///
+/// https://html.spec.whatwg.org/multipage/obsolete.html#non-conforming-features
+pub const obsolete = std.StaticStringMapWithEql(
+    []const u8,
+    std.static_string_map.eqlAsciiIgnoreCase,
+).initComptime(.{
+    .{ "applet", "<embed> or <object>" },
+    .{ "acronym", "<abbr>" },
+    .{ "bgsound", "<audio>" },
+    .{ "dir", "<ul>" },
+    .{ "frame", "<iframe> and CSS" },
+    .{ "frameset", "<iframe> and CSS" },
+    .{ "noframes", "<iframe> and CSS" },
+    .{ "isindex", "an explicit <form> with a text control" },
+    .{ "keygen", "" },
+    .{ "listing", "<pre> and <code>" },
+    .{ "menuitem", "" },
+    .{ "nextid", "" },
+    .{ "noembed", "<object> with fallback content" },
+    .{ "param", "the data attribute of <object>" },
+    .{ "plaintext", "the text/plain MIME type" },
+    .{ "rb", "text directly inside of <ruby>" },
+    .{ "rtc", "<rt>" },
+    .{ "strike", "<del> or <s>" },
+    .{ "xmp", "<pre> and <code>" },
+    .{ "basefont", "CSS" },
+    .{ "big", "CSS font-size" },
+    .{ "blink", "CSS animations" },
+    .{ "center", "CSS text-align" },
+    .{ "font", "CSS" },
+    .{ "marquee", "CSS animations" },
+    .{ "multicol", "CSS columns" },
+    .{ "nobr", "CSS white-space" },
+    .{ "spacer", "CSS margin and padding" },
+    .{ "tt", "<code>, <kbd>, <samp> or CSS" },
+});
+
+/// Completions for the `obsolete` elements, annotated with their
+/// replacement. See `Ast.completions`.
+pub const obsolete_completions: []const Ast.Completion = blk: {
+    var cpls: []const Ast.Completion = &.{};
+    for (obsolete.keys(), obsolete.values()) |name, replacement| cpls = cpls ++ &[_]Ast.Completion{.{
+        .label = name,
+        .desc = if (replacement.len == 0)
+            "Obsolete element."
+        else
+            "Obsolete element, use " ++ replacement ++ " instead.",
+        .kind = .element_open,
+        .obsolete = true,
+    }};
+
+    break :blk cpls;
+};
+
 pub const elements: KindMap = blk: {
     const fields = std.meta.fields(Ast.Kind)[8..];
     assert(std.mem.eql(u8, fields[0].name, "a"));
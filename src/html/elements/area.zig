@@ -152,12 +152,14 @@ fn validateAttrs(
 ) error{OutOfMemory}!Model {
 
     // An area element with a parent node must have a map element ancestor.
+    // Template contents are fragments, a map might be provided by the
+    // document the fragment is inserted into.
     blk: {
         var ancestor_idx = parent_idx;
         while (ancestor_idx != 0) {
             const ancestor = nodes[ancestor_idx];
             ancestor_idx = ancestor.parent_idx;
-            if (ancestor.kind == .map) break :blk;
+            if (ancestor.kind == .map or ancestor.kind == .template) break :blk;
         }
 
         try errors.append(gpa, .{
@@ -255,10 +255,9 @@ pub fn validateContent(
 
     var state: enum { source, track, rest } = if (has_src) .track else .source;
     var first_default: ?Span = null;
-    var child_idx = parent.first_child_idx;
-    while (child_idx != 0) {
+    var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+    while (it.next()) |child_idx| {
         const child = nodes[child_idx];
-        defer child_idx = child.next_idx;
 
         const child_name = child.span(src);
 
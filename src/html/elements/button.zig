@@ -505,7 +505,7 @@ pub fn validateContent(
         if (node.kind == .___) {
             next_idx = node.stop(nodes);
             continue;
-        } else if (node.kind == .svg or node.kind == .math) {
+        } else if (node.kind == .svg or node.kind == .math or node.kind == .template) {
             next_idx = node.stop(nodes);
         } else {
             next_idx += 1;
@@ -606,7 +606,7 @@ fn completionsContent(
             if (node.kind == .___) {
                 next_idx = node.stop(nodes);
                 continue;
-            } else if (node.kind == .svg or node.kind == .math) {
+            } else if (node.kind == .svg or node.kind == .math or node.kind == .template) {
                 next_idx = node.stop(nodes);
             } else {
                 next_idx += 1;
@@ -61,10 +61,9 @@ pub fn validateContent(
     const parent_span = parent.span(src);
     var state: enum { searching, phrasing, option } = .searching;
 
-    var child_idx = parent.first_child_idx;
-    while (child_idx != 0) {
+    var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+    while (it.next()) |child_idx| {
         const child = nodes[child_idx];
-        defer child_idx = child.next_idx;
         switch (child.kind) {
             .comment, .script, .template => continue,
             else => {},
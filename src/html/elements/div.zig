@@ -72,10 +72,9 @@ pub fn validateContent(
     switch (state) {
         .dl => {
             var dlstate: enum { dt, dd } = .dt;
-            var child_idx = parent.first_child_idx;
-            while (child_idx != 0) {
+            var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+            while (it.next()) |child_idx| {
                 const child = nodes[child_idx];
-                defer child_idx = child.next_idx;
 
                 switch (child.kind) {
                     .script, .template => continue,
@@ -132,10 +131,9 @@ pub fn validateContent(
             }
         },
         .flow => {
-            var child_idx = parent.first_child_idx;
-            while (child_idx != 0) {
+            var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+            while (it.next()) |child_idx| {
                 const child = nodes[child_idx];
-                defer child_idx = child.next_idx;
 
                 if (div.modelRejects(
                     nodes,
@@ -159,10 +157,9 @@ pub fn validateContent(
             }
         },
         .optgroup, .select => {
-            var child_idx = parent.first_child_idx;
-            while (child_idx != 0) {
+            var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+            while (it.next()) |child_idx| {
                 const child = nodes[child_idx];
-                defer child_idx = child.next_idx;
 
                 switch (child.kind) {
                     .option, .script, .template, .noscript, .div => continue,
@@ -189,10 +186,9 @@ pub fn validateContent(
             }
         },
         .option => {
-            var child_idx = parent.first_child_idx;
-            while (child_idx != 0) {
+            var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+            while (it.next()) |child_idx| {
                 const child = nodes[child_idx];
-                defer child_idx = child.next_idx;
 
                 if (child.kind == .div) continue;
 
@@ -264,10 +260,9 @@ fn completions(
         .dl => {
             var dlstate: enum { dt, dd } = .dt;
             var after_cursor: Ast.Kind = .dd;
-            var child_idx = parent.first_child_idx;
-            while (child_idx != 0) {
+            var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+            while (it.next()) |child_idx| {
                 const child = nodes[child_idx];
-                defer child_idx = child.next_idx;
 
                 switch (child.kind) {
                     .script, .template => continue,
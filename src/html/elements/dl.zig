@@ -55,10 +55,9 @@ pub fn validateContent(
     var state: enum { searching, dt, dd, div } = .searching;
     var last_dt: Span = undefined;
     var last_dt_idx: u32 = undefined;
-    var child_idx = parent.first_child_idx;
-    while (child_idx != 0) {
+    var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+    while (it.next()) |child_idx| {
         const child = nodes[child_idx];
-        defer child_idx = child.next_idx;
 
         switch (child.kind) {
             .script, .template, .comment => continue,
@@ -50,10 +50,9 @@ pub fn validateContent(
     const parent = nodes[parent_idx];
     const parent_span = parent.span(src);
 
-    var child_idx = parent.first_child_idx;
-    while (child_idx != 0) {
+    var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+    while (it.next()) |child_idx| {
         const child = nodes[child_idx];
-        defer child_idx = child.next_idx;
         if (child.kind == .comment) continue;
 
         const child_span = child.span(src);
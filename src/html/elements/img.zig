@@ -427,8 +427,9 @@ fn validate(
         }
     }
 
+    // An empty alt is valid and marks the image as decorative.
     if (!seen_alt) try errors.append(gpa, .{
-        .tag = .{ .missing_required_attr = "alt" },
+        .tag = .missing_alt,
         .main_location = vait.name,
         .node_idx = node_idx,
     });
@@ -497,7 +497,15 @@ fn validate(
     }
 
     const type_idx = attributes.comptimeIndex("type");
-    const type_value: Type = if (attrs[type_idx]) |attr| blk: {
+
+    // A scripted type is only known at runtime, in which case any attribute
+    // could be the right one.
+    const scripted_type = if (attrs[type_idx]) |attr|
+        vait.isScripted(attr, src)
+    else
+        false;
+
+    const type_value: Type = if (scripted_type) .text else if (attrs[type_idx]) |attr| blk: {
         const value = attr.value orelse {
             try errors.append(gpa, .{
                 .tag = .missing_attr_value,
@@ -528,8 +536,7 @@ fn validate(
     active_attrs[attributes.comptimeIndex("form")] = true;
     active_attrs[attributes.comptimeIndex("name")] = true;
     active_attrs[attributes.comptimeIndex("type")] = true;
-    active_attrs[attributes.comptimeIndex("value")] = true;
-    active_attrs[attributes.comptimeIndex("width")] = true;
+    active_attrs[attributes.comptimeIndex("value")] = type_value != .image;
 
     switch (type_value) {
         .hidden => {
@@ -618,16 +625,11 @@ fn validate(
 
     assert(type_idx == 0);
     for (attrs[1..], active_attrs[1..], 1..) |maybe_attr, active, idx| {
-        @setEvalBranchQuota(3000);
         const attr = maybe_attr orelse continue;
 
-        if (!active) {
+        if (!active and !scripted_type) {
             try errors.append(gpa, .{
-                .tag = .{
-                    .invalid_attr_combination = switch (type_value) {
-                        inline else => |tag| "not valid when [type] is '" ++ @tagName(tag) ++ "'",
-                    },
-                },
+                .tag = .{ .input_type_mismatch = @tagName(type_value) },
                 .main_location = attr.name,
                 .node_idx = node_idx,
             });
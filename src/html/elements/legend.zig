@@ -52,7 +52,8 @@ pub fn validateContent(
 
     const mode: enum { optgroup, fieldset } = switch (nodes[parent.parent_idx].kind) {
         .optgroup => .optgroup,
-        .fieldset => .fieldset,
+        // Template contents are fragments meant to be inserted elsewhere
+        .fieldset, .template => .fieldset,
         else => return errors.append(gpa, .{
             .tag = .{
                 .invalid_nesting = .{
@@ -79,7 +80,7 @@ pub fn validateContent(
                 if (node.kind == .___) {
                     next_idx = node.stop(nodes);
                     continue;
-                } else if (node.kind == .svg or node.kind == .math) {
+                } else if (node.kind == .svg or node.kind == .math or node.kind == .template) {
                     next_idx = node.stop(nodes);
                 } else {
                     next_idx += 1;
@@ -110,10 +111,9 @@ pub fn validateContent(
         },
         // Otherwise: Phrasing content, optionally intermixed with heading content.
         .fieldset => {
-            var child_idx = parent.first_child_idx;
-            while (child_idx != 0) {
+            var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+            while (it.next()) |child_idx| {
                 const child = nodes[child_idx];
-                defer child_idx = child.next_idx;
 
                 const child_span = child.span(src);
 
@@ -155,7 +155,8 @@ fn completionsContent(
     const parent = ast.nodes[node_idx];
     const mode: enum { optgroup, fieldset } = switch (ast.nodes[parent.parent_idx].kind) {
         .optgroup => .optgroup,
-        .fieldset => .fieldset,
+        // Template contents are fragments meant to be inserted elsewhere
+        .fieldset, .template => .fieldset,
         else => return &.{},
     };
 
@@ -54,7 +54,11 @@ fn validate(
 ) error{OutOfMemory}!Model {
     // If the element is not a child of an ul or menu element: value — Ordinal value of the list item
 
-    const under_ol = nodes[parent_idx].kind == .ol;
+    // Template contents might be inserted into an ol.
+    const under_ol = switch (nodes[parent_idx].kind) {
+        .ol, .template => true,
+        else => false,
+    };
     while (try vait.next(gpa, src)) |attr| {
         const name = attr.name.slice(src);
         const model = if (attributes.has(name)) {
@@ -314,7 +314,7 @@ fn validateChildren(
         if (node.kind == .___) {
             next_idx = node.stop(nodes);
             continue;
-        } else if (node.kind == .svg or node.kind == .math) {
+        } else if (node.kind == .svg or node.kind == .math or node.kind == .template) {
             next_idx = node.stop(nodes);
         } else if (node.kind == .comment or node.kind == .text) {
             next_idx += 1;
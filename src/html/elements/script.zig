@@ -167,6 +167,38 @@ pub const attributes: AttributeSet = .init(&.{
     },
 });
 
+const Set = std.StaticStringMapWithEql(
+    void,
+    std.static_string_map.eqlAsciiIgnoreCase,
+);
+const js_mime_types: Set = .initComptime(.{
+    .{"application/ecmascript"},
+    .{"application/javascript"},
+    .{"application/x-ecmascript"},
+    .{"application/x-javascript"},
+    .{"text/ecmascript"},
+    .{"text/javascript"},
+    .{"text/javascript1.0"},
+    .{"text/javascript1.1"},
+    .{"text/javascript1.2"},
+    .{"text/javascript1.3"},
+    .{"text/javascript1.4"},
+    .{"text/javascript1.5"},
+    .{"text/jscript"},
+    .{"text/livescript"},
+    .{"text/x-ecmascript"},
+    .{"text/x-javascript"},
+});
+
+/// Returns true if the value of the `type` attribute makes the script a data
+/// block, meaning that its content is not code and must be left untouched.
+pub fn isDataBlock(type_value: []const u8) bool {
+    if (type_value.len == 0) return false;
+    if (std.ascii.eqlIgnoreCase(type_value, "module")) return false;
+    if (std.ascii.eqlIgnoreCase(type_value, "importmap")) return false;
+    return !js_mime_types.has(type_value);
+}
+
 fn validate(
     gpa: Allocator,
     errors: *std.ArrayListUnmanaged(Ast.Error),
@@ -213,30 +245,7 @@ fn validate(
             break :blk .importmap;
         }
 
-        const Set = std.StaticStringMapWithEql(
-            void,
-            std.static_string_map.eqlAsciiIgnoreCase,
-        );
-        const js_set: Set = .initComptime(.{
-            .{"application/ecmascript"},
-            .{"application/javascript"},
-            .{"application/x-ecmascript"},
-            .{"application/x-javascript"},
-            .{"text/ecmascript"},
-            .{"text/javascript"},
-            .{"text/javascript1.0"},
-            .{"text/javascript1.1"},
-            .{"text/javascript1.2"},
-            .{"text/javascript1.3"},
-            .{"text/javascript1.4"},
-            .{"text/javascript1.5"},
-            .{"text/jscript"},
-            .{"text/livescript"},
-            .{"text/x-ecmascript"},
-            .{"text/x-javascript"},
-        });
-
-        if (js_set.has(value_slice)) {
+        if (js_mime_types.has(value_slice)) {
             break :blk .js;
         }
 
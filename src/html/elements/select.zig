@@ -218,10 +218,9 @@ pub fn validateContent(
     var state: union(enum) { button, rest: ?u32 } = if (can_have_button) .button else .{
         .rest = null,
     };
-    var child_idx = parent.first_child_idx;
-    while (child_idx != 0) {
+    var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+    while (it.next()) |child_idx| {
         const child = nodes[child_idx];
-        defer child_idx = child.next_idx;
 
         if (child.kind == .comment) continue;
 
@@ -66,10 +66,9 @@ pub fn validateContent(
     var has_caption: u32 = 0;
     var has_thead: u32 = 0;
     var has_tfoot: u32 = 0;
-    var child_idx = parent.first_child_idx;
-    while (child_idx != 0) {
+    var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+    while (it.next()) |child_idx| {
         const child = nodes[child_idx];
-        defer child_idx = child.next_idx;
         switch (child.kind) {
             .comment, .script, .template => continue,
             else => {},
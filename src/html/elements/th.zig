@@ -84,7 +84,7 @@ pub const attributes: AttributeSet = .init(&.{
         .model = .{
             .desc = "Defines the cells that the header (defined in the `<th>`) element relates to.",
             .rule = .{
-                .list = .init(.{ .custom = validateHeaders }, .many_unique, &.{
+                .list = .init(.none, .one, &.{
                     .{
                         .label = "row",
                         .desc = "",
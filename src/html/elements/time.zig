@@ -91,10 +91,9 @@ pub fn validateContent(
         try model.rule.validate(gpa, errors, src, parent_idx, attr);
     }
 
-    var child_idx = parent.first_child_idx;
-    while (child_idx != 0) {
+    var it: Element.ChildIterator = .init(nodes, src, parent_idx);
+    while (it.next()) |child_idx| {
         const child = nodes[child_idx];
-        defer child_idx = child.next_idx;
         switch (child.kind) {
             .text => {
                 // TODO: validate text
@@ -0,0 +1,633 @@
+//! SVG and MathML elements and attributes, the "foreign content" that can be
+//! embedded in HTML documents by using `<svg>` and `<math>`. Unlike in HTML,
+//! names are case-sensitive (e.g. `viewBox`, `linearGradient`).
+const std = @import("std");
+const Allocator = std.mem.Allocator;
+const root = @import("../root.zig");
+const Language = root.Language;
+const Span = root.Span;
+const Ast = @import("Ast.zig");
+const Attribute = @import("Attribute.zig");
+
+pub const Namespace = enum {
+    svg,
+    math,
+
+    pub fn label(ns: Namespace) []const u8 {
+        return switch (ns) {
+            .svg => "SVG",
+            .math => "MathML",
+        };
+    }
+
+    /// Returns true for elements that don't usually have any content, like
+    /// `<path>`, which are written as self-closing tags.
+    pub fn isEmpty(ns: Namespace, name: []const u8) bool {
+        for (ns.defs().elements) |e| {
+            if (std.mem.eql(u8, e.name, name)) return e.empty;
+        }
+        return false;
+    }
+
+    fn defs(ns: Namespace) *const Defs {
+        return switch (ns) {
+            .svg => &svg,
+            .math => &math,
+        };
+    }
+};
+
+/// Payload of errors about unknown foreign element and attribute names.
+pub const Name = struct {
+    namespace: Namespace,
+    /// The correct name, set when the name only differs by case.
+    suggestion: ?[]const u8 = null,
+};
+
+const ElementDef = struct {
+    name: []const u8,
+    desc: []const u8,
+    /// Doesn't usually have any content, completions self-close it.
+    empty: bool = false,
+};
+
+const Defs = struct {
+    elements: []const ElementDef,
+    element_map: std.StaticStringMap(void),
+    attributes: []const []const u8,
+    attribute_map: std.StaticStringMap(void),
+    /// Elements whose content is parsed as HTML.
+    integration_points: []const []const u8,
+};
+
+/// Returns the namespace of the content of the node at `idx`, or null when
+/// its content is HTML (either because it's not inside of `<svg>` or
+/// `<math>`, or because it's inside of an HTML integration point like
+/// `<foreignObject>`).
+pub fn namespace(nodes: []const Ast.Node, src: []const u8, idx: u32) ?Namespace {
+    var cur_idx = idx;
+    while (cur_idx != 0) {
+        const n = nodes[cur_idx];
+        cur_idx = n.parent_idx;
+        switch (n.kind) {
+            .svg => return .svg,
+            .math => return .math,
+            // Foreign elements, custom elements and <ctx>
+            .___, .ctx => {},
+            else => return null,
+        }
+
+        const name = n.startTagIterator(src, .html).name_span.slice(src);
+        if (std.ascii.eqlIgnoreCase(name, "svg")) return .svg;
+        if (std.ascii.eqlIgnoreCase(name, "math")) return .math;
+        for ([_]Namespace{ .svg, .math }) |ns| {
+            for (ns.defs().integration_points) |ip| {
+                if (std.mem.eql(u8, ip, name)) return null;
+            }
+        }
+    }
+    return null;
+}
+
+/// Validates the start tag of an element nested inside of `<svg>` or
+/// `<math>`. Elements inside of HTML integration points are only checked
+/// for duplicate attributes.
+pub fn validate(
+    gpa: Allocator,
+    errors: *std.ArrayListUnmanaged(Ast.Error),
+    seen_attrs: *std.StringHashMapUnmanaged(Span),
+    seen_ids: *std.StringHashMapUnmanaged(Span),
+    language: Language,
+    nodes: []const Ast.Node,
+    parent_idx: u32,
+    src: []const u8,
+    tag: Span,
+    node_idx: u32,
+) error{OutOfMemory}!void {
+    var vait: Attribute.ValidatingIterator = .init(
+        errors,
+        seen_attrs,
+        seen_ids,
+        language,
+        tag,
+        src,
+        node_idx,
+    );
+
+    const ns = namespace(nodes, src, parent_idx) orelse {
+        while (try vait.next(gpa, src)) |_| {}
+        return;
+    };
+    const defs = ns.defs();
+
+    const name = vait.name.slice(src);
+    if (!defs.element_map.has(name)) {
+        try errors.append(gpa, .{
+            .tag = .{
+                .invalid_foreign_tag_name = .{
+                    .namespace = ns,
+                    .suggestion = for (defs.elements) |e| {
+                        if (std.ascii.eqlIgnoreCase(e.name, name)) break e.name;
+                    } else null,
+                },
+            },
+            .main_location = vait.name,
+            .node_idx = node_idx,
+        });
+    }
+
+    while (try vait.next(gpa, src)) |attr| {
+        const attr_name = attr.name.slice(src);
+        if (defs.attribute_map.has(attr_name) or isCommonAttr(attr_name)) continue;
+        try errors.append(gpa, .{
+            .tag = .{
+                .invalid_foreign_attr = .{
+                    .namespace = ns,
+                    .suggestion = for (defs.attributes) |a| {
+                        if (std.ascii.eqlIgnoreCase(a, attr_name)) break a;
+                    } else null,
+                },
+            },
+            .main_location = attr.name,
+            .node_idx = node_idx,
+        });
+    }
+}
+
+/// Attributes accepted on all foreign elements.
+fn isCommonAttr(name: []const u8) bool {
+    // Event handlers
+    if (std.mem.startsWith(u8, name, "on")) return true;
+    // Namespaced attributes (e.g. `xlink:href`, `inkscape:label`) and
+    // SuperHTML attributes (e.g. `:if`)
+    if (std.mem.indexOfScalar(u8, name, ':') != null) return true;
+    if (Attribute.isData(name)) return true;
+    if (std.mem.startsWith(u8, name, "aria-")) return true;
+    return false;
+}
+
+pub fn elementCompletions(ns: Namespace) []const Ast.Completion {
+    return switch (ns) {
+        inline else => |tag| comptime blk: {
+            const elements = tag.defs().elements;
+            var completions: [elements.len]Ast.Completion = undefined;
+            for (elements, &completions) |e, *c| c.* = .{
+                .label = e.name,
+                .value = if (e.empty)
+                    e.name ++ "$1/>"
+                else
+                    e.name ++ "$1>$0</" ++ e.name ++ ">",
+                .desc = e.desc,
+                .kind = .element_open,
+            };
+            const final = completions;
+            break :blk &final;
+        },
+    };
+}
+
+pub fn attributeCompletions(ns: Namespace) []const Ast.Completion {
+    return switch (ns) {
+        inline else => |tag| comptime blk: {
+            const attributes = tag.defs().attributes;
+            var completions: [attributes.len]Ast.Completion = undefined;
+            for (attributes, &completions) |a, *c| c.* = .{
+                .label = a,
+                .desc = "",
+            };
+            const final = completions;
+            break :blk &final;
+        },
+    };
+}
+
+fn nameMap(comptime names: []const []const u8) std.StaticStringMap(void) {
+    @setEvalBranchQuota(names.len * 1000);
+    var kvs: [names.len]struct { []const u8 } = undefined;
+    for (names, &kvs) |name, *kv| kv.* = .{name};
+    return .initComptime(kvs);
+}
+
+fn elementMap(comptime elements: []const ElementDef) std.StaticStringMap(void) {
+    var names: [elements.len][]const u8 = undefined;
+    for (elements, &names) |e, *n| n.* = e.name;
+    return nameMap(&names);
+}
+
+// https://developer.mozilla.org/en-US/docs/Web/SVG/Reference/Element
+const svg_elements = [_]ElementDef{
+    .{ .name = "a", .desc = "Creates a hyperlink to other web pages, files, locations in the same page, email addresses, or any other URL." },
+    .{ .name = "animate", .desc = "Provides a way to animate an attribute of an element over time.", .empty = true },
+    .{ .name = "animateMotion", .desc = "Provides a way to define how an element moves along a motion path." },
+    .{ .name = "animateTransform", .desc = "Animates a transformation attribute on its target element.", .empty = true },
+    .{ .name = "circle", .desc = "Draws a circle based on a center point and a radius.", .empty = true },
+    .{ .name = "clipPath", .desc = "Defines a clipping path, to be used by the `clip-path` property." },
+    .{ .name = "defs", .desc = "Stores graphical objects that will be used at a later time." },
+    .{ .name = "desc", .desc = "Provides an accessible, long-text description of any SVG container element or graphics element." },
+    .{ .name = "ellipse", .desc = "Draws an ellipse based on a center coordinate, and both their x and y radius.", .empty = true },
+    .{ .name = "feBlend", .desc = "Composes two objects together ruled by a certain blending mode.", .empty = true },
+    .{ .name = "feColorMatrix", .desc = "Changes colors based on a transformation matrix.", .empty = true },
+    .{ .name = "feComponentTransfer", .desc = "Performs color-component-wise remapping of data for each pixel." },
+    .{ .name = "feComposite", .desc = "Performs the combination of two input images pixel-wise in image space.", .empty = true },
+    .{ .name = "feConvolveMatrix", .desc = "Applies a matrix convolution filter effect.", .empty = true },
+    .{ .name = "feDiffuseLighting", .desc = "Lights an image using the alpha channel as a bump map." },
+    .{ .name = "feDisplacementMap", .desc = "Uses the pixel values from the image from `in2` to spatially displace the image from `in`.", .empty = true },
+    .{ .name = "feDistantLight", .desc = "Specifies a distant light source.", .empty = true },
+    .{ .name = "feDropShadow", .desc = "Creates a drop shadow of the input image.", .empty = true },
+    .{ .name = "feFlood", .desc = "Fills the filter subregion with the color and opacity defined by `flood-color` and `flood-opacity`.", .empty = true },
+    .{ .name = "feFuncA", .desc = "Defines the transfer function for the alpha component of the input graphic of its parent `<feComponentTransfer>`.", .empty = true },
+    .{ .name = "feFuncB", .desc = "Defines the transfer function for the blue component of the input graphic of its parent `<feComponentTransfer>`.", .empty = true },
+    .{ .name = "feFuncG", .desc = "Defines the transfer function for the green component of the input graphic of its parent `<feComponentTransfer>`.", .empty = true },
+    .{ .name = "feFuncR", .desc = "Defines the transfer function for the red component of the input graphic of its parent `<feComponentTransfer>`.", .empty = true },
+    .{ .name = "feGaussianBlur", .desc = "Blurs the input image by the amount specified in `stdDeviation`.", .empty = true },
+    .{ .name = "feImage", .desc = "Fetches image data from an external source and provides the pixel data as output.", .empty = true },
+    .{ .name = "feMerge", .desc = "Allows filter effects to be applied concurrently instead of sequentially." },
+    .{ .name = "feMergeNode", .desc = "Takes the result of another filter to be processed by its parent `<feMerge>`.", .empty = true },
+    .{ .name = "feMorphology", .desc = "Erodes or dilates the input image.", .empty = true },
+    .{ .name = "feOffset", .desc = "Offsets the input image relative to its current position.", .empty = true },
+    .{ .name = "fePointLight", .desc = "Specifies a light source that allows creating a point light effect.", .empty = true },
+    .{ .name = "feSpecularLighting", .desc = "Lights a source graphic using the alpha channel as a bump map." },
+    .{ .name = "feSpotLight", .desc = "Specifies a light source that allows creating a spotlight effect.", .empty = true },
+    .{ .name = "feTile", .desc = "Fills a target rectangle with a repeated, tiled pattern of an input image.", .empty = true },
+    .{ .name = "feTurbulence", .desc = "Creates an image using the Perlin turbulence function.", .empty = true },
+    .{ .name = "filter", .desc = "Defines a custom filter effect by grouping atomic filter primitives." },
+    .{ .name = "foreignObject", .desc = "Includes elements from a different XML namespace, its content is parsed as HTML." },
+    .{ .name = "g", .desc = "A container used to group other SVG elements." },
+    .{ .name = "image", .desc = "Includes images inside SVG documents.", .empty = true },
+    .{ .name = "line", .desc = "Creates a line connecting two points.", .empty = true },
+    .{ .name = "linearGradient", .desc = "Defines a linear gradient to apply to a graphical element." },
+    .{ .name = "marker", .desc = "Defines a graphic used for drawing arrowheads or polymarkers on a given `<path>`, `<line>`, `<polyline>` or `<polygon>` element." },
+    .{ .name = "mask", .desc = "Defines a mask for compositing the current object into the background." },
+    .{ .name = "metadata", .desc = "Adds metadata to SVG content." },
+    .{ .name = "mpath", .desc = "Provides the ability to reference an external `<path>` element as the definition of a motion path.", .empty = true },
+    .{ .name = "path", .desc = "The generic element to define a shape.", .empty = true },
+    .{ .name = "pattern", .desc = "Defines a graphics object which can be redrawn at repeated x- and y-coordinate intervals to cover an area." },
+    .{ .name = "polygon", .desc = "Defines a closed shape consisting of a set of connected straight line segments.", .empty = true },
+    .{ .name = "polyline", .desc = "Creates straight lines connecting several points.", .empty = true },
+    .{ .name = "radialGradient", .desc = "Defines a radial gradient to apply to a graphical element." },
+    .{ .name = "rect", .desc = "Draws a rectangle, defined by its position, width, and height.", .empty = true },
+    .{ .name = "script", .desc = "Allows to add scripts to an SVG document." },
+    .{ .name = "set", .desc = "Provides a method of setting the value of an attribute for a specified duration.", .empty = true },
+    .{ .name = "stop", .desc = "Defines a color and its position to use on a gradient.", .empty = true },
+    .{ .name = "style", .desc = "Allows style sheets to be embedded directly within SVG content." },
+    .{ .name = "svg", .desc = "A container that defines a new coordinate system and viewport." },
+    .{ .name = "switch", .desc = "Evaluates its direct child elements and renders the first one whose conditions evaluate to true." },
+    .{ .name = "symbol", .desc = "Defines graphical template objects which can be instantiated by a `<use>` element." },
+    .{ .name = "text", .desc = "Draws a graphics element consisting of text." },
+    .{ .name = "textPath", .desc = "Renders text along the shape of a `<path>` element." },
+    .{ .name = "title", .desc = "Provides an accessible, short-text description of any SVG container element or graphics element." },
+    .{ .name = "tspan", .desc = "Defines a subtext within a `<text>` element or another `<tspan>` element." },
+    .{ .name = "use", .desc = "Takes nodes from within the SVG document, and duplicates them somewhere else.", .empty = true },
+    .{ .name = "view", .desc = "Defines a particular view of an SVG document.", .empty = true },
+};
+
+// https://developer.mozilla.org/en-US/docs/Web/SVG/Reference/Attribute
+const svg_attributes = [_][]const u8{
+    // Core and styling
+    "id",
+    "class",
+    "style",
+    "lang",
+    "tabindex",
+    "autofocus",
+    "nonce",
+    "role",
+    "xmlns",
+    "href",
+    "title",
+    "version",
+    "baseProfile",
+    "systemLanguage",
+    "requiredExtensions",
+    "requiredFeatures",
+    "externalResourcesRequired",
+    "zoomAndPan",
+    "contentScriptType",
+    "contentStyleType",
+    "media",
+    "type",
+    "crossorigin",
+    "decoding",
+    "fetchpriority",
+    "focusable",
+    "download",
+    "hreflang",
+    "ping",
+    "referrerpolicy",
+    "rel",
+    "target",
+    "playbackorder",
+    "timelinebegin",
+    "part",
+    "slot",
+    "exportparts",
+    "hidden",
+    // Presentation
+    "alignment-baseline",
+    "baseline-shift",
+    "clip",
+    "clip-path",
+    "clip-rule",
+    "color",
+    "color-interpolation",
+    "color-interpolation-filters",
+    "color-profile",
+    "color-rendering",
+    "cursor",
+    "direction",
+    "display",
+    "dominant-baseline",
+    "enable-background",
+    "fill",
+    "fill-opacity",
+    "fill-rule",
+    "filter",
+    "flood-color",
+    "flood-opacity",
+    "font-family",
+    "font-size",
+    "font-size-adjust",
+    "font-stretch",
+    "font-style",
+    "font-variant",
+    "font-weight",
+    "glyph-orientation-horizontal",
+    "glyph-orientation-vertical",
+    "image-rendering",
+    "kerning",
+    "letter-spacing",
+    "lighting-color",
+    "marker",
+    "marker-end",
+    "marker-mid",
+    "marker-start",
+    "mask",
+    "mask-type",
+    "opacity",
+    "overflow",
+    "paint-order",
+    "pointer-events",
+    "shape-rendering",
+    "stop-color",
+    "stop-opacity",
+    "stroke",
+    "stroke-dasharray",
+    "stroke-dashoffset",
+    "stroke-linecap",
+    "stroke-linejoin",
+    "stroke-miterlimit",
+    "stroke-opacity",
+    "stroke-width",
+    "text-anchor",
+    "text-decoration",
+    "text-overflow",
+    "text-rendering",
+    "transform",
+    "transform-origin",
+    "unicode-bidi",
+    "vector-effect",
+    "visibility",
+    "white-space",
+    "word-spacing",
+    "writing-mode",
+    // Geometry
+    "x",
+    "y",
+    "width",
+    "height",
+    "cx",
+    "cy",
+    "r",
+    "rx",
+    "ry",
+    "d",
+    "points",
+    "x1",
+    "y1",
+    "x2",
+    "y2",
+    "pathLength",
+    "viewBox",
+    "preserveAspectRatio",
+    // Gradients, patterns, clipping, masking and markers
+    "gradientUnits",
+    "gradientTransform",
+    "spreadMethod",
+    "offset",
+    "fx",
+    "fy",
+    "fr",
+    "patternUnits",
+    "patternContentUnits",
+    "patternTransform",
+    "clipPathUnits",
+    "maskUnits",
+    "maskContentUnits",
+    "markerWidth",
+    "markerHeight",
+    "markerUnits",
+    "refX",
+    "refY",
+    "orient",
+    // Text
+    "dx",
+    "dy",
+    "rotate",
+    "textLength",
+    "lengthAdjust",
+    "startOffset",
+    "method",
+    "spacing",
+    "side",
+    "path",
+    // Filters
+    "filterUnits",
+    "primitiveUnits",
+    "in",
+    "in2",
+    "result",
+    "stdDeviation",
+    "mode",
+    "operator",
+    "k1",
+    "k2",
+    "k3",
+    "k4",
+    "values",
+    "tableValues",
+    "slope",
+    "intercept",
+    "amplitude",
+    "exponent",
+    "azimuth",
+    "elevation",
+    "surfaceScale",
+    "diffuseConstant",
+    "specularConstant",
+    "specularExponent",
+    "limitingConeAngle",
+    "pointsAtX",
+    "pointsAtY",
+    "pointsAtZ",
+    "z",
+    "kernelMatrix",
+    "order",
+    "divisor",
+    "bias",
+    "targetX",
+    "targetY",
+    "edgeMode",
+    "kernelUnitLength",
+    "preserveAlpha",
+    "scale",
+    "xChannelSelector",
+    "yChannelSelector",
+    "baseFrequency",
+    "numOctaves",
+    "seed",
+    "stitchTiles",
+    "radius",
+    // Animation
+    "attributeName",
+    "attributeType",
+    "begin",
+    "dur",
+    "end",
+    "min",
+    "max",
+    "restart",
+    "repeatCount",
+    "repeatDur",
+    "calcMode",
+    "keyTimes",
+    "keySplines",
+    "keyPoints",
+    "from",
+    "to",
+    "by",
+    "additive",
+    "accumulate",
+};
+
+const svg: Defs = .{
+    .elements = &svg_elements,
+    .element_map = elementMap(&svg_elements),
+    .attributes = &svg_attributes,
+    .attribute_map = nameMap(&svg_attributes),
+    .integration_points = &.{ "foreignObject", "desc", "title" },
+};
+
+// https://developer.mozilla.org/en-US/docs/Web/MathML/Reference/Element
+const math_elements = [_]ElementDef{
+    .{ .name = "annotation", .desc = "Contains an annotation to the MathML expression in a textual format." },
+    .{ .name = "annotation-xml", .desc = "Contains an annotation to the MathML expression in an XML format, e.g. HTML." },
+    .{ .name = "maction", .desc = "Provides a possibility to bind actions to (sub-) expressions." },
+    .{ .name = "math", .desc = "The top-level MathML element, used to write a single mathematical formula." },
+    .{ .name = "menclose", .desc = "Renders its content inside an enclosing notation specified by the `notation` attribute." },
+    .{ .name = "merror", .desc = "Displays contents as error messages." },
+    .{ .name = "mfenced", .desc = "Provides the possibility to add custom opening and closing parentheses and separators to an expression." },
+    .{ .name = "mfrac", .desc = "Displays fractions." },
+    .{ .name = "mi", .desc = "Indicates that the content should be rendered as an identifier, such as a function name, variable or symbolic constant." },
+    .{ .name = "mmultiscripts", .desc = "Attaches an arbitrary number of subscripts and superscripts to an expression at once." },
+    .{ .name = "mn", .desc = "Represents a numeric literal." },
+    .{ .name = "mo", .desc = "Represents an operator in a broad sense." },
+    .{ .name = "mover", .desc = "Attaches an accent or a limit over an expression." },
+    .{ .name = "mpadded", .desc = "Adds extra padding and sets the general adjustment of position and size of enclosed contents." },
+    .{ .name = "mphantom", .desc = "Renders its content invisible, but still occupying space." },
+    .{ .name = "mprescripts", .desc = "Separates postscripts from prescripts in `<mmultiscripts>`.", .empty = true },
+    .{ .name = "mroot", .desc = "Displays roots with an explicit index." },
+    .{ .name = "mrow", .desc = "Groups sub-expressions." },
+    .{ .name = "ms", .desc = "Represents a string literal." },
+    .{ .name = "mspace", .desc = "Displays a blank space, whose size is set by its attributes.", .empty = true },
+    .{ .name = "msqrt", .desc = "Displays square roots." },
+    .{ .name = "mstyle", .desc = "Changes the style of its children." },
+    .{ .name = "msub", .desc = "Attaches a subscript to an expression." },
+    .{ .name = "msubsup", .desc = "Attaches both a subscript and a superscript to an expression." },
+    .{ .name = "msup", .desc = "Attaches a superscript to an expression." },
+    .{ .name = "mtable", .desc = "Creates tables or matrices." },
+    .{ .name = "mtd", .desc = "Represents a cell in a table or a matrix." },
+    .{ .name = "mtext", .desc = "Represents arbitrary text that should be rendered as itself." },
+    .{ .name = "mtr", .desc = "Represents a row in a table or a matrix." },
+    .{ .name = "munder", .desc = "Attaches an accent or a limit under an expression." },
+    .{ .name = "munderover", .desc = "Attaches accents or limits both under and over an expression." },
+    .{ .name = "none", .desc = "Represents an empty script in `<mmultiscripts>`.", .empty = true },
+    .{ .name = "semantics", .desc = "Associates annotations with a MathML expression." },
+};
+
+// https://developer.mozilla.org/en-US/docs/Web/MathML/Reference/Attribute
+const math_attributes = [_][]const u8{
+    "id",
+    "class",
+    "style",
+    "dir",
+    "tabindex",
+    "autofocus",
+    "nonce",
+    "role",
+    "xmlns",
+    "href",
+    "display",
+    "displaystyle",
+    "scriptlevel",
+    "mathbackground",
+    "mathcolor",
+    "mathsize",
+    "mathvariant",
+    "accent",
+    "accentunder",
+    "actiontype",
+    "align",
+    "alttext",
+    "close",
+    "columnalign",
+    "columnlines",
+    "columnspacing",
+    "columnspan",
+    "definitionURL",
+    "denomalign",
+    "depth",
+    "encoding",
+    "fence",
+    "form",
+    "frame",
+    "framespacing",
+    "height",
+    "largeop",
+    "linethickness",
+    "lspace",
+    "maxsize",
+    "minsize",
+    "movablelimits",
+    "notation",
+    "numalign",
+    "open",
+    "rowalign",
+    "rowlines",
+    "rowspacing",
+    "rowspan",
+    "rspace",
+    "scriptminsize",
+    "scriptsizemultiplier",
+    "selection",
+    "separator",
+    "separators",
+    "stretchy",
+    "subscriptshift",
+    "superscriptshift",
+    "symmetric",
+    "voffset",
+    "width",
+    "bevelled",
+    "equalcolumns",
+    "equalrows",
+    "lquote",
+    "rquote",
+};
+
+const math: Defs = .{
+    .elements = &math_elements,
+    .element_map = elementMap(&math_elements),
+    .attributes = &math_attributes,
+    .attribute_map = nameMap(&math_attributes),
+    .integration_points = &.{ "annotation-xml", "mi", "mo", "mn", "ms", "mtext" },
+};
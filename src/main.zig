@@ -124,3 +124,11 @@ fn fatalHelp() noreturn {
         \\
     , .{});
 }
+
+test {
+    _ = @import("cli/check.zig");
+    _ = @import("cli/diff.zig");
+    _ = @import("cli/Filter.zig");
+    _ = @import("cli/lsp.zig");
+    _ = @import("cli/lsp/emmet.zig");
+}
@@ -7,6 +7,8 @@ pub const Exception = vm.Exception;
 pub const html = @import("html.zig");
 pub const css = @import("css.zig");
 pub const Ast = @import("Ast.zig");
+pub const validate = @import("validate.zig").validate;
+pub const Validation = @import("validate.zig");
 
 pub const HtmlSafe = struct {
     bytes: []const u8,
@@ -141,6 +143,35 @@ pub const Span = struct {
         return selection;
     }
 
+    /// Like `range`, but columns are counted in UTF-16 code units, as LSP
+    /// clients do by default, instead of bytes. Invalid UTF-8 bytes count as
+    /// one code unit each.
+    pub fn utf16Range(self: Span, code: []const u8) Range {
+        var selection: Range = .{
+            .start = .{ .row = 0, .col = 0 },
+            .end = undefined,
+        };
+
+        for (code[0..self.start]) |c| advanceUtf16(&selection.start, c);
+        selection.end = selection.start;
+        for (code[self.start..self.end]) |c| advanceUtf16(&selection.end, c);
+        return selection;
+    }
+
+    fn advanceUtf16(pos: *Range.Pos, c: u8) void {
+        switch (c) {
+            '\n' => {
+                pos.row += 1;
+                pos.col = 0;
+            },
+            // Continuation bytes belong to the previous code unit.
+            0x80...0xBF => {},
+            // Four byte sequences are encoded as surrogate pairs.
+            0xF0...0xFF => pos.col += 2,
+            else => pos.col += 1,
+        }
+    }
+
     /// Finds the line around a Node. Choose simple nodes
     //  if you don't want unwanted newlines in the middle.
     pub fn line(span: Span, src: []const u8) Line {
@@ -173,10 +204,29 @@ pub const Span = struct {
     }
 };
 
+test "span ranges" {
+    const code = "<p>\ncaf\u{e9} \u{1f600}<b>";
+    const span: Span = .{
+        .start = @intCast(std.mem.indexOf(u8, code, "<b>").?),
+        .end = code.len,
+    };
+
+    const bytes = span.range(code);
+    try std.testing.expectEqual(1, bytes.start.row);
+    try std.testing.expectEqual(10, bytes.start.col);
+    try std.testing.expectEqual(13, bytes.end.col);
+
+    const utf16 = span.utf16Range(code);
+    try std.testing.expectEqual(1, utf16.start.row);
+    try std.testing.expectEqual(7, utf16.start.col);
+    try std.testing.expectEqual(10, utf16.end.col);
+}
+
 test {
     _ = @import("html.zig");
     _ = @import("Ast.zig");
     // _ = @import("template.zig");
     _ = @import("fuzz.zig");
+    _ = @import("validate.zig");
     _ = @import("example.zig");
 }
@@ -0,0 +1,448 @@
+//! Validation of in-memory documents, meant for tools that embed SuperHTML
+//! (e.g. static site generators). Nothing is printed: diagnostics are
+//! returned to the caller. The commands of the CLI and the language server
+//! are implemented on top of this.
+
+const std = @import("std");
+const Allocator = std.mem.Allocator;
+const Writer = std.Io.Writer;
+const root = @import("root.zig");
+const html = root.html;
+const Language = root.Language;
+const Span = root.Span;
+
+pub const Options = struct {
+    /// `.xml` documents are only checked for syntax errors.
+    language: Language = .html,
+    /// Only report syntax errors, skip all validation.
+    syntax_only: bool = false,
+    /// Validate SuperHTML templates like regular HTML documents. When
+    /// disabled, only syntax errors are reported for templates.
+    superhtml_validation: bool = true,
+    /// Validate the document as a fragment even if it has a top-level
+    /// `<html>` or `<!DOCTYPE>`.
+    fragment: bool = false,
+    rules: html.Ast.Rules = .default,
+    /// See `html.Ast.Options`.
+    max_attributes: ?u32 = null,
+    max_depth: ?u32 = null,
+    void_element_style: html.Ast.VoidElementStyle = .html,
+    /// Loads the templates referenced by `<extend>`. When set, the blocks
+    /// of SuperHTML templates are checked against the interface of the
+    /// extended template and cyclic `<extend>` chains are reported.
+    loader: ?Loader = null,
+};
+
+pub const Loader = struct {
+    context: *anyopaque,
+    /// Returns the template that `template` (the value of an `<extend>`)
+    /// refers to, relative to the template at `base`, or null if it can't
+    /// be loaded. `base` is null for the validated document. Paths of the
+    /// returned templates must be normalized, as they're used to detect
+    /// cycles.
+    loadFn: *const fn (
+        context: *anyopaque,
+        arena: Allocator,
+        base: ?[]const u8,
+        template: []const u8,
+    ) error{OutOfMemory}!?Template,
+
+    pub const Template = struct {
+        path: []const u8,
+        src: [:0]const u8,
+    };
+
+    pub fn load(
+        loader: Loader,
+        arena: Allocator,
+        base: ?[]const u8,
+        template: []const u8,
+    ) error{OutOfMemory}!?Template {
+        return loader.loadFn(loader.context, arena, base, template);
+    }
+};
+
+/// Longest chain of `<extend>` that is followed before giving up.
+const max_extend_depth = 64;
+
+pub const Diagnostic = struct {
+    severity: Severity,
+    /// Stable identifier of the diagnostic, e.g. `html.attr.unknown`.
+    code: []const u8,
+    /// Name of the error in the validator, e.g. `invalid_attr`. Unlike
+    /// `code` it can change between releases.
+    rule: []const u8,
+    message: []const u8,
+    /// Byte offsets of the reported code.
+    span: Span,
+    /// Another relevant location, e.g. the first occurrence of a duplicate
+    /// attribute.
+    note: ?Note = null,
+
+    pub const Severity = html.Ast.Error.Severity;
+    pub const Note = struct {
+        message: []const u8,
+        span: Span,
+    };
+};
+
+pub const Result = struct {
+    /// Owns the memory of all diagnostics and of the parsed document.
+    arena: std.heap.ArenaAllocator,
+    diagnostics: []const Diagnostic,
+    /// Syntax errors stop validation (and prevent formatting).
+    has_syntax_errors: bool,
+    ast: html.Ast,
+    /// The template of a SuperHTML document, if it has no syntax errors.
+    template: ?root.Ast,
+
+    pub fn deinit(result: Result) void {
+        result.arena.deinit();
+    }
+
+    pub fn hasErrors(result: Result) bool {
+        for (result.diagnostics) |d| {
+            if (d.severity == .@"error") return true;
+        }
+        return false;
+    }
+
+    /// Prints diagnostics in the same format as `superhtml check`, `src`
+    /// must be the validated document.
+    pub fn print(
+        result: Result,
+        src: []const u8,
+        path: ?[]const u8,
+        w: *Writer,
+    ) !void {
+        for (result.diagnostics) |d| {
+            const range = d.span.range(src);
+            try w.print("{s}:{}:{}: {s}\n", .{
+                path orelse "<stdin>",
+                range.start.row,
+                range.start.col,
+                d.message,
+            });
+            try html.Ast.printSourceLine(src, d.span, w);
+
+            const note = d.note orelse continue;
+            const note_range = note.span.range(src);
+            try w.print("{s}:{}:{}: note: {s}\n", .{
+                path orelse "<stdin>",
+                note_range.start.row,
+                note_range.start.col,
+                note.message,
+            });
+            try html.Ast.printSourceLine(src, note.span, w);
+        }
+    }
+};
+
+/// Validates `src`, the returned result must be freed with `deinit`.
+pub fn validate(
+    gpa: Allocator,
+    src: []const u8,
+    options: Options,
+) error{OutOfMemory}!Result {
+    var arena_impl: std.heap.ArenaAllocator = .init(gpa);
+    errdefer arena_impl.deinit();
+    const arena = arena_impl.allocator();
+
+    const language = options.language;
+    const ast = try html.Ast.init(arena, src, language, .{
+        .syntax_only = options.syntax_only,
+        .superhtml_validation = options.superhtml_validation,
+        .fragment = options.fragment,
+        .rules = options.rules,
+        .max_attributes = options.max_attributes,
+        .max_depth = options.max_depth,
+        .void_element_style = options.void_element_style,
+    });
+
+    var diagnostics: std.ArrayList(Diagnostic) = try .initCapacity(
+        arena,
+        ast.errors.len,
+    );
+    for (ast.errors) |err| {
+        diagnostics.appendAssumeCapacity(.{
+            .severity = err.severity,
+            .code = err.code(),
+            .rule = @tagName(err.tag),
+            .message = try std.fmt.allocPrint(arena, "{f}", .{err.tag.fmt(src)}),
+            .span = err.main_location,
+            .note = if (err.note()) |n| .{
+                .message = n.message,
+                .span = n.span,
+            } else null,
+        });
+    }
+
+    // Template errors are only meaningful in documents that parsed cleanly,
+    // validation errors and warnings don't get in the way.
+    const template: ?root.Ast = if (language == .superhtml and !ast.has_syntax_errors)
+        try root.Ast.init(arena, ast, src)
+    else
+        null;
+
+    if (template) |t| {
+        const extend_errors: []const root.Ast.Error = blk: {
+            const loader = options.loader orelse break :blk &.{};
+            // The extended template is only looked at when this one is valid.
+            if (t.errors.len > 0) break :blk &.{};
+            break :blk try extendErrors(arena, t, src, loader);
+        };
+
+        for ([_][]const root.Ast.Error{ t.errors, extend_errors }) |errors| {
+            for (errors) |err| {
+                try diagnostics.append(arena, .{
+                    .severity = .@"error",
+                    .code = err.kind.code(),
+                    .rule = @tagName(err.kind),
+                    .message = try std.fmt.allocPrint(arena, "{f}", .{err.kind}),
+                    .span = err.main_location,
+                });
+            }
+        }
+    }
+
+    return .{
+        .arena = arena_impl,
+        .diagnostics = diagnostics.items,
+        .has_syntax_errors = ast.has_syntax_errors,
+        .ast = ast,
+        .template = template,
+    };
+}
+
+/// A template loaded through a `Loader`, e.g. the one extended by the
+/// validated document.
+pub const Layout = struct {
+    path: []const u8,
+    src: []const u8,
+    html: html.Ast,
+    ast: root.Ast,
+
+    /// Returns null if the template has errors. Broken templates are
+    /// reported when they are validated themselves.
+    pub fn parse(
+        arena: Allocator,
+        template: Loader.Template,
+    ) error{OutOfMemory}!?Layout {
+        const html_ast = try html.Ast.init(arena, template.src, .superhtml, .{
+            .syntax_only = true,
+        });
+        if (html_ast.has_syntax_errors) return null;
+        const ast = try root.Ast.init(arena, html_ast, template.src);
+        if (ast.errors.len > 0) return null;
+        return .{
+            .path = template.path,
+            .src = template.src,
+            .html = html_ast,
+            .ast = ast,
+        };
+    }
+};
+
+/// Follows the chain of `<extend>` that starts at `template`. Only the
+/// blocks of `template` are checked, templates further up the chain are
+/// checked when they are validated themselves.
+fn extendErrors(
+    arena: Allocator,
+    template: root.Ast,
+    src: []const u8,
+    loader: Loader,
+) error{OutOfMemory}![]const root.Ast.Error {
+    const template_value = template.extendTemplate() orelse return &.{};
+
+    var errors: std.ArrayList(root.Ast.Error) = .empty;
+    var visited: std.StringHashMapUnmanaged(void) = .empty;
+    var base: ?[]const u8 = null;
+    var current = template;
+    var current_src = src;
+    for (0..max_extend_depth) |depth| {
+        const target = current.extendTemplate() orelse return errors.items;
+        const loaded = try loader.load(
+            arena,
+            base,
+            target.slice(current_src),
+        ) orelse {
+            if (depth == 0) try errors.append(arena, .{
+                .kind = .extend_not_found,
+                .main_location = template_value,
+            });
+            return errors.items;
+        };
+
+        const gop = try visited.getOrPut(arena, loaded.path);
+        if (gop.found_existing) break;
+
+        const layout = try Layout.parse(arena, loaded) orelse return errors.items;
+        if (depth == 0) {
+            try errors.appendSlice(arena, try template.blockErrors(arena, layout.ast));
+        }
+
+        base = loaded.path;
+        current = layout.ast;
+        current_src = layout.src;
+    }
+
+    try errors.append(arena, .{
+        .kind = .extend_cycle,
+        .main_location = template_value,
+    });
+    return errors.items;
+}
+
+test "validate" {
+    const src =
+        \\<div id="a"></div>
+        \\<p id="a" foo>Hello</p>
+        \\
+    ;
+    const result = try validate(std.testing.allocator, src, .{});
+    defer result.deinit();
+
+    try std.testing.expect(!result.has_syntax_errors);
+    try std.testing.expect(result.hasErrors());
+    try std.testing.expectEqual(2, result.diagnostics.len);
+
+    try std.testing.expectEqualStrings(
+        "html.attr.duplicate-id",
+        result.diagnostics[0].code,
+    );
+    try std.testing.expectEqualStrings(
+        "html.attr.unknown",
+        result.diagnostics[1].code,
+    );
+
+    const duplicate = result.diagnostics[0];
+    try std.testing.expectEqualStrings(
+        "\"a\"",
+        src[duplicate.span.start - 1 .. duplicate.span.end + 1],
+    );
+    try std.testing.expectEqual(
+        std.mem.indexOf(u8, src, "a\"").?,
+        duplicate.note.?.span.start,
+    );
+}
+
+test "diagnostic codes are unique" {
+    const gpa = std.testing.allocator;
+    var seen: std.StringHashMapUnmanaged(void) = .empty;
+    defer seen.deinit(gpa);
+
+    const Tag = @FieldType(html.Ast.Error, "tag");
+    inline for (@typeInfo(Tag).@"union".fields) |f| {
+        if (comptime std.mem.eql(u8, f.name, "token")) continue;
+        const err: html.Ast.Error = .{
+            .tag = @unionInit(Tag, f.name, undefined),
+            .main_location = undefined,
+            .node_idx = 0,
+        };
+        const gop = try seen.getOrPut(gpa, err.code());
+        try std.testing.expect(!gop.found_existing);
+    }
+
+    for (std.enums.values(html.Tokenizer.TokenError)) |terr| {
+        const err: html.Ast.Error = .{
+            .tag = .{ .token = terr },
+            .main_location = undefined,
+            .node_idx = 0,
+        };
+        const gop = try seen.getOrPut(gpa, err.code());
+        try std.testing.expect(!gop.found_existing);
+    }
+
+    const Kind = @FieldType(root.Ast.Error, "kind");
+    inline for (@typeInfo(Kind).@"union".fields) |f| {
+        const kind = @unionInit(Kind, f.name, undefined);
+        const gop = try seen.getOrPut(gpa, kind.code());
+        try std.testing.expect(!gop.found_existing);
+    }
+}
+
+test "template errors next to warnings" {
+    const templates = struct {
+        fn load(
+            context: *anyopaque,
+            arena: Allocator,
+            base: ?[]const u8,
+            template: []const u8,
+        ) error{OutOfMemory}!?Loader.Template {
+            _ = context;
+            _ = arena;
+            _ = base;
+            _ = template;
+            return null;
+        }
+    };
+    var context: u8 = 0;
+    const loader: Loader = .{ .context = &context, .loadFn = templates.load };
+
+    const src =
+        \\<extend template="missing.shtml">
+        \\<div id="main"><img src="a.png"></div>
+    ;
+    const result = try validate(std.testing.allocator, src, .{
+        .language = .superhtml,
+        .loader = loader,
+    });
+    defer result.deinit();
+
+    try std.testing.expectEqual(2, result.diagnostics.len);
+    const warning = result.diagnostics[0];
+    try std.testing.expectEqualStrings("html.attr.missing-alt", warning.code);
+    try std.testing.expectEqual(.warning, warning.severity);
+    try std.testing.expectEqualStrings(
+        "superhtml.extend-not-found",
+        result.diagnostics[1].code,
+    );
+}
+
+test "extend" {
+    const templates = struct {
+        const map: std.StaticStringMap([:0]const u8) = .initComptime(.{
+            .{ "layout.shtml", "<div id=\"main\"><super></div>" },
+            .{ "a.shtml", "<extend template=\"b.shtml\">\n<div id=\"x\"></div>" },
+            .{ "b.shtml", "<extend template=\"a.shtml\">\n<div id=\"x\"><p id=\"y\"><super></p></div>" },
+        });
+
+        fn load(
+            context: *anyopaque,
+            arena: Allocator,
+            base: ?[]const u8,
+            template: []const u8,
+        ) error{OutOfMemory}!?Loader.Template {
+            _ = context;
+            _ = arena;
+            _ = base;
+            const template_src = map.get(template) orelse return null;
+            return .{ .path = template, .src = template_src };
+        }
+    };
+    var context: u8 = 0;
+    const loader: Loader = .{ .context = &context, .loadFn = templates.load };
+
+    // Source, expected code (if any) and reported code.
+    inline for (.{
+        .{ "<extend template=\"layout.shtml\">\n<div id=\"main\"></div>", "", "" },
+        .{ "<extend template=\"layout.shtml\">\n<div id=\"mian\"></div>", "superhtml.block-not-in-interface", "mian" },
+        .{ "<extend template=\"missing.shtml\">\n<div id=\"main\"></div>", "superhtml.extend-not-found", "missing.shtml" },
+        .{ "<extend template=\"b.shtml\">\n<div id=\"y\"></div>", "superhtml.extend-cycle", "b.shtml" },
+    }) |case| {
+        const result = try validate(std.testing.allocator, case[0], .{
+            .language = .superhtml,
+            .loader = loader,
+        });
+        defer result.deinit();
+
+        if (case[1].len == 0) {
+            try std.testing.expectEqual(0, result.diagnostics.len);
+        } else {
+            try std.testing.expectEqual(1, result.diagnostics.len);
+            const d = result.diagnostics[0];
+            try std.testing.expectEqualStrings(case[1], d.code);
+            try std.testing.expectEqualStrings(case[2], d.span.slice(case[0]));
+        }
+    }
+}
@@ -1,6 +1,9 @@
 package tree_sitter_html_test
 
 import (
+	"context"
+	"os"
+	"slices"
 	"testing"
 
 	tree_sitter "github.com/smacker/go-tree-sitter"
@@ -13,3 +16,78 @@ func TestCanLoadGrammar(t *testing.T) {
 		t.Errorf("Error loading HTML grammar")
 	}
 }
+
+func TestInjections(t *testing.T) {
+	language := tree_sitter.NewLanguage(tree_sitter_html.Language())
+	pattern, err := os.ReadFile("../../queries/injections.scm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := tree_sitter.NewQuery(pattern, language)
+	if err != nil {
+		t.Fatalf("Error loading injections query: %v", err)
+	}
+
+	parser := tree_sitter.NewParser()
+	parser.SetLanguage(language)
+
+	cases := []struct {
+		source    string
+		languages []string
+	}{
+		{`<script>let a = 1;</script>`, []string{"javascript"}},
+		{`<script type="module" async>import "a";</script>`, []string{"javascript"}},
+		{`<script type=text/javascript>let a = 1;</script>`, []string{"javascript"}},
+		{`<script type="application/ld+json">{}</script>`, []string{"json"}},
+		{`<script type="importmap">{}</script>`, []string{"json"}},
+		{`<script type="text/template"><p>a</p></script>`, nil},
+		{`<style>p { color: red; }</style>`, []string{"css"}},
+		{`<style>p {}</style><script>f();</script>`, []string{"css", "javascript"}},
+	}
+
+	for _, c := range cases {
+		source := []byte(c.source)
+		tree, err := parser.ParseCtx(context.Background(), nil, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var languages []string
+		cursor := tree_sitter.NewQueryCursor()
+		cursor.Exec(query, tree.RootNode())
+		for {
+			match, ok := cursor.NextMatch()
+			if !ok {
+				break
+			}
+			match = cursor.FilterPredicates(match, source)
+			for _, capture := range match.Captures {
+				if query.CaptureNameForId(capture.Index) != "injection.content" {
+					continue
+				}
+				if capture.Node.Type() != "raw_text" {
+					t.Errorf("%s: injected node is a %s", c.source, capture.Node.Type())
+				}
+				languages = append(languages, injectionLanguage(query, match.PatternIndex))
+			}
+		}
+
+		if !slices.Equal(languages, c.languages) {
+			t.Errorf("%s: expected %v, got %v", c.source, c.languages, languages)
+		}
+	}
+}
+
+// Returns the value of the `(#set! injection.language ...)` predicate of
+// the pattern.
+func injectionLanguage(query *tree_sitter.Query, pattern uint16) string {
+	for _, steps := range query.PredicatesForPattern(uint32(pattern)) {
+		if len(steps) < 3 || query.StringValueForId(steps[0].ValueId) != "set!" {
+			continue
+		}
+		if query.StringValueForId(steps[1].ValueId) == "injection.language" {
+			return query.StringValueForId(steps[2].ValueId)
+		}
+	}
+	return ""
+}
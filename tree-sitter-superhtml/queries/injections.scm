@@ -1,7 +1,36 @@
+; Scripts without a type, or with a JavaScript type, are JavaScript.
 ((script_element
+  (start_tag) @_start_tag
   (raw_text) @injection.content)
+ (#not-match? @_start_tag "(?i)\\stype\\s*=")
  (#set! injection.language "javascript"))
 
+((script_element
+  (start_tag
+    (attribute
+      (attribute_name) @_attr
+      [
+        (attribute_value) @_type
+        (quoted_attribute_value (attribute_value) @_type)
+      ]))
+  (raw_text) @injection.content)
+ (#match? @_attr "(?i)^type$")
+ (#match? @_type "(?i)^(module|(text|application)/(java|ecma)script)$")
+ (#set! injection.language "javascript"))
+
+((script_element
+  (start_tag
+    (attribute
+      (attribute_name) @_attr
+      [
+        (attribute_value) @_type
+        (quoted_attribute_value (attribute_value) @_type)
+      ]))
+  (raw_text) @injection.content)
+ (#match? @_attr "(?i)^type$")
+ (#match? @_type "(?i)^(importmap|speculationrules|application/(ld\\+)?json)$")
+ (#set! injection.language "json"))
+
 ((style_element
   (raw_text) @injection.content)
  (#set! injection.language "css"))